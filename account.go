@@ -0,0 +1,408 @@
+package ircd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	passwordIterations = 100000
+	passwordSaltLength = 16
+	minPasswordLength  = 6
+)
+
+type AccountStorer interface {
+	// Creates an account that owns the nickname name.
+	register(name string, password string, email string, at time.Time) error
+	// Returns the canonical account name if password is correct.
+	authenticate(name string, password string) (string, bool)
+	// Returns the account that has certfp.
+	authenticateCertificate(certfp string) (string, bool)
+	// Returns the account that owns nickname.
+	owner(nickname string) (string, bool)
+	// Adds nickname to account.
+	group(name string, nickname string) error
+	// Removes nickname from account.
+	ungroup(name string, nickname string) error
+	// Deletes account.
+	drop(name string) error
+	// Adds certificate fingerprint to account.
+	addCertificate(name string, certfp string) error
+	// Removes certificate fingerprint from account.
+	removeCertificate(name string, certfp string) error
+	// Returns certificate fingerprints of account.
+	certificates(name string) []string
+}
+
+type account struct {
+	Name         string
+	Password     string
+	Email        string
+	Registered   time.Time
+	Nicknames    []string
+	Certificates []string
+}
+
+// Account store kept in memory and optionally saved to a database.
+type AccountStore struct {
+	mu *sync.RWMutex
+
+	// Nil if accounts are not saved.
+	db *Database
+	// Keyed by lowercase account name.
+	accounts map[string]*account
+	// Lowercase nickname to lowercase account name.
+	nicknames map[string]string
+}
+
+// Creates an account store that is not saved.
+func NewAccountStore() *AccountStore {
+	return &AccountStore{
+		mu:        &sync.RWMutex{},
+		accounts:  make(map[string]*account),
+		nicknames: make(map[string]string),
+	}
+}
+
+// Creates an account store saved to db, existing accounts are loaded.
+func OpenAccountStore(db *Database) (*AccountStore, error) {
+	as := NewAccountStore()
+	as.db = db
+
+	for _, raw := range db.scan("account/") {
+		a := &account{}
+		err := json.Unmarshal(raw, a)
+		if err != nil {
+			return nil, fmt.Errorf("cant read account: %w", err)
+		}
+		key := strings.ToLower(a.Name)
+		as.accounts[key] = a
+		for _, nick := range a.Nicknames {
+			as.nicknames[strings.ToLower(nick)] = key
+		}
+	}
+	return as, nil
+}
+
+// Writes account key to the database, or deletes it if it no longer exists.
+// Must be called with the lock held.
+func (as *AccountStore) save(key string) error {
+	if as.db == nil {
+		return nil
+	}
+	a, ok := as.accounts[key]
+	if !ok {
+		return as.db.delete("account/" + key)
+	}
+	return as.db.put("account/"+key, a)
+}
+
+func (as *AccountStore) register(name string, password string, email string, at time.Time) error {
+	if len(password) < minPasswordLength {
+		return errorWeakPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	key := strings.ToLower(name)
+	if _, exists := as.nicknames[key]; exists {
+		return errorAccountExists
+	}
+	as.accounts[key] = &account{
+		Name:         name,
+		Password:     hash,
+		Email:        email,
+		Registered:   at,
+		Nicknames:    []string{name},
+		Certificates: []string{},
+	}
+	as.nicknames[key] = key
+
+	err = as.save(key)
+	if err != nil {
+		delete(as.accounts, key)
+		delete(as.nicknames, key)
+	}
+	return err
+}
+
+func (as *AccountStore) authenticate(name string, password string) (string, bool) {
+	as.mu.RLock()
+	a, ok := as.accounts[strings.ToLower(name)]
+	as.mu.RUnlock()
+	if !ok {
+		// spend the same time as for an existing account
+		checkPassword(dummyPasswordHash(), password)
+		return "", false
+	}
+	if !checkPassword(a.Password, password) {
+		return "", false
+	}
+	return a.Name, true
+}
+
+func (as *AccountStore) authenticateCertificate(certfp string) (string, bool) {
+	certfp = normalizeFingerprint(certfp)
+	if certfp == "" {
+		return "", false
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	for _, a := range as.accounts {
+		for _, fp := range a.Certificates {
+			if subtle.ConstantTimeCompare([]byte(fp), []byte(certfp)) == 1 {
+				return a.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (as *AccountStore) owner(nickname string) (string, bool) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	key, ok := as.nicknames[strings.ToLower(nickname)]
+	if !ok {
+		return "", false
+	}
+	return as.accounts[key].Name, true
+}
+
+func (as *AccountStore) group(name string, nickname string) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	key := strings.ToLower(name)
+	a, ok := as.accounts[key]
+	if !ok {
+		return errorAccountDoesNotExist
+	}
+	nick := strings.ToLower(nickname)
+	if owner, exists := as.nicknames[nick]; exists {
+		if owner == key {
+			return nil
+		}
+		return errorAccountExists
+	}
+
+	a.Nicknames = append(a.Nicknames, nickname)
+	as.nicknames[nick] = key
+
+	err := as.save(key)
+	if err != nil {
+		a.Nicknames = a.Nicknames[:len(a.Nicknames)-1]
+		delete(as.nicknames, nick)
+	}
+	return err
+}
+
+func (as *AccountStore) ungroup(name string, nickname string) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	key := strings.ToLower(name)
+	a, ok := as.accounts[key]
+	if !ok {
+		return errorAccountDoesNotExist
+	}
+	nick := strings.ToLower(nickname)
+	// the account name can only be released by dropping the account
+	if as.nicknames[nick] != key || nick == key {
+		return errorNicknameNotGrouped
+	}
+
+	nicknames := a.Nicknames
+	a.Nicknames = slices.DeleteFunc(slices.Clone(nicknames), func(n string) bool {
+		return strings.ToLower(n) == nick
+	})
+	delete(as.nicknames, nick)
+
+	err := as.save(key)
+	if err != nil {
+		a.Nicknames = nicknames
+		as.nicknames[nick] = key
+	}
+	return err
+}
+
+func (as *AccountStore) drop(name string) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	key := strings.ToLower(name)
+	a, ok := as.accounts[key]
+	if !ok {
+		return errorAccountDoesNotExist
+	}
+	delete(as.accounts, key)
+	for _, nick := range a.Nicknames {
+		delete(as.nicknames, strings.ToLower(nick))
+	}
+
+	err := as.save(key)
+	if err != nil {
+		as.accounts[key] = a
+		for _, nick := range a.Nicknames {
+			as.nicknames[strings.ToLower(nick)] = key
+		}
+	}
+	return err
+}
+
+func (as *AccountStore) addCertificate(name string, certfp string) error {
+	certfp = normalizeFingerprint(certfp)
+	if certfp == "" {
+		return errorInvalidFingerprint
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	key := strings.ToLower(name)
+	a, ok := as.accounts[key]
+	if !ok {
+		return errorAccountDoesNotExist
+	}
+	for _, other := range as.accounts {
+		if slices.Contains(other.Certificates, certfp) {
+			if other == a {
+				return nil
+			}
+			return errorFingerprintInUse
+		}
+	}
+
+	a.Certificates = append(a.Certificates, certfp)
+	err := as.save(key)
+	if err != nil {
+		a.Certificates = a.Certificates[:len(a.Certificates)-1]
+	}
+	return err
+}
+
+func (as *AccountStore) removeCertificate(name string, certfp string) error {
+	certfp = normalizeFingerprint(certfp)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	key := strings.ToLower(name)
+	a, ok := as.accounts[key]
+	if !ok {
+		return errorAccountDoesNotExist
+	}
+	if !slices.Contains(a.Certificates, certfp) {
+		return errorInvalidFingerprint
+	}
+
+	certificates := a.Certificates
+	a.Certificates = slices.DeleteFunc(slices.Clone(certificates), func(fp string) bool {
+		return fp == certfp
+	})
+	err := as.save(key)
+	if err != nil {
+		a.Certificates = certificates
+	}
+	return err
+}
+
+func (as *AccountStore) certificates(name string) []string {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	a, ok := as.accounts[strings.ToLower(name)]
+	if !ok {
+		return []string{}
+	}
+	return slices.Clone(a.Certificates)
+}
+
+// Hash compared against when an account does not exist.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("")
+	return hash
+})
+
+// Hashes password with PBKDF2-HMAC-SHA256 and a random salt.
+//
+// Format: pbkdf2-sha256$<iterations>$<salt>$<hash>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations, sha256.Size)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s",
+		passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Does password match hash created by hashPassword?
+func checkPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got := pbkdf2SHA256([]byte(password), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// PBKDF2 with HMAC-SHA256.
+//
+// https://datatracker.ietf.org/doc/html/rfc8018#section-5.2
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, length int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := []byte{}
+	block := make([]byte, 4)
+	for i := uint32(1); len(key) < length; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(block, i)
+		prf.Write(block)
+		u := prf.Sum(nil)
+
+		t := slices.Clone(u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
@@ -0,0 +1,112 @@
+package ircd
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// https://datatracker.ietf.org/doc/html/rfc7914#section-11
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64))
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := hashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkPassword(hash, "hunter2") {
+		t.Error("correct password was rejected")
+	}
+	if checkPassword(hash, "hunter3") {
+		t.Error("wrong password was accepted")
+	}
+	if checkPassword("plaintext", "plaintext") {
+		t.Error("malformed hash was accepted")
+	}
+}
+
+func TestAccountStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as, err := OpenAccountStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := as.register("Alice", "short", "", time.Now()); err != errorWeakPassword {
+		t.Errorf("got %v, want %v", err, errorWeakPassword)
+	}
+	if err := as.register("Alice", "secret1", "alice@example.com", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := as.register("alice", "secret1", "", time.Now()); err != errorAccountExists {
+		t.Errorf("got %v, want %v", err, errorAccountExists)
+	}
+
+	if account, ok := as.authenticate("ALICE", "secret1"); !ok || account != "Alice" {
+		t.Errorf("got %s %t, want Alice true", account, ok)
+	}
+	if _, ok := as.authenticate("alice", "secret2"); ok {
+		t.Error("wrong password was accepted")
+	}
+
+	if err := as.group("alice", "alice_"); err != nil {
+		t.Fatal(err)
+	}
+	if err := as.addCertificate("alice", "AB:CD:EF"); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen from disk
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as, err = OpenAccountStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner, ok := as.owner("Alice_"); !ok || owner != "Alice" {
+		t.Errorf("got %s %t, want Alice true", owner, ok)
+	}
+	if account, ok := as.authenticateCertificate("abcdef"); !ok || account != "Alice" {
+		t.Errorf("got %s %t, want Alice true", account, ok)
+	}
+
+	if err := as.ungroup("alice", "alice"); err != errorNicknameNotGrouped {
+		t.Errorf("got %v, want %v", err, errorNicknameNotGrouped)
+	}
+	if err := as.ungroup("alice", "alice_"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := as.owner("alice_"); ok {
+		t.Error("ungrouped nickname still has an owner")
+	}
+
+	if err := as.drop("alice"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	as, err = OpenAccountStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := as.owner("alice"); ok {
+		t.Error("dropped account still owns its nickname")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"cmp"
 	"fmt"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -22,14 +23,18 @@ type channeler interface {
 	// Channel topic.
 	topic() *topic
 	// Set channel topic.
-	setTopic(text string, author string)
-
-	// Does prefix match any of the ban masks?
-	banned(c clienter) bool
-	// Add ban mask.
-	addBan(mask banMask) error
-	// Remove ban mask.
-	removeBan(mask banMask) error
+	setTopic(text string, author string, at time.Time)
+
+	// Add entry to list mode (e.g. b), fails if the mask is already listed.
+	addListEntry(mode rune, entry listEntry) error
+	// Remove mask from list mode, returns the removed entry.
+	removeListEntry(mode rune, mask string) (listEntry, error)
+	// Get entries of list mode, oldest first.
+	listEntries(mode rune) []listEntry
+	// Set timer expiring mask of list mode, stopped when the mask is removed.
+	setListTimer(mode rune, mask string, timer *time.Timer)
+	// Stop timers of all list entries.
+	stopListTimers()
 
 	// Channel members in NAMES format including highest prefix.
 	names() []string
@@ -66,9 +71,29 @@ type channeler interface {
 	key() string
 	// Set channel key (password).
 	setKey(key string)
+	// Get channel user limit, 0 if there is none.
+	limit() int
+	// Set channel user limit.
+	setLimit(limit int)
+	// Get channel that clients who can not join are forwarded to.
+	forward() string
+	// Set forward channel.
+	setForward(channel string)
+}
+
+// Entry of a channel list mode.
+type listEntry struct {
+	Mask string
+	// Prefix of the client who added the entry.
+	Setter string
+	Set    time.Time
+	// Zero if the entry does not expire.
+	Expires time.Time
 }
 
-type banMask string
+func (e listEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
 
 type channel struct {
 	mu *sync.RWMutex
@@ -79,12 +104,19 @@ type channel struct {
 	// Channel clients.
 	cs      channelClientStorer
 	modes   channelMode
-	bans    map[banMask]bool
 	invites map[clientID]bool
+	// List mode entries by mode.
+	lists map[rune][]listEntry
+	// Expiry timers by mode and lowercase mask.
+	timers map[string]*time.Timer
 	// Channel owner.
 	o clientID
 	// Channel password.
 	k string
+	// Channel user limit.
+	l int
+	// Forward channel.
+	f string
 }
 
 type topic struct {
@@ -104,7 +136,8 @@ func newChannel(channelName string, owner clientID) *channel {
 		},
 		cs:      newChannelClientStore(),
 		modes:   0,
-		bans:    make(map[banMask]bool),
+		lists:   make(map[rune][]listEntry),
+		timers:  make(map[string]*time.Timer),
 		invites: make(map[clientID]bool),
 		o:       owner,
 		k:       "",
@@ -141,6 +174,30 @@ func (ch *channel) setKey(key string) {
 	ch.mu.Unlock()
 }
 
+func (ch *channel) limit() int {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.l
+}
+
+func (ch *channel) setLimit(limit int) {
+	ch.mu.Lock()
+	ch.l = limit
+	ch.mu.Unlock()
+}
+
+func (ch *channel) forward() string {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.f
+}
+
+func (ch *channel) setForward(channel string) {
+	ch.mu.Lock()
+	ch.f = channel
+	ch.mu.Unlock()
+}
+
 func (ch *channel) owner() clientID {
 	ch.mu.RLock()
 	defer ch.mu.RUnlock()
@@ -148,50 +205,74 @@ func (ch *channel) owner() clientID {
 }
 
 // Sets channel topic.
-func (ch *channel) setTopic(text string, author string) {
+func (ch *channel) setTopic(text string, author string, at time.Time) {
 	ch.mu.Lock()
 	ch.t.text = text
-	ch.t.timestamp = int(time.Now().Unix())
+	ch.t.timestamp = int(at.Unix())
 	ch.t.author = author
 	ch.mu.Unlock()
 }
 
-func (ch *channel) banned(c clienter) bool {
-	ch.mu.RLock()
-	defer ch.mu.RUnlock()
+func (ch *channel) addListEntry(mode rune, entry listEntry) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
 
-	for mask := range ch.bans {
-		if matchMask([]byte(mask), c.hostname()) {
-			return true
+	for _, existing := range ch.lists[mode] {
+		if strings.EqualFold(existing.Mask, entry.Mask) {
+			return errorMaskAlreadyListed
 		}
 	}
-	return false
+	ch.lists[mode] = append(ch.lists[mode], entry)
+	return nil
 }
 
-func (ch *channel) addBan(mask banMask) error {
-	ch.mu.RLock()
-	_, ok := ch.bans[mask]
-	ch.mu.RUnlock()
-	if ok {
-		return errorBanMaskAlreadyExists
-	}
+func (ch *channel) removeListEntry(mode rune, mask string) (listEntry, error) {
 	ch.mu.Lock()
-	ch.bans[mask] = true
-	ch.mu.Unlock()
-	return nil
+	defer ch.mu.Unlock()
+
+	for i, existing := range ch.lists[mode] {
+		if strings.EqualFold(existing.Mask, mask) {
+			ch.lists[mode] = slices.Delete(ch.lists[mode], i, i+1)
+			key := listTimerKey(mode, mask)
+			if timer, ok := ch.timers[key]; ok {
+				timer.Stop()
+				delete(ch.timers, key)
+			}
+			return existing, nil
+		}
+	}
+	return listEntry{}, errorMaskNotListed
 }
 
-func (ch *channel) removeBan(mask banMask) error {
+func (ch *channel) listEntries(mode rune) []listEntry {
 	ch.mu.RLock()
-	_, ok := ch.bans[mask]
-	ch.mu.RUnlock()
-	if !ok {
-		return errorBanMaskDoesNotExist
+	defer ch.mu.RUnlock()
+	return slices.Clone(ch.lists[mode])
+}
+
+func (ch *channel) setListTimer(mode rune, mask string, timer *time.Timer) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	key := listTimerKey(mode, mask)
+	if existing, ok := ch.timers[key]; ok {
+		existing.Stop()
 	}
+	ch.timers[key] = timer
+}
+
+func (ch *channel) stopListTimers() {
 	ch.mu.Lock()
-	delete(ch.bans, mask)
-	ch.mu.Unlock()
-	return nil
+	defer ch.mu.Unlock()
+
+	for key, timer := range ch.timers {
+		timer.Stop()
+		delete(ch.timers, key)
+	}
+}
+
+func listTimerKey(mode rune, mask string) string {
+	return string(mode) + strings.ToLower(mask)
 }
 
 // Returns current topic.
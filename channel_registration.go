@@ -0,0 +1,189 @@
+package ircd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ChannelRegistrationStorer interface {
+	// Registers channel name to founder account.
+	register(name string, founder string, at time.Time) error
+	// Returns a copy of the registration of channel name.
+	get(name string) (registeredChannel, bool)
+	// Calls fn with the registration of channel name and saves the result.
+	update(name string, fn func(rc *registeredChannel)) error
+	// Deletes the registration of channel name.
+	drop(name string) error
+}
+
+type registeredChannel struct {
+	Name       string
+	Founder    string
+	Registered time.Time
+	// Account name to access level, one of the membership mode letters.
+	Access map[string]string
+
+	// Settings restored when the channel is created again.
+	Topic       string
+	TopicAuthor string
+	TopicTime   int
+	Modes       string
+	Key         string
+	Limit       int
+	Forward     string
+	// List mode entries by mode letter.
+	Lists map[string][]listEntry
+}
+
+// Access level of account, founders have q.
+func (rc registeredChannel) level(account string) string {
+	if account == "" {
+		return ""
+	}
+	if strings.EqualFold(rc.Founder, account) {
+		return "q"
+	}
+	return rc.Access[strings.ToLower(account)]
+}
+
+// Channel registrations kept in memory and optionally saved to a database.
+// Only registered channels keep their topic, modes and lists across
+// restarts, unregistered channels are not saved.
+type ChannelRegistrationStore struct {
+	mu *sync.RWMutex
+
+	// Nil if registrations are not saved.
+	db *Database
+	// Keyed by lowercase channel name.
+	channels map[string]*registeredChannel
+}
+
+// Creates a channel registration store that is not saved.
+func NewChannelRegistrationStore() *ChannelRegistrationStore {
+	return &ChannelRegistrationStore{
+		mu:       &sync.RWMutex{},
+		channels: make(map[string]*registeredChannel),
+	}
+}
+
+// Creates a channel registration store saved to db, existing registrations
+// are loaded.
+func OpenChannelRegistrationStore(db *Database) (*ChannelRegistrationStore, error) {
+	cs := NewChannelRegistrationStore()
+	cs.db = db
+
+	for _, raw := range db.scan("channel/") {
+		rc := &registeredChannel{}
+		err := json.Unmarshal(raw, rc)
+		if err != nil {
+			return nil, fmt.Errorf("cant read channel registration: %w", err)
+		}
+		if rc.Access == nil {
+			rc.Access = make(map[string]string)
+		}
+		cs.channels[strings.ToLower(rc.Name)] = rc
+	}
+	return cs, nil
+}
+
+// Writes registration key to the database, or deletes it if it no longer
+// exists. Must be called with the lock held.
+func (cs *ChannelRegistrationStore) save(key string) error {
+	if cs.db == nil {
+		return nil
+	}
+	rc, ok := cs.channels[key]
+	if !ok {
+		return cs.db.delete("channel/" + key)
+	}
+	return cs.db.put("channel/"+key, rc)
+}
+
+func (cs *ChannelRegistrationStore) register(name string, founder string, at time.Time) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := strings.ToLower(name)
+	if _, exists := cs.channels[key]; exists {
+		return errorChannelRegistered
+	}
+	cs.channels[key] = &registeredChannel{
+		Name:       name,
+		Founder:    founder,
+		Registered: at,
+		Access:     make(map[string]string),
+		Lists:      make(map[string][]listEntry),
+	}
+
+	err := cs.save(key)
+	if err != nil {
+		delete(cs.channels, key)
+	}
+	return err
+}
+
+func (cs *ChannelRegistrationStore) get(name string) (registeredChannel, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	rc, ok := cs.channels[strings.ToLower(name)]
+	if !ok {
+		return registeredChannel{}, false
+	}
+	return rc.clone(), true
+}
+
+func (cs *ChannelRegistrationStore) update(name string, fn func(rc *registeredChannel)) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := strings.ToLower(name)
+	rc, ok := cs.channels[key]
+	if !ok {
+		return errorChannelNotRegistered
+	}
+	updated := rc.clone()
+	fn(&updated)
+	cs.channels[key] = &updated
+
+	err := cs.save(key)
+	if err != nil {
+		cs.channels[key] = rc
+	}
+	return err
+}
+
+func (cs *ChannelRegistrationStore) drop(name string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := strings.ToLower(name)
+	rc, ok := cs.channels[key]
+	if !ok {
+		return errorChannelNotRegistered
+	}
+	delete(cs.channels, key)
+
+	err := cs.save(key)
+	if err != nil {
+		cs.channels[key] = rc
+	}
+	return err
+}
+
+func (rc registeredChannel) clone() registeredChannel {
+	c := rc
+	c.Access = make(map[string]string, len(rc.Access))
+	for k, v := range rc.Access {
+		c.Access[k] = v
+	}
+	c.Lists = make(map[string][]listEntry, len(rc.Lists))
+	for k, v := range rc.Lists {
+		c.Lists[k] = slices.Clone(v)
+	}
+	return c
+}
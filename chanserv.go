@@ -0,0 +1,396 @@
+package ircd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const defaultChannelServiceNick = "ChanServ"
+
+// Access levels from lowest to highest.
+const accessLevels = "vhoaq"
+
+// Channel registration service, a virtual client that handles commands sent
+// to it with PRIVMSG.
+type chanServ struct {
+	s   *Server
+	bot *VirtualClient
+}
+
+func newChanServ(s *Server, config AccountConfig) (*chanServ, error) {
+	nick := config.ChannelServiceNick
+	if nick == "" {
+		nick = defaultChannelServiceNick
+	}
+
+	cs := &chanServ{s: s}
+	bot, err := s.NewVirtualClient(VirtualClientConfig{
+		Nickname: nick,
+		Username: strings.ToLower(nick),
+		Realname: "Channel Service",
+		Deliver:  cs.deliver,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cs.bot = bot
+	return cs, nil
+}
+
+// Handles a line sent to the service.
+func (cs *chanServ) deliver(line string) {
+	m, err := parseMessage(line)
+	if err != nil || m.command != "PRIVMSG" || len(m.params) < 2 {
+		return
+	}
+	nick, _, _ := strings.Cut(m.prefix, "!")
+	c, ok := cs.s.clients.get(nick)
+	if !ok {
+		return
+	}
+
+	fields := strings.Fields(m.params[1])
+	if len(fields) == 0 {
+		return
+	}
+	command := strings.ToUpper(fields[0])
+	if command == "HELP" {
+		cs.help(c)
+		return
+	}
+	if len(fields) < 2 {
+		cs.notice(c, fmt.Sprintf("Syntax: %s <channel>, see HELP.", command))
+		return
+	}
+	args := fields[2:]
+
+	switch command {
+	case "REGISTER":
+		cs.register(c, fields[1])
+	case "ACCESS":
+		cs.access(c, fields[1], args)
+	case "SET":
+		cs.set(c, fields[1], args)
+	case "DROP":
+		cs.drop(c, fields[1])
+	case "INFO":
+		cs.info(c, fields[1])
+	default:
+		cs.notice(c, fmt.Sprintf("Unknown command %s, see HELP.", command))
+	}
+}
+
+func (cs *chanServ) notice(c clienter, text string) {
+	cs.bot.Notice(c.nickname(), text)
+}
+
+func (cs *chanServ) help(c clienter) {
+	for _, line := range []string{
+		"REGISTER <channel>: registers a channel you are an operator on",
+		"ACCESS <channel> LIST|ADD <account> <level>|DEL <account>: manages automatic modes, levels are q, a, o, h and v",
+		"SET <channel> FOUNDER <account>: transfers the channel to another account",
+		"DROP <channel>: removes the registration",
+		"INFO <channel>: shows the registration",
+	} {
+		cs.notice(c, line)
+	}
+}
+
+func (cs *chanServ) register(c clienter, name string) {
+	if c.account() == "" {
+		cs.notice(c, "You have to be logged in to register channels.")
+		return
+	}
+	ch, exists := cs.s.channels.get(name)
+	if !exists || !ch.clients().hasMode(c, modeMemberOperator, modeMemberAdmin, modeMemberOwner) {
+		cs.notice(c, fmt.Sprintf("You have to be an operator on %s to register it.", name))
+		return
+	}
+
+	err := cs.s.registrations.register(ch.name(), c.account(), cs.s.now())
+	switch err {
+	case nil:
+	case errorChannelRegistered:
+		cs.notice(c, fmt.Sprintf("%s is already registered.", ch.name()))
+		return
+	default:
+		cs.s.log.Error().Err(err).Msgf("cant register channel %s", ch.name())
+		cs.notice(c, "Registration failed, try again later.")
+		return
+	}
+
+	cs.notice(c, fmt.Sprintf("%s is now registered to %s.", ch.name(), c.account()))
+	cs.setMode(ch, "+r")
+	cs.save(ch)
+	cs.automode(ch, c)
+}
+
+func (cs *chanServ) access(c clienter, name string, args []string) {
+	rc, ok := cs.s.registrations.get(name)
+	if !ok {
+		cs.notice(c, fmt.Sprintf("%s is not registered.", name))
+		return
+	}
+	own := rc.level(c.account())
+	if own != "q" && own != "a" {
+		cs.notice(c, fmt.Sprintf("You are not allowed to change access on %s.", rc.Name))
+		return
+	}
+	if len(args) == 0 {
+		cs.notice(c, "Syntax: ACCESS <channel> LIST|ADD <account> <level>|DEL <account>")
+		return
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "LIST":
+		cs.notice(c, fmt.Sprintf("%s q (founder)", rc.Founder))
+		for account, level := range rc.Access {
+			cs.notice(c, fmt.Sprintf("%s %s", account, level))
+		}
+		cs.notice(c, fmt.Sprintf("End of %s access list.", rc.Name))
+	case "ADD":
+		if len(args) < 3 || len(args[2]) != 1 || !strings.Contains(accessLevels, args[2]) {
+			cs.notice(c, "Syntax: ACCESS <channel> ADD <account> <q|a|o|h|v>")
+			return
+		}
+		level := args[2]
+		// only founders can grant their own level
+		if own != "q" && strings.Index(accessLevels, level) >= strings.Index(accessLevels, own) {
+			cs.notice(c, fmt.Sprintf("You can not grant %s on %s.", level, rc.Name))
+			return
+		}
+		account, exists := cs.s.accounts.owner(args[1])
+		if !exists || !strings.EqualFold(account, args[1]) {
+			cs.notice(c, fmt.Sprintf("Account %s does not exist.", args[1]))
+			return
+		}
+		err := cs.s.registrations.update(rc.Name, func(rc *registeredChannel) {
+			rc.Access[strings.ToLower(account)] = level
+		})
+		if err != nil {
+			cs.s.log.Error().Err(err).Msgf("cant change access on %s", rc.Name)
+			cs.notice(c, "Changing access failed, try again later.")
+			return
+		}
+		cs.notice(c, fmt.Sprintf("%s now has %s on %s.", account, level, rc.Name))
+
+		if ch, exists := cs.s.channels.get(rc.Name); exists {
+			for _, member := range ch.clients().all() {
+				if strings.EqualFold(member.account(), account) {
+					cs.automode(ch, member)
+				}
+			}
+		}
+	case "DEL":
+		if len(args) < 2 {
+			cs.notice(c, "Syntax: ACCESS <channel> DEL <account>")
+			return
+		}
+		key := strings.ToLower(args[1])
+		level, exists := rc.Access[key]
+		if !exists {
+			cs.notice(c, fmt.Sprintf("%s is not on the %s access list.", args[1], rc.Name))
+			return
+		}
+		if own != "q" && strings.Index(accessLevels, level) >= strings.Index(accessLevels, own) {
+			cs.notice(c, fmt.Sprintf("You can not remove %s from %s.", args[1], rc.Name))
+			return
+		}
+		err := cs.s.registrations.update(rc.Name, func(rc *registeredChannel) {
+			delete(rc.Access, key)
+		})
+		if err != nil {
+			cs.s.log.Error().Err(err).Msgf("cant change access on %s", rc.Name)
+			cs.notice(c, "Changing access failed, try again later.")
+			return
+		}
+		cs.notice(c, fmt.Sprintf("%s was removed from the %s access list.", args[1], rc.Name))
+	default:
+		cs.notice(c, "Syntax: ACCESS <channel> LIST|ADD <account> <level>|DEL <account>")
+	}
+}
+
+func (cs *chanServ) set(c clienter, name string, args []string) {
+	rc, ok := cs.s.registrations.get(name)
+	if !ok {
+		cs.notice(c, fmt.Sprintf("%s is not registered.", name))
+		return
+	}
+	if len(args) < 2 || strings.ToUpper(args[0]) != "FOUNDER" {
+		cs.notice(c, "Syntax: SET <channel> FOUNDER <account>")
+		return
+	}
+	if !strings.EqualFold(rc.Founder, c.account()) {
+		cs.notice(c, fmt.Sprintf("Only the founder can transfer %s.", rc.Name))
+		return
+	}
+	account, exists := cs.s.accounts.owner(args[1])
+	if !exists || !strings.EqualFold(account, args[1]) {
+		cs.notice(c, fmt.Sprintf("Account %s does not exist.", args[1]))
+		return
+	}
+
+	err := cs.s.registrations.update(rc.Name, func(rc *registeredChannel) {
+		rc.Founder = account
+		delete(rc.Access, strings.ToLower(account))
+	})
+	if err != nil {
+		cs.s.log.Error().Err(err).Msgf("cant transfer %s", rc.Name)
+		cs.notice(c, "Transfer failed, try again later.")
+		return
+	}
+	cs.notice(c, fmt.Sprintf("%s is now founded by %s.", rc.Name, account))
+}
+
+func (cs *chanServ) drop(c clienter, name string) {
+	rc, ok := cs.s.registrations.get(name)
+	if !ok {
+		cs.notice(c, fmt.Sprintf("%s is not registered.", name))
+		return
+	}
+	if !strings.EqualFold(rc.Founder, c.account()) {
+		cs.notice(c, fmt.Sprintf("Only the founder can drop %s.", rc.Name))
+		return
+	}
+
+	err := cs.s.registrations.drop(rc.Name)
+	if err != nil {
+		cs.s.log.Error().Err(err).Msgf("cant drop %s", rc.Name)
+		cs.notice(c, "Dropping failed, try again later.")
+		return
+	}
+	cs.notice(c, fmt.Sprintf("%s has been dropped.", rc.Name))
+	if ch, exists := cs.s.channels.get(rc.Name); exists {
+		cs.setMode(ch, "-r")
+	}
+}
+
+func (cs *chanServ) info(c clienter, name string) {
+	rc, ok := cs.s.registrations.get(name)
+	if !ok {
+		cs.notice(c, fmt.Sprintf("%s is not registered.", name))
+		return
+	}
+	cs.notice(c, fmt.Sprintf("%s is registered to %s since %s.", rc.Name, rc.Founder, rc.Registered.UTC().Format(time.RFC1123)))
+	cs.notice(c, fmt.Sprintf("%d account(s) on the access list.", len(rc.Access)))
+}
+
+// Sets +r or -r on ch.
+func (cs *chanServ) setMode(ch channeler, modestring string) {
+	if modestring == "+r" {
+		ch.addMode(modeChannelRegistered)
+	} else {
+		ch.removeMode(modeChannelRegistered)
+	}
+	ch.broadcastCommand(modeCommand{
+		source:     cs.bot.c.prefix(),
+		target:     ch.name(),
+		modestring: modestring,
+	}, cs.bot.c.id(), false)
+}
+
+// Gives c the membership mode of its access level on ch.
+func (cs *chanServ) automode(ch channeler, c clienter) {
+	rc, ok := cs.s.registrations.get(ch.name())
+	if !ok {
+		return
+	}
+	level := rc.level(c.account())
+	if level == "" {
+		return
+	}
+	mode := channelMembershipModeMap[rune(level[0])]
+	if ch.clients().hasMode(c, mode) {
+		return
+	}
+	ch.clients().addMode(c, mode)
+	ch.broadcastCommand(modeCommand{
+		source:     cs.bot.c.prefix(),
+		target:     ch.name(),
+		modestring: "+" + level,
+		args:       c.nickname(),
+	}, cs.bot.c.id(), false)
+}
+
+// Is channel name registered?
+func (cs *chanServ) registered(name string) bool {
+	_, ok := cs.s.registrations.get(name)
+	return ok
+}
+
+// Saves topic, modes, key, limit, forward and list modes of a registered
+// channel.
+func (cs *chanServ) save(ch channeler) {
+	if !cs.registered(ch.name()) {
+		return
+	}
+
+	modes := strings.TrimPrefix(ch.modestring(), "+")
+	lists := make(map[string][]listEntry)
+	for mode, kind := range cs.s.channelModes {
+		if kind == channelModeTypeList {
+			lists[string(mode)] = ch.listEntries(mode)
+		}
+	}
+	t := ch.topic()
+
+	err := cs.s.registrations.update(ch.name(), func(rc *registeredChannel) {
+		rc.Topic = t.text
+		rc.TopicAuthor = t.author
+		rc.TopicTime = t.timestamp
+		rc.Modes = modes
+		rc.Key = ch.key()
+		rc.Limit = ch.limit()
+		rc.Forward = ch.forward()
+		rc.Lists = lists
+	})
+	if err != nil {
+		cs.s.log.Error().Err(err).Msgf("cant save settings of %s", ch.name())
+	}
+}
+
+// Restores the saved settings of a registered channel that was created
+// again.
+func (cs *chanServ) restore(ch channeler) {
+	rc, ok := cs.s.registrations.get(ch.name())
+	if !ok {
+		return
+	}
+
+	if rc.Modes != "" {
+		for _, mode := range channelModeMap {
+			ch.removeMode(mode)
+		}
+		for _, r := range rc.Modes {
+			if mode, ok := channelModeMap[r]; ok {
+				ch.addMode(mode)
+			}
+		}
+	}
+	ch.addMode(modeChannelRegistered)
+	if rc.Key != "" {
+		ch.setKey(rc.Key)
+	}
+	if rc.Limit > 0 {
+		ch.setLimit(rc.Limit)
+	}
+	if rc.Forward != "" {
+		ch.setForward(rc.Forward)
+	}
+	if rc.Topic != "" {
+		ch.setTopic(rc.Topic, rc.TopicAuthor, time.Unix(int64(rc.TopicTime), 0))
+	}
+	for mode, kind := range cs.s.channelModes {
+		if kind != channelModeTypeList {
+			continue
+		}
+		for _, entry := range rc.Lists[string(mode)] {
+			if entry.expired(cs.s.now()) {
+				continue
+			}
+			ch.addListEntry(mode, entry)
+			cs.s.scheduleListExpiry(ch, mode, entry)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package ircd
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChanServ(t *testing.T) {
+	s := newAccountServer()
+	for _, account := range []string{"founder", "helper"} {
+		err := s.accounts.register(account, "secret1", "", s.now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newMockClient(true)
+	c.nick = "founder"
+	c.acct = "founder"
+	s.clients.add(c)
+
+	handleJoin(s, c, message{command: "JOIN", params: []string{"#test"}})
+	ch, _ := s.channels.get("#test")
+
+	type tc struct {
+		text string
+		want []string
+	}
+
+	tcs := []tc{
+		{
+			text: "REGISTER #test",
+			want: []string{
+				":ChanServ!chanserv@server NOTICE founder :#test is now registered to founder.",
+				":ChanServ!chanserv@server MODE #test +r",
+			},
+		},
+		{
+			text: "ACCESS #test ADD nobody o",
+			want: []string{
+				":ChanServ!chanserv@server NOTICE founder :Account nobody does not exist.",
+			},
+		},
+		{
+			text: "ACCESS #test ADD helper o",
+			want: []string{
+				":ChanServ!chanserv@server NOTICE founder :helper now has o on #test.",
+			},
+		},
+		{
+			text: "DROP #other",
+			want: []string{
+				":ChanServ!chanserv@server NOTICE founder :#other is not registered.",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		c.reset()
+		s.chanserv.deliver(":founder PRIVMSG ChanServ :" + tc.text)
+		if slices.Compare(c.messagesOut, tc.want) != 0 {
+			t.Errorf("%s: got %v, want %v", tc.text, c.messagesOut, tc.want)
+		}
+	}
+	if !ch.hasMode(modeChannelRegistered) {
+		t.Error("registered channel does not have +r")
+	}
+
+	// helper gets +o on join
+	helper := newMockClient(true)
+	helper.clientID = "54321"
+	helper.nick = "helper"
+	helper.acct = "helper"
+	s.clients.add(helper)
+	handleJoin(s, helper, message{command: "JOIN", params: []string{"#test"}})
+	if !ch.clients().hasMode(helper, modeMemberOperator) {
+		t.Error("helper did not get +o")
+	}
+
+	// helper can not transfer the channel
+	helper.reset()
+	s.chanserv.deliver(":helper PRIVMSG ChanServ :SET #test FOUNDER helper")
+	want := []string{":ChanServ!chanserv@server NOTICE helper :Only the founder can transfer #test."}
+	if slices.Compare(helper.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", helper.messagesOut, want)
+	}
+
+	c.reset()
+	s.chanserv.deliver(":founder PRIVMSG ChanServ :SET #test FOUNDER helper")
+	rc, _ := s.registrations.get("#test")
+	if rc.Founder != "helper" {
+		t.Errorf("got founder %s, want helper", rc.Founder)
+	}
+}
+
+func TestChanServRestore(t *testing.T) {
+	s := newAccountServer()
+	err := s.registrations.register("#test", "founder", s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newMockClient(true)
+	c.acct = "founder"
+	s.clients.add(c)
+
+	handleJoin(s, c, message{command: "JOIN", params: []string{"#test"}})
+	ch, _ := s.channels.get("#test")
+	if !ch.clients().hasMode(c, modeMemberOwner) {
+		t.Error("founder did not get +q")
+	}
+
+	handleTopic(s, c, message{command: "TOPIC", params: []string{"#test", "saved"}})
+	handleMode(s, c, message{command: "MODE", params: []string{"#test", "+m"}})
+
+	// channel is created again after everyone left
+	handlePart(s, c, message{command: "PART", params: []string{"#test"}})
+	other := newMockClient(true)
+	other.clientID = "54321"
+	other.nick = "other"
+	s.clients.add(other)
+	handleJoin(s, other, message{command: "JOIN", params: []string{"#test"}})
+
+	ch, _ = s.channels.get("#test")
+	if ch.topic().text != "saved" {
+		t.Errorf("got topic %q, want saved", ch.topic().text)
+	}
+	if ch.modestring() != "+mnrt" {
+		t.Errorf("got modes %s, want +mnrt", ch.modestring())
+	}
+	if ch.clients().hasMode(other, modeMemberOwner) {
+		t.Error("first client on registered channel got +q")
+	}
+}
+
+func TestChannelRegistrationStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := OpenChannelRegistrationStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cs.register("#Test", "founder", time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.register("#test", "other", time.Now()); err != errorChannelRegistered {
+		t.Errorf("got %v, want %v", err, errorChannelRegistered)
+	}
+	err = cs.update("#test", func(rc *registeredChannel) {
+		rc.Access["helper"] = "v"
+		rc.Key = "secret"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err = OpenChannelRegistrationStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, ok := cs.get("#TEST")
+	if !ok {
+		t.Fatal("registration was not saved")
+	}
+	if rc.level("Founder") != "q" || rc.level("helper") != "v" || rc.Key != "secret" {
+		t.Errorf("unexpected registration %+v", rc)
+	}
+
+	if err := cs.drop("#test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cs.get("#test"); ok {
+		t.Error("dropped channel is still registered")
+	}
+}
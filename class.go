@@ -0,0 +1,236 @@
+package ircd
+
+import (
+	"crypto/subtle"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultPingFrequency  = 30
+	defaultPongMaxLatency = 10
+)
+
+// Connection class (allow block).
+//
+// A client has to match every criterion that is set, and any of the values
+// within a criterion. Classes are tried in order and clients that do not
+// match any class are assigned to the default class built from ServerConfig.
+type ConnectionClass struct {
+	Name string
+
+	// IP addresses or CIDR ranges.
+	CIDRs []string
+	// Hostname masks (e.g. *.example.com), matched against the real hostname.
+	Hostmasks []string
+	// Require TLS.
+	TLS bool
+	// SHA-256 fingerprints of TLS client certificates.
+	CertFPs []string
+
+	// Maximum number of clients in class, 0 is unlimited.
+	MaxClients int
+	// Seconds between PINGs.
+	PingFrequency int
+	// Seconds to wait for PONG.
+	PongMaxLatency int
+	// Maximum number of bytes queued for a client.
+	SendQ int
+	// Flood control, unset values use defaults.
+	Flood FloodConfig
+	// Password required to register.
+	Password string
+	// Message of the day, server MOTD is used if empty.
+	MOTD []string
+}
+
+type connectionClass struct {
+	mu *sync.Mutex
+
+	name      string
+	networks  []*net.IPNet
+	hostmasks [][]byte
+	tls       bool
+	certfps   []string
+
+	maxClients     int
+	pingFrequency  int
+	pongMaxLatency int
+	sendq          int
+	flood          FloodConfig
+	password       string
+	motd           []string
+
+	// Number of registered clients in class.
+	clients int
+}
+
+func newConnectionClass(config ConnectionClass, logger zerolog.Logger) *connectionClass {
+	class := &connectionClass{
+		mu:             &sync.Mutex{},
+		name:           config.Name,
+		networks:       []*net.IPNet{},
+		hostmasks:      [][]byte{},
+		tls:            config.TLS,
+		certfps:        []string{},
+		maxClients:     config.MaxClients,
+		pingFrequency:  config.PingFrequency,
+		pongMaxLatency: config.PongMaxLatency,
+		sendq:          config.SendQ,
+		flood:          config.Flood.withDefaults(),
+		password:       config.Password,
+		motd:           config.MOTD,
+	}
+
+	if class.pingFrequency <= 0 {
+		class.pingFrequency = defaultPingFrequency
+	}
+	if class.pongMaxLatency <= 0 {
+		class.pongMaxLatency = defaultPongMaxLatency
+	}
+	if class.sendq <= 0 {
+		class.sendq = defaultSendQ
+	}
+
+	for _, cidr := range config.CIDRs {
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr = cidr + "/128"
+			} else {
+				cidr = cidr + "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logger.Error().Err(err).Msgf("invalid address %s in class %s", cidr, config.Name)
+			continue
+		}
+		class.networks = append(class.networks, network)
+	}
+
+	for _, hostmask := range config.Hostmasks {
+		mask, err := parseMask(strings.ToLower(hostmask))
+		if err != nil {
+			logger.Error().Err(err).Msgf("invalid hostmask %s in class %s", hostmask, config.Name)
+			continue
+		}
+		class.hostmasks = append(class.hostmasks, mask)
+	}
+
+	for _, fp := range config.CertFPs {
+		class.certfps = append(class.certfps, normalizeFingerprint(fp))
+	}
+
+	return class
+}
+
+// Does client match the class?
+func (cl *connectionClass) match(c clienter) bool {
+	if cl.tls && !c.tls() {
+		return false
+	}
+
+	if len(cl.networks) > 0 {
+		ip := net.ParseIP(c.ip())
+		if ip == nil {
+			return false
+		}
+		found := false
+		for _, network := range cl.networks {
+			if network.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(cl.hostmasks) > 0 {
+		hostname := strings.ToLower(c.realhost())
+		found := false
+		for _, mask := range cl.hostmasks {
+			if len(mask) > 0 && matchMask(mask, hostname) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(cl.certfps) > 0 {
+		certfp := c.certfp()
+		if certfp == "" {
+			return false
+		}
+		found := false
+		for _, fp := range cl.certfps {
+			if subtle.ConstantTimeCompare([]byte(fp), []byte(certfp)) == 1 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Is password correct for the class?
+func (cl *connectionClass) authenticate(password string) bool {
+	if cl.password == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(cl.password), []byte(password)) == 1
+}
+
+// Adds a client to the class, returns false if the class is full.
+func (cl *connectionClass) join() bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.maxClients > 0 && cl.clients >= cl.maxClients {
+		return false
+	}
+	cl.clients++
+	return true
+}
+
+// Adds a client to the class even if it is full, used for clients that were
+// already counted by a previous process.
+func (cl *connectionClass) add() {
+	cl.mu.Lock()
+	cl.clients++
+	cl.mu.Unlock()
+}
+
+// Removes a client from the class.
+func (cl *connectionClass) leave() {
+	cl.mu.Lock()
+	if cl.clients > 0 {
+		cl.clients--
+	}
+	cl.mu.Unlock()
+}
+
+// Returns the first class matching c or the default class.
+func (s *Server) matchClass(c clienter) *connectionClass {
+	for _, class := range s.classes {
+		if class.match(c) {
+			return class
+		}
+	}
+	return s.defaultClass
+}
+
+// Lowercase hex without separators.
+func normalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
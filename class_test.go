@@ -0,0 +1,161 @@
+package ircd
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestConnectionClassMatch(t *testing.T) {
+	type testCase struct {
+		name   string
+		config ConnectionClass
+		ip     string
+		host   string
+		tls    bool
+		certfp string
+		want   bool
+	}
+
+	tcs := []testCase{
+		{
+			name:   "empty class matches everyone",
+			config: ConnectionClass{},
+			ip:     "192.0.2.1",
+			host:   "client.example.com",
+			want:   true,
+		},
+		{
+			name:   "cidr match",
+			config: ConnectionClass{CIDRs: []string{"192.0.2.0/24"}},
+			ip:     "192.0.2.1",
+			want:   true,
+		},
+		{
+			name:   "cidr mismatch",
+			config: ConnectionClass{CIDRs: []string{"192.0.2.0/24"}},
+			ip:     "198.51.100.1",
+			want:   false,
+		},
+		{
+			name:   "single address",
+			config: ConnectionClass{CIDRs: []string{"2001:db8::1"}},
+			ip:     "2001:db8::1",
+			want:   true,
+		},
+		{
+			name:   "hostmask match",
+			config: ConnectionClass{Hostmasks: []string{"*.Example.com"}},
+			ip:     "192.0.2.1",
+			host:   "client.example.com",
+			want:   true,
+		},
+		{
+			name:   "hostmask mismatch",
+			config: ConnectionClass{Hostmasks: []string{"*.example.com"}},
+			ip:     "192.0.2.1",
+			host:   "client.example.org",
+			want:   false,
+		},
+		{
+			name:   "tls required",
+			config: ConnectionClass{TLS: true},
+			ip:     "192.0.2.1",
+			tls:    false,
+			want:   false,
+		},
+		{
+			name:   "certfp match",
+			config: ConnectionClass{CertFPs: []string{"AB:CD:EF"}},
+			ip:     "192.0.2.1",
+			tls:    true,
+			certfp: "abcdef",
+			want:   true,
+		},
+		{
+			name:   "certfp missing",
+			config: ConnectionClass{CertFPs: []string{"abcdef"}},
+			ip:     "192.0.2.1",
+			tls:    true,
+			want:   false,
+		},
+		{
+			name: "all criteria must match",
+			config: ConnectionClass{
+				CIDRs: []string{"192.0.2.0/24"},
+				TLS:   true,
+			},
+			ip:   "192.0.2.1",
+			tls:  false,
+			want: false,
+		},
+	}
+
+	for _, tc := range tcs {
+		c := newMockClient(false)
+		c.addr = tc.ip
+		c.rhost = tc.host
+		c.secure = tc.tls
+		c.fp = tc.certfp
+
+		class := newConnectionClass(tc.config, zerolog.Nop())
+		if got := class.match(c); got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConnectionClassOrder(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+		Classes: []ConnectionClass{
+			{Name: "local", CIDRs: []string{"127.0.0.0/8"}},
+			{Name: "everyone"},
+		},
+	})
+
+	c := newMockClient(false)
+	c.addr = "127.0.0.1"
+	if got := s.matchClass(c).name; got != "local" {
+		t.Errorf("got class %s, want local", got)
+	}
+
+	c.addr = "192.0.2.1"
+	if got := s.matchClass(c).name; got != "everyone" {
+		t.Errorf("got class %s, want everyone", got)
+	}
+
+	s = NewServer(ServerConfig{Name: "server"})
+	if got := s.matchClass(c).name; got != "default" {
+		t.Errorf("got class %s, want default", got)
+	}
+}
+
+func TestConnectionClassLimits(t *testing.T) {
+	class := newConnectionClass(ConnectionClass{
+		MaxClients: 1,
+		Password:   "secret",
+	}, zerolog.Nop())
+
+	if class.authenticate("wrong") {
+		t.Errorf("wrong password accepted")
+	}
+	if !class.authenticate("secret") {
+		t.Errorf("correct password rejected")
+	}
+
+	if !class.join() {
+		t.Fatalf("first client rejected")
+	}
+	if class.join() {
+		t.Errorf("client over limit accepted")
+	}
+	class.leave()
+	if !class.join() {
+		t.Errorf("client rejected after leave")
+	}
+
+	if class.pingFrequency != defaultPingFrequency || class.sendq != defaultSendQ {
+		t.Errorf("defaults not applied")
+	}
+}
@@ -1,14 +1,20 @@
 package ircd
 
 import (
+	"bufio"
 	"cmp"
 	"fmt"
 	"net"
-	"os"
 	"slices"
 	"sync"
+	"time"
+
+	"github.com/salimnassim/ircd/metrics"
 )
 
+// Maximum length of an incoming line.
+const inputBufferSize = 16 * 1024
+
 type clienter interface {
 	String() string
 
@@ -25,6 +31,11 @@ type clienter interface {
 	// Get client username.
 	username() string
 
+	// Get username verified by ident.
+	ident() string
+	// Set username verified by ident.
+	setIdent(ident string)
+
 	// Get client realname.
 	realname() string
 	// Set client username.
@@ -35,6 +46,11 @@ type clienter interface {
 	// Set client hostname.
 	setHostname(hostname string)
 
+	// Get client real hostname, visible only to operators.
+	realhost() string
+	// Set client real hostname.
+	setRealhost(hostname string)
+
 	// Is client using TLS?
 	tls() bool
 	// Set client TLS.
@@ -45,15 +61,31 @@ type clienter interface {
 	// Set client away message.
 	setAway(text string)
 
+	// Closed when connection lookups have finished.
+	lookups() <-chan struct{}
+
 	// Get user handshake status.
 	handshake() bool
 	// Set user handshake status.
 	setHandshake(handshake bool)
 
-	// Did client send the correct password?
-	password() bool
-	// Set if password was correct.
-	setPassword(correct bool)
+	// Get password sent by client.
+	password() string
+	// Set password sent by client.
+	setPassword(password string)
+
+	// Get TLS client certificate fingerprint.
+	certfp() string
+
+	// Get name of the account the client is logged in to.
+	account() string
+	// Set account, empty if logged out.
+	setAccount(account string)
+
+	// Get client connection class.
+	class() *connectionClass
+	// Set client connection class.
+	setClass(class *connectionClass)
 
 	// Get client prefix.
 	prefix() string
@@ -77,6 +109,17 @@ type clienter interface {
 	// Set quit reason.
 	setQuitreason(reason string)
 
+	// Has client negotiated capability?
+	hasCapability(capability string) bool
+	// Enable or disable capability.
+	setCapability(capability string, enabled bool)
+	// Get negotiated capabilities.
+	capabilities() []string
+	// Is capability negotiation in progress?
+	negotiating() bool
+	// Set capability negotiation status.
+	setNegotiating(negotiating bool)
+
 	// Send message.
 	send(text string)
 	// Send pong to internal channel.
@@ -92,8 +135,10 @@ type client struct {
 	address  string
 	nick     string
 	user     string
+	identity string
 	real     string
 	host     string
+	rhost    string
 	modes    clientMode
 	// TLS?
 	secure bool
@@ -103,19 +148,54 @@ type client struct {
 
 	// Handshake done?
 	hs bool
-	// Is sent password correct?
-	pw bool
+	// Password sent by client.
+	pw string
+	// TLS client certificate fingerprint.
+	fp string
+	// Account name.
+	acct string
+	// Connection class.
+	cls *connectionClass
 	// Quit reason
 	q string
 
-	conn   net.Conn
-	in     chan string
-	out    chan string
-	ponged chan bool
-
-	killIn   chan bool
-	killOut  chan bool
-	killPong chan bool
+	// Negotiated capabilities.
+	caps map[string]bool
+	// Is capability negotiation in progress?
+	capNeg bool
+
+	// Closed when hostname lookup is done.
+	lookupDone chan struct{}
+
+	conn net.Conn
+	// Buffered reader for conn.
+	reader *bufio.Reader
+	// Bytes of a line that has not been fully read.
+	partial []byte
+	// Set when the connection is handed over to another process.
+	detached bool
+	// Closed when the connection goroutines have stopped after detach.
+	stopped chan struct{}
+	in      chan queuedMessage
+	sendq   *sendQueue
+	ponged  chan bool
+
+	// Flood control for incoming messages.
+	flood *floodControl
+
+	// Has kill been called?
+	killed      bool
+	killIn      chan bool
+	killOut     chan bool
+	killPong    chan bool
+	killProcess chan bool
+}
+
+// Message waiting to be processed.
+type queuedMessage struct {
+	message message
+	// Earliest time the message can be processed.
+	at time.Time
 }
 
 func newClient(connection net.Conn, id string) (*client, error) {
@@ -136,7 +216,7 @@ func newClient(connection net.Conn, id string) (*client, error) {
 		return nil, errorConnectionLocalAddressNil
 	}
 
-	_, port, err := net.SplitHostPort(connection.LocalAddr().String())
+	_, _, err = net.SplitHostPort(connection.LocalAddr().String())
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +229,7 @@ func newClient(connection net.Conn, id string) (*client, error) {
 		user:     "",
 		real:     "",
 		host:     "",
+		rhost:    "",
 		modes:    0,
 		secure:   false,
 		afk:      "",
@@ -156,19 +237,23 @@ func newClient(connection net.Conn, id string) (*client, error) {
 
 		hs: false,
 
-		conn: connection,
+		caps: make(map[string]bool),
+
+		lookupDone: make(chan struct{}),
 
-		in:     make(chan string, 1),
-		out:    make(chan string, 1),
+		conn:   connection,
+		reader: bufio.NewReaderSize(connection, inputBufferSize),
+
+		in:     make(chan queuedMessage, 64),
+		sendq:  newSendQueue(defaultSendQ),
 		ponged: make(chan bool, 1),
 
-		killIn:   make(chan bool, 1),
-		killOut:  make(chan bool, 1),
-		killPong: make(chan bool, 1),
-	}
+		flood: newFloodControl(FloodConfig{}),
 
-	if port == os.Getenv("PORT_TLS") {
-		client.secure = true
+		killIn:      make(chan bool, 1),
+		killOut:     make(chan bool, 1),
+		killPong:    make(chan bool, 1),
+		killProcess: make(chan bool, 1),
 	}
 
 	return client, nil
@@ -213,6 +298,18 @@ func (c *client) username() string {
 	return c.user
 }
 
+func (c *client) ident() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.identity
+}
+
+func (c *client) setIdent(ident string) {
+	c.mu.Lock()
+	c.identity = ident
+	c.mu.Unlock()
+}
+
 func (c *client) realname() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -238,6 +335,18 @@ func (c *client) setHostname(hostname string) {
 	c.mu.Unlock()
 }
 
+func (c *client) realhost() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rhost
+}
+
+func (c *client) setRealhost(hostname string) {
+	c.mu.Lock()
+	c.rhost = hostname
+	c.mu.Unlock()
+}
+
 func (c *client) tls() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -246,7 +355,7 @@ func (c *client) tls() bool {
 
 func (c *client) setTLS(tls bool) {
 	c.mu.Lock()
-	c.secure = true
+	c.secure = tls
 	c.mu.Unlock()
 }
 
@@ -262,6 +371,10 @@ func (c *client) setAway(text string) {
 	c.mu.Unlock()
 }
 
+func (c *client) lookups() <-chan struct{} {
+	return c.lookupDone
+}
+
 func (c *client) handshake() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -274,18 +387,51 @@ func (c *client) setHandshake(handshake bool) {
 	c.mu.Unlock()
 }
 
-func (c *client) password() bool {
+func (c *client) password() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.pw
 }
 
-func (c *client) setPassword(correct bool) {
+func (c *client) setPassword(password string) {
 	c.mu.Lock()
-	c.pw = correct
+	c.pw = password
 	c.mu.Unlock()
 }
 
+func (c *client) certfp() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.fp
+}
+
+func (c *client) account() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.acct
+}
+
+func (c *client) setAccount(account string) {
+	c.mu.Lock()
+	c.acct = account
+	c.mu.Unlock()
+}
+
+func (c *client) class() *connectionClass {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cls
+}
+
+func (c *client) setClass(class *connectionClass) {
+	c.mu.Lock()
+	c.cls = class
+	c.mu.Unlock()
+
+	c.sendq.setLimit(class.sendq)
+	c.flood.setConfig(class.flood)
+}
+
 func (c *client) prefix() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -330,11 +476,11 @@ func (c *client) hasMode(mode clientMode) bool {
 }
 
 func (c *client) sendRPL(server string, rpl rpl) {
-	c.out <- fmt.Sprintf(":%s %s", server, rpl.rpl())
+	c.send(fmt.Sprintf(":%s %s", server, rpl.rpl()))
 }
 
 func (c *client) sendCommand(cmd command) {
-	c.out <- cmd.command()
+	c.send(cmd.command())
 }
 
 func (c *client) quitReason() string {
@@ -349,20 +495,134 @@ func (c *client) setQuitreason(reason string) {
 	c.mu.Unlock()
 }
 
+func (c *client) hasCapability(capability string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.caps[capability]
+}
+
+func (c *client) setCapability(capability string, enabled bool) {
+	c.mu.Lock()
+	if enabled {
+		c.caps[capability] = true
+	} else {
+		delete(c.caps, capability)
+	}
+	c.mu.Unlock()
+}
+
+func (c *client) capabilities() []string {
+	c.mu.RLock()
+	caps := []string{}
+	for capability := range c.caps {
+		caps = append(caps, capability)
+	}
+	c.mu.RUnlock()
+	slices.Sort(caps)
+	return caps
+}
+
+func (c *client) negotiating() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.capNeg
+}
+
+func (c *client) setNegotiating(negotiating bool) {
+	c.mu.Lock()
+	c.capNeg = negotiating
+	c.mu.Unlock()
+}
+
 func (c *client) send(text string) {
-	c.out <- text
+	if c.sendq.push(text) {
+		return
+	}
+	// client is not reading fast enough
+	if c.quitReason() == "" {
+		metrics.SendQueueExceeded.Inc()
+		c.kill("Max SendQ exceeded")
+	}
 }
 
 func (c *client) pong(pong bool) {
 	c.ponged <- pong
 }
 
+// Is the connection being handed over to another process?
+func (c *client) isDetached() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.detached
+}
+
+// Stops the connection goroutines without closing the connection or
+// notifying anyone.
+func (c *client) detach() {
+	c.mu.Lock()
+	c.detached = true
+	c.stopped = make(chan struct{})
+	c.mu.Unlock()
+
+	// unblock the reader
+	c.conn.SetReadDeadline(time.Now())
+
+	for _, ch := range []chan bool{c.killIn, c.killOut, c.killPong, c.killProcess} {
+		select {
+		case ch <- true:
+		default:
+		}
+	}
+}
+
+// Undoes detach, the connection goroutines have to be started again.
+func (c *client) reattach() {
+	// kill signals that were not consumed
+	for _, ch := range []chan bool{c.killIn, c.killOut, c.killPong, c.killProcess} {
+		select {
+		case <-ch:
+		default:
+		}
+	}
+
+	c.conn.SetReadDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.detached = false
+	c.mu.Unlock()
+}
+
+// Has kill been called?
+func (c *client) isKilled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.killed
+}
+
 func (c *client) kill(reason string) {
-	c.setQuitreason(reason)
+	c.mu.Lock()
+	if c.killed {
+		c.mu.Unlock()
+		return
+	}
+	c.killed = true
+	c.q = reason
+	c.mu.Unlock()
+
+	// queued even if the queue is full so the client learns why it was
+	// disconnected
+	c.sendq.pushFinal(errorCommand{
+		text: fmt.Sprintf("Closing Link: %s (%s)", c.ip(), reason),
+	}.command())
+
+	// unblock a write to a client that stopped reading, the writer then
+	// makes a last attempt to deliver the queue before closing
+	c.conn.SetWriteDeadline(time.Now())
 
 	go func() {
 		c.killIn <- true
 		c.killOut <- true
 		c.killPong <- true
+		c.killProcess <- true
 	}()
 }
@@ -0,0 +1,105 @@
+package ircd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultCloakSuffix = "ip"
+
+// Keyed hostname cloaking.
+//
+// A cloak is derived only from the client IP address and the secret keys, so
+// the same address always gets the same cloak as long as the keys stay the same.
+type cloak struct {
+	keys   [][]byte
+	suffix string
+}
+
+func newCloak(keys []string, suffix string, logger zerolog.Logger) cloak {
+	ck := cloak{
+		keys:   [][]byte{},
+		suffix: suffix,
+	}
+
+	if ck.suffix == "" {
+		ck.suffix = defaultCloakSuffix
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		ck.keys = append(ck.keys, []byte(key))
+	}
+
+	// cloaks will change when the server restarts
+	if len(ck.keys) == 0 {
+		logger.Warn().Msg("no cloak keys configured, using a random key")
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			logger.Panic().Err(err).Msg("unable to generate cloak key")
+		}
+		ck.keys = append(ck.keys, key)
+	}
+
+	return ck
+}
+
+// Returns cloaked hostname for ip.
+//
+// IPv4 addresses are cloaked to <a.b.c.d>.<a.b.c>.<a.b>.suffix and IPv6
+// addresses to <128>.<64>.<48>.suffix where every segment is a keyed hash of
+// the address truncated to that subnet. Clients in the same subnet share the
+// trailing segments, so a mask such as *!*@*.<segment>.<segment>.suffix covers
+// the whole subnet.
+func (ck cloak) host(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		// not an address, hash the input as is
+		return strings.Join([]string{ck.segment(ip), ck.suffix}, ".")
+	}
+
+	var networks []*net.IPNet
+	if v4 := addr.To4(); v4 != nil {
+		for _, ones := range []int{32, 24, 16} {
+			networks = append(networks, &net.IPNet{
+				IP:   v4.Mask(net.CIDRMask(ones, 32)),
+				Mask: net.CIDRMask(ones, 32),
+			})
+		}
+	} else {
+		for _, ones := range []int{128, 64, 48} {
+			networks = append(networks, &net.IPNet{
+				IP:   addr.Mask(net.CIDRMask(ones, 128)),
+				Mask: net.CIDRMask(ones, 128),
+			})
+		}
+	}
+
+	segments := []string{}
+	for _, network := range networks {
+		segments = append(segments, ck.segment(network.String()))
+	}
+	segments = append(segments, ck.suffix)
+
+	return strings.Join(segments, ".")
+}
+
+// Hashes data with every key in order and returns the first 4 bytes as hex.
+func (ck cloak) segment(data string) string {
+	sum := []byte(data)
+	for _, key := range ck.keys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(sum)
+		sum = mac.Sum(nil)
+	}
+	return strings.ToUpper(hex.EncodeToString(sum[:4]))
+}
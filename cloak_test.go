@@ -0,0 +1,65 @@
+package ircd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCloak(t *testing.T) {
+	ck := newCloak([]string{"key1", "key2"}, "ip", zerolog.Nop())
+
+	t.Run("deterministic", func(t *testing.T) {
+		if ck.host("192.0.2.10") != ck.host("192.0.2.10") {
+			t.Errorf("same address produced different cloaks")
+		}
+	})
+
+	t.Run("different keys", func(t *testing.T) {
+		other := newCloak([]string{"key3"}, "ip", zerolog.Nop())
+		if ck.host("192.0.2.10") == other.host("192.0.2.10") {
+			t.Errorf("different keys produced the same cloak")
+		}
+	})
+
+	t.Run("does not contain address", func(t *testing.T) {
+		got := ck.host("192.0.2.10")
+		if strings.Contains(got, "192") {
+			t.Errorf("cloak %s leaks the address", got)
+		}
+		if !strings.HasSuffix(got, ".ip") {
+			t.Errorf("cloak %s is missing suffix", got)
+		}
+	})
+
+	type tc struct {
+		a     string
+		b     string
+		equal int
+	}
+
+	// number of shared trailing segments including the suffix
+	tcs := []tc{
+		{a: "192.0.2.10", b: "192.0.2.11", equal: 3},
+		{a: "192.0.2.10", b: "192.0.3.10", equal: 2},
+		{a: "192.0.2.10", b: "192.1.2.10", equal: 1},
+		{a: "2001:db8:1:1::1", b: "2001:db8:1:1::2", equal: 3},
+		{a: "2001:db8:1:1::1", b: "2001:db8:1:2::1", equal: 2},
+	}
+
+	for _, tc := range tcs {
+		a := strings.Split(ck.host(tc.a), ".")
+		b := strings.Split(ck.host(tc.b), ".")
+		equal := 0
+		for i := 1; i <= len(a) && i <= len(b); i++ {
+			if a[len(a)-i] != b[len(b)-i] {
+				break
+			}
+			equal++
+		}
+		if equal != tc.equal {
+			t.Errorf("got %d shared segments, want %d (%s, %s)", equal, tc.equal, tc.a, tc.b)
+		}
+	}
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
@@ -17,6 +22,9 @@ import (
 	"github.com/salimnassim/ircd"
 )
 
+// Set for processes started by an upgrade.
+const upgradeEnv = "IRCD_UPGRADE"
+
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
@@ -27,10 +35,16 @@ func main() {
 		if ok {
 			http.Handle("/metrics", promhttp.Handler())
 		}
-		http.ListenAndServe(":2112", nil)
+		// the previous process may still hold the port during an upgrade
+		for {
+			err := http.ListenAndServe(":2112", nil)
+			log.Error().Err(err).Msg("cant serve http, retrying")
+			time.Sleep(time.Second)
+		}
 	}()
 
 	_, tlsEnabled := os.LookupEnv("TLS")
+	_, identEnabled := os.LookupEnv("IDENT")
 
 	config := ircd.ServerConfig{
 		Name:     os.Getenv("SERVER_NAME"),
@@ -47,18 +61,29 @@ func main() {
 		CertificateKey:  os.Getenv("TLS_KEY"),
 		PingFrequency:   30,
 		PongMaxLatency:  10,
+		CloakKeys:       strings.Split(os.Getenv("CLOAK_KEYS"), ","),
+		CloakSuffix:     os.Getenv("CLOAK_SUFFIX"),
+
+		ThrottleConnections: 5,
+		ThrottleWindow:      30,
+		MaxClones:           5,
+		MaxClonesIPv6:       10,
+		LimitExempt:         strings.Split(os.Getenv("LIMIT_EXEMPT"), ","),
+		RegistrationTimeout: 60,
+		ShutdownReason:      "Server shutting down",
+
 		Parameters: ircd.ServerConfigParameters{
 			MaxAwayLength:     128,
 			CaseMapping:       "ascii",
 			ChannelLimit:      "#&:64",
-			ChannelModes:      "b,f,lk,ztSsrOmMiCc",
+			ChannelModes:      "beI,k,fl,CimnOprRstz",
 			MaxChannelLength:  50,
 			ChannelTypes:      "&#",
 			EList:             "",
 			Excepts:           "",
 			MaxHostnameLength: 32,
 			MaxKickLength:     32,
-			MaxList:           "b:16",
+			MaxList:           "beI:64",
 			MaxModes:          16,
 			Network:           "Network",
 			MaxNickLength:     31,
@@ -70,41 +95,146 @@ func main() {
 		},
 	}
 
-	server := ircd.NewServer(config)
+	options := []ircd.Option{ircd.WithLogger(log.Logger)}
+	if path, ok := os.LookupEnv("DATABASE"); ok {
+		db, err := ircd.OpenDatabase(path)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cant open database")
+		}
+		defer db.Close()
+
+		accounts, err := ircd.OpenAccountStore(db)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cant open accounts")
+		}
+		channels, err := ircd.OpenChannelRegistrationStore(db)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cant open channel registrations")
+		}
+		bans, err := ircd.OpenServerBanStore(db)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cant open server bans")
+		}
+
+		config.Accounts = ircd.AccountConfig{Enabled: true}
+		options = append(options,
+			ircd.WithDatabase(db),
+			ircd.WithAccountStore(accounts),
+			ircd.WithChannelRegistrationStore(channels),
+			ircd.WithServerBanStore(bans),
+		)
+
+		if _, ok := os.LookupEnv("HISTORY"); ok {
+			history, err := ircd.OpenHistoryStore(db, 0)
+			if err != nil {
+				log.Fatal().Err(err).Msg("cant open history")
+			}
+			defer history.Close()
+			options = append(options, ircd.WithHistoryStore(history))
+		}
+	}
+
+	server := ircd.NewServer(config, options...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	go func(server ircd.Serverer, isTLS bool) {
+	tlsConfig := &tls.Config{
+		GetCertificate: func(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(config.CertificateFile, config.CertificateKey)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+		// client certificates are optional and only used for
+		// fingerprint matching, so they are not verified
+		ClientAuth: tls.RequestClientCert,
+	}
+
+	run := func(listener net.Listener, listenerConfig ircd.ListenerConfig) {
+		err := server.Run(ctx, listener, listenerConfig)
+		if err != nil &&
+			!errors.Is(err, ircd.ErrServerClosed) &&
+			!errors.Is(err, ircd.ErrServerUpgraded) &&
+			!errors.Is(err, context.Canceled) {
+			log.Fatal().Err(err).Msg("cant accept")
+		}
+	}
+
+	if _, ok := os.LookupEnv(upgradeEnv); ok {
+		// started by a previous process, see upgrade below
+		listeners, err := server.Resume(os.NewFile(3, "upgrade"))
+		if err != nil {
+			log.Fatal().Err(err).Msg("cant resume")
+		}
+		for _, inherited := range listeners {
+			if inherited.Config.TLS {
+				inherited.Config.TLSConfig = tlsConfig
+			}
+			log.Info().Msgf("resuming irc, listening on tcp:%s", inherited.Listener.Addr())
+			go run(inherited.Listener, inherited.Config)
+		}
+	} else {
 		log.Info().Msgf("starting irc, listening on tcp:%s", os.Getenv("PORT"))
 		listener, err := net.Listen("tcp", fmt.Sprintf(":%s", os.Getenv("PORT")))
 		if err != nil {
 			log.Fatal().Err(err).Msg("cant listen")
 		}
-		server.Run(listener, isTLS)
-		defer listener.Close()
-	}(server, false)
+		go run(listener, ircd.ListenerConfig{Ident: identEnabled})
 
-	if config.TLS {
-		go func(server ircd.Serverer, isTLS bool) {
+		if config.TLS {
 			log.Info().Msgf("starting irc, listening on tcp:%s TLS", os.Getenv("PORT_TLS"))
-			listener, err := tls.Listen(
-				"tcp", fmt.Sprintf(":%s", os.Getenv("PORT_TLS")),
-				&tls.Config{
-					GetCertificate: func(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
-						cert, err := tls.LoadX509KeyPair(config.CertificateFile, config.CertificateKey)
-						if err != nil {
-							return nil, err
-						}
-						return &cert, nil
-					},
-				})
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%s", os.Getenv("PORT_TLS")))
 			if err != nil {
 				log.Fatal().Err(err).Msg("cant listen tls")
 			}
-			server.Run(listener, isTLS)
-			defer listener.Close()
-		}(server, true)
+			go run(listener, ircd.ListenerConfig{TLSConfig: tlsConfig, Ident: identEnabled})
+		}
 	}
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	<-sig
+	// SIGUSR2 starts a new binary and hands all connections over to it
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
+	upgraded := make(chan struct{})
+	go func() {
+		for range upgrade {
+			executable, err := os.Executable()
+			if err != nil {
+				log.Error().Err(err).Msg("cant find executable")
+				continue
+			}
+
+			cmd := exec.Command(executable, os.Args[1:]...)
+			cmd.Env = append(os.Environ(), upgradeEnv+"=1")
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+
+			upgradeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			err = server.Upgrade(upgradeCtx, cmd)
+			cancel()
+			if err != nil {
+				log.Error().Err(err).Msg("upgrade failed")
+				continue
+			}
+			close(upgraded)
+			return
+		}
+	}()
+
+	select {
+	case <-upgraded:
+		log.Info().Msg("upgrade complete, exiting")
+		return
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Info().Msg("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Error().Err(err).Msg("clients did not disconnect in time")
+	}
 }
@@ -38,6 +38,19 @@ func (cmd quitCommand) command() string {
 	)
 }
 
+// https://modern.ircdocs.horse/#nick-message
+type nickCommand struct {
+	prefix string
+	nick   string
+}
+
+func (cmd nickCommand) command() string {
+	return fmt.Sprintf(
+		":%s NICK %s",
+		cmd.prefix, cmd.nick,
+	)
+}
+
 type privmsgCommand struct {
 	prefix string
 	target string
@@ -63,16 +76,69 @@ func (cmd noticeCommand) command() string {
 	)
 }
 
-// type errorCommand struct {
-// 	text string
-// }
+// NOTICE sent by a client.
+//
+// https://modern.ircdocs.horse/#notice-message
+type clientNoticeCommand struct {
+	prefix string
+	target string
+	text   string
+}
+
+func (cmd clientNoticeCommand) command() string {
+	return fmt.Sprintf(
+		":%s NOTICE %s :%s",
+		cmd.prefix, cmd.target, cmd.text,
+	)
+}
+
+// https://ircv3.net/specs/extensions/account-registration
+type registerSuccessCommand struct {
+	server  string
+	account string
+	text    string
+}
+
+func (cmd registerSuccessCommand) command() string {
+	return fmt.Sprintf(
+		":%s REGISTER SUCCESS %s :%s",
+		cmd.server, cmd.account, cmd.text,
+	)
+}
+
+// Standard reply FAIL.
+//
+// https://ircv3.net/specs/extensions/standard-replies
+type failCommand struct {
+	server  string
+	cmd     string
+	code    string
+	context []string
+	text    string
+}
+
+func (cmd failCommand) command() string {
+	context := ""
+	for _, c := range cmd.context {
+		context += " " + c
+	}
+	return fmt.Sprintf(
+		":%s FAIL %s %s%s :%s",
+		cmd.server, cmd.cmd, cmd.code, context, cmd.text,
+	)
+}
+
+// https://modern.ircdocs.horse/#error-message
+type errorCommand struct {
+	text string
+}
 
-// func (cmd errorCommand) command() string {
-// 	return fmt.Sprintf(
-// 		"ERROR :%s",
-// 		cmd.text,
-// 	)
-// }
+func (cmd errorCommand) command() string {
+	return fmt.Sprintf(
+		"ERROR :%s",
+		cmd.text,
+	)
+}
 
 type pingCommand struct {
 	text string
@@ -155,3 +221,32 @@ func (cmd inviteCommand) command() string {
 		cmd.prefix, cmd.target, cmd.channel,
 	)
 }
+
+// https://ircv3.net/specs/extensions/capability-negotiation
+type capCommand struct {
+	server     string
+	client     string
+	subcommand string
+	caps       string
+}
+
+func (cmd capCommand) command() string {
+	return fmt.Sprintf(
+		":%s CAP %s %s :%s",
+		cmd.server, cmd.client, cmd.subcommand, cmd.caps,
+	)
+}
+
+// https://ircv3.net/specs/extensions/chghost
+type chghostCommand struct {
+	prefix   string
+	username string
+	hostname string
+}
+
+func (cmd chghostCommand) command() string {
+	return fmt.Sprintf(
+		":%s CHGHOST %s %s",
+		cmd.prefix, cmd.username, cmd.hostname,
+	)
+}
@@ -25,6 +25,39 @@ func TestCommands(t *testing.T) {
 			},
 			want: ":nick!user@host.fqdn PART #testing :No reason given",
 		},
+		{
+			input: clientNoticeCommand{
+				prefix: "nick!user@host.fqdn",
+				target: "#testing",
+				text:   "hey",
+			},
+			want: ":nick!user@host.fqdn NOTICE #testing :hey",
+		},
+		{
+			input: registerSuccessCommand{
+				server:  "server",
+				account: "nick",
+				text:    "Account successfully registered",
+			},
+			want: ":server REGISTER SUCCESS nick :Account successfully registered",
+		},
+		{
+			input: failCommand{
+				server:  "server",
+				cmd:     "REGISTER",
+				code:    "ACCOUNT_EXISTS",
+				context: []string{"nick"},
+				text:    "Account already exists",
+			},
+			want: ":server FAIL REGISTER ACCOUNT_EXISTS nick :Account already exists",
+		},
+		{
+			input: nickCommand{
+				prefix: "nick!user@host.fqdn",
+				nick:   "newnick",
+			},
+			want: ":nick!user@host.fqdn NICK newnick",
+		},
 		{
 			input: privmsgCommand{
 				prefix: "nick!user@host.fqdn",
@@ -40,6 +73,12 @@ func TestCommands(t *testing.T) {
 			},
 			want: "NOTICE client :hey",
 		},
+		{
+			input: errorCommand{
+				text: "Closing Link: 127.0.0.1 (Too many connections)",
+			},
+			want: "ERROR :Closing Link: 127.0.0.1 (Too many connections)",
+		},
 		{
 			input: pingCommand{
 				text: "12345",
@@ -80,6 +119,23 @@ func TestCommands(t *testing.T) {
 			},
 			want: ":nick!user@host.fqdn JOIN #testing",
 		},
+		{
+			input: capCommand{
+				server:     "server",
+				client:     "*",
+				subcommand: "LS",
+				caps:       "chghost",
+			},
+			want: ":server CAP * LS :chghost",
+		},
+		{
+			input: chghostCommand{
+				prefix:   "nick!user@host.fqdn",
+				username: "ident",
+				hostname: "new.host",
+			},
+			want: ":nick!user@host.fqdn CHGHOST ident new.host",
+		},
 	}
 
 	for _, tc := range tcs {
@@ -0,0 +1,440 @@
+package ircd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Key holding the schema version.
+	databaseVersionKey = "meta/version"
+	// Superseded records tolerated before the journal is compacted.
+	databaseCompactThreshold = 1024
+)
+
+// Schema migrations, migrations[i] upgrades a database from version i to
+// version i+1. Append new migrations, never change existing ones.
+//
+// A migration returns the operations it needs, they are written in one
+// batch with the new version so a crash can not apply a migration twice.
+var databaseMigrations = []func(db *Database) ([]databaseOp, error){
+	// 0 -> 1: initial schema, buckets are created on first write
+	func(db *Database) ([]databaseOp, error) { return nil, nil },
+	// 1 -> 2: channel ban masks become list entries with setter and time
+	migrateChannelBans,
+}
+
+var databaseChecksum = crc32.MakeTable(crc32.Castagnoli)
+
+// Embedded key/value database stored in a single append-only journal.
+//
+// Every write appends one checksummed line holding a batch of operations
+// and is synced before it returns, so a batch is either applied completely
+// or not at all. A torn last line left by a crash is discarded when the
+// database is opened. The journal is rewritten once it holds more superseded
+// records than live ones.
+//
+// Values are JSON documents, keys are grouped into buckets by a prefix
+// (e.g. account/alice). Create with OpenDatabase.
+//
+// Only one process can have the database open, the lock is held on a file
+// next to the journal until Close.
+type Database struct {
+	mu *sync.RWMutex
+
+	path string
+	file *os.File
+	// Held while the database is open.
+	lock    *os.File
+	records map[string]json.RawMessage
+	// Records in the journal that have been overwritten or deleted.
+	stale int
+	// Set if a failed write could not be undone, the journal is not
+	// appended to again.
+	failed error
+}
+
+type databaseOp struct {
+	Key    string          `json:"k"`
+	Value  json.RawMessage `json:"v,omitempty"`
+	Delete bool            `json:"d,omitempty"`
+}
+
+// Opens or creates the database at path and migrates it to the current
+// schema version. Fails if another process has the database open.
+func OpenDatabase(path string) (*Database, error) {
+	db := &Database{
+		mu:      &sync.RWMutex{},
+		path:    path,
+		records: make(map[string]json.RawMessage),
+	}
+
+	err := db.open()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Takes the lock, replays the journal and opens it for appending.
+func (db *Database) open() error {
+	lock, err := lockFile(db.path + ".lock")
+	if err != nil {
+		return err
+	}
+
+	err = db.load()
+	if err == nil {
+		db.file, err = os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	}
+	if err != nil {
+		lock.Close()
+		return err
+	}
+	db.lock = lock
+	return nil
+}
+
+// Opens the database again after Close. Records are replayed from the
+// journal, which another process may have written to in the meantime.
+func (db *Database) reopen() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.records = make(map[string]json.RawMessage)
+	db.stale = 0
+	return db.open()
+}
+
+// Replays the journal.
+func (db *Database) load() error {
+	f, err := os.Open(db.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	offset := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// crashed while appending
+				return db.truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ops, err := decodeDatabaseLine(line)
+		if err != nil {
+			// only the last line can be torn
+			if _, peek := reader.Peek(1); peek == io.EOF {
+				return db.truncate(offset)
+			}
+			return fmt.Errorf("%w at offset %d of %s", err, offset, db.path)
+		}
+		db.apply(ops)
+		offset += int64(len(line))
+	}
+}
+
+func (db *Database) truncate(size int64) error {
+	return os.Truncate(db.path, size)
+}
+
+// Applies ops to the in-memory records. Must be called with the lock held.
+func (db *Database) apply(ops []databaseOp) {
+	for _, op := range ops {
+		if _, exists := db.records[op.Key]; exists {
+			db.stale++
+		}
+		if op.Delete {
+			delete(db.records, op.Key)
+			// the delete record itself is stale as well
+			db.stale++
+			continue
+		}
+		db.records[op.Key] = op.Value
+	}
+}
+
+// Line format: <crc32c of json in hex> <json array of ops>
+func encodeDatabaseLine(ops []databaseOp) ([]byte, error) {
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	line := fmt.Sprintf("%08x %s\n", crc32.Checksum(data, databaseChecksum), data)
+	return []byte(line), nil
+}
+
+func decodeDatabaseLine(line []byte) ([]databaseOp, error) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	sum, data, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return nil, errorDatabaseCorrupt
+	}
+	want, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil || uint32(want) != crc32.Checksum(data, databaseChecksum) {
+		return nil, errorDatabaseCorrupt
+	}
+	ops := []databaseOp{}
+	err = json.Unmarshal(data, &ops)
+	if err != nil {
+		return nil, errorDatabaseCorrupt
+	}
+	return ops, nil
+}
+
+// Runs migrations the database has not seen yet.
+func (db *Database) migrate() error {
+	version := 0
+	if raw, ok := db.get(databaseVersionKey); ok {
+		err := json.Unmarshal(raw, &version)
+		if err != nil {
+			return err
+		}
+	}
+	if version > len(databaseMigrations) {
+		return fmt.Errorf("%w: database is version %d, newest known version is %d",
+			errorDatabaseVersion, version, len(databaseMigrations))
+	}
+
+	for ; version < len(databaseMigrations); version++ {
+		ops, err := databaseMigrations[version](db)
+		if err != nil {
+			return fmt.Errorf("cant migrate database to version %d: %w", version+1, err)
+		}
+		op, err := databasePut(databaseVersionKey, version+1)
+		if err != nil {
+			return err
+		}
+		err = db.write(append(ops, op)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schema version of the database.
+func (db *Database) Version() int {
+	version := 0
+	if raw, ok := db.get(databaseVersionKey); ok {
+		json.Unmarshal(raw, &version)
+	}
+	return version
+}
+
+// Closes the journal and releases the lock, later writes fail.
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	err := db.file.Close()
+	db.lock.Close()
+	return err
+}
+
+// Returns the value of key.
+func (db *Database) get(key string) (json.RawMessage, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	value, ok := db.records[key]
+	return value, ok
+}
+
+// Returns keys starting with prefix, ordered.
+func (db *Database) keys(prefix string) []string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keys := []string{}
+	for key := range db.records {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Returns values of keys starting with prefix, ordered by key.
+func (db *Database) scan(prefix string) []json.RawMessage {
+	keys := db.keys(prefix)
+	db.mu.RLock()
+	values := make([]json.RawMessage, 0, len(keys))
+	for _, key := range keys {
+		if value, ok := db.records[key]; ok {
+			values = append(values, value)
+		}
+	}
+	db.mu.RUnlock()
+	return values
+}
+
+// Sets key to value encoded as JSON.
+func (db *Database) put(key string, value any) error {
+	op, err := databasePut(key, value)
+	if err != nil {
+		return err
+	}
+	return db.write(op)
+}
+
+// Deletes key.
+func (db *Database) delete(key string) error {
+	return db.write(databaseOp{Key: key, Delete: true})
+}
+
+func databasePut(key string, value any) (databaseOp, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return databaseOp{}, err
+	}
+	return databaseOp{Key: key, Value: data}, nil
+}
+
+// Appends ops as one batch and syncs the journal.
+func (db *Database) write(ops ...databaseOp) error {
+	line, err := encodeDatabaseLine(ops)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.failed != nil {
+		return db.failed
+	}
+
+	// a failed write can leave part of the line behind, which has to be
+	// removed or the next line would follow a torn one
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = db.file.Write(line)
+	if err == nil {
+		err = db.file.Sync()
+	}
+	if err != nil {
+		truncateErr := db.file.Truncate(info.Size())
+		if truncateErr != nil {
+			db.failed = fmt.Errorf("cant undo failed write to %s: %w", db.path, truncateErr)
+		}
+		return err
+	}
+	db.apply(ops)
+
+	if db.stale > databaseCompactThreshold && db.stale > len(db.records) {
+		return db.compact()
+	}
+	return nil
+}
+
+// Rewrites the journal with live records only. Must be called with the
+// lock held.
+func (db *Database) compact() error {
+	keys := []string{}
+	for key := range db.records {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	buf := &bytes.Buffer{}
+	for _, key := range keys {
+		line, err := encodeDatabaseLine([]databaseOp{{Key: key, Value: db.records[key]}})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+	}
+
+	// the new journal stays open after it is moved over the old one, so
+	// appends can not keep going to the replaced file
+	file, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(buf.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), db.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	db.file.Close()
+	db.file = file
+	db.stale = 0
+	return nil
+}
+
+func migrateChannelBans(db *Database) ([]databaseOp, error) {
+	ops := []databaseOp{}
+	for _, key := range db.keys("channel/") {
+		raw, _ := db.get(key)
+		record := map[string]json.RawMessage{}
+		err := json.Unmarshal(raw, &record)
+		if err != nil {
+			return nil, err
+		}
+		// already migrated
+		if _, ok := record["Lists"]; ok {
+			continue
+		}
+
+		masks := []string{}
+		if bans, ok := record["Bans"]; ok {
+			err := json.Unmarshal(bans, &masks)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries := []listEntry{}
+		for _, mask := range masks {
+			entries = append(entries, listEntry{Mask: mask})
+		}
+		delete(record, "Bans")
+		record["Lists"], err = json.Marshal(map[string][]listEntry{"b": entries})
+		if err != nil {
+			return nil, err
+		}
+
+		op, err := databasePut(key, record)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package ircd
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Opens path and takes an exclusive lock on it, released when the returned
+// file is closed. Fails with errorDatabaseLocked if another process holds
+// the lock.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errorDatabaseLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
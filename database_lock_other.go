@@ -0,0 +1,10 @@
+//go:build !unix
+
+package ircd
+
+import "os"
+
+// Opens path. Other processes are not locked out on this platform.
+func lockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+}
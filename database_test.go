@@ -0,0 +1,312 @@
+package ircd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Version() != len(databaseMigrations) {
+		t.Errorf("got version %d, want %d", db.Version(), len(databaseMigrations))
+	}
+
+	if err := db.put("test/a", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.put("test/b", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.put("test/a", "three"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.delete("test/b"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values := db.scan("test/")
+	if len(values) != 1 || string(values[0]) != `"three"` {
+		t.Errorf("got %s, want [\"three\"]", values)
+	}
+}
+
+func TestDatabaseTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.put("test/a", "one"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	tcs := []struct {
+		name string
+		tail string
+	}{
+		{"no newline", `00000000 [{"k":"test/b"`},
+		{"bad checksum", "00000000 [{\"k\":\"test/b\",\"v\":\"two\"}]\n"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.WriteString(tc.tail)
+			f.Close()
+
+			db, err := OpenDatabase(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if _, ok := db.get("test/b"); ok {
+				t.Error("torn write was applied")
+			}
+			if _, ok := db.get("test/a"); !ok {
+				t.Error("complete write was lost")
+			}
+		})
+	}
+}
+
+func TestDatabaseCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// damaged record followed by a valid one
+	data = append([]byte("00000000 []\n"), data...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenDatabase(path)
+	if !errors.Is(err, errorDatabaseCorrupt) {
+		t.Errorf("got %v, want %v", err, errorDatabaseCorrupt)
+	}
+}
+
+func TestDatabaseVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.put(databaseVersionKey, len(databaseMigrations)+1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err = OpenDatabase(path)
+	if !errors.Is(err, errorDatabaseVersion) {
+		t.Errorf("got %v, want %v", err, errorDatabaseVersion)
+	}
+}
+
+func TestDatabaseCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < databaseCompactThreshold*2; i++ {
+		if err := db.put("test/a", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.stale > databaseCompactThreshold {
+		t.Errorf("journal was not compacted, %d stale records", db.stale)
+	}
+	// appends after compacting go to the new journal
+	if err := db.put("test/b", "after"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if value, _ := db.get("test/a"); string(value) != "2047" {
+		t.Errorf("got %s, want 2047", value)
+	}
+	if value, _ := db.get("test/b"); string(value) != `"after"` {
+		t.Errorf("got %s, want \"after\"", value)
+	}
+	if db.Version() != len(databaseMigrations) {
+		t.Errorf("version was lost, got %d", db.Version())
+	}
+}
+
+func TestDatabaseMigrateChannelBans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// channel saved by version 1
+	old := map[string]any{"Name": "#test", "Founder": "alice", "Bans": []string{"*!*@bad"}}
+	if err := db.put("channel/#test", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.put(databaseVersionKey, 1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cs, err := OpenChannelRegistrationStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, ok := cs.get("#test")
+	if !ok {
+		t.Fatal("channel was lost")
+	}
+	if len(rc.Lists["b"]) != 1 || rc.Lists["b"][0].Mask != "*!*@bad" {
+		t.Errorf("got: %v", rc.Lists)
+	}
+}
+
+func TestDatabaseMigrateOneBatch(t *testing.T) {
+	migrations := databaseMigrations
+	t.Cleanup(func() { databaseMigrations = migrations })
+	databaseMigrations = append(slices.Clone(migrations), func(db *Database) ([]databaseOp, error) {
+		op, err := databasePut("test/migrated", true)
+		return []databaseOp{op}, err
+	})
+
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// the migrated record and the version bump must share a journal line,
+	// otherwise a crash between them runs the migration again
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, `"test/migrated"`) || !strings.Contains(last, databaseVersionKey) {
+		t.Errorf("got last line %q", last)
+	}
+}
+
+func TestDatabaseMigrateChannelBansMigrated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	lists := map[string][]listEntry{"b": {{Mask: "*!*@bad"}}, "e": {{Mask: "*!*@good"}}}
+	if err := db.put("channel/#test", map[string]any{"Name": "#test", "Lists": lists}); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := migrateChannelBans(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 0 {
+		t.Errorf("got ops %v, want none", ops)
+	}
+}
+
+func TestDatabaseLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenDatabase(path)
+	if !errors.Is(err, errorDatabaseLocked) {
+		t.Fatalf("got: %v, want: %v", err, errorDatabaseLocked)
+	}
+
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatalf("lock was not released: %v", err)
+	}
+	db.Close()
+}
+
+func TestDatabaseFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.put("test/a", "one"); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes and truncates fail on a read-only handle
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.file.Close()
+	db.file = readOnly
+
+	if err := db.put("test/a", "two"); err == nil {
+		t.Fatal("write to read-only journal succeeded")
+	}
+	if value, _ := db.get("test/a"); string(value) != `"one"` {
+		t.Errorf("failed write was applied, got %s", value)
+	}
+	// the journal can not be trusted once a failed write was not undone
+	if err := db.put("test/b", "three"); err == nil {
+		t.Error("write after unrecoverable failure succeeded")
+	}
+	db.Close()
+
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if value, _ := db.get("test/a"); string(value) != `"one"` {
+		t.Errorf("got %s, want \"one\"", value)
+	}
+}
@@ -17,11 +17,72 @@ var (
 )
 
 var (
-	errorBanMaskDoesNotExist  = errors.New("ban mask does not exist")
-	errorBanMaskAlreadyExists = errors.New("ban mask is already defined")
+	errorMaskNotListed     = errors.New("mask is not on the list")
+	errorMaskAlreadyListed = errors.New("mask is already on the list")
 )
 
 var (
 	errorParserInputTooLong   = errors.New("message is too long")
 	errorParserInputMalformed = errors.New("malformed message")
 )
+
+var (
+	errorIdentMalformed    = errors.New("malformed ident response")
+	errorIdentPortMismatch = errors.New("ident response port mismatch")
+	errorIdentNoUser       = errors.New("ident returned no user")
+)
+
+var (
+	errorThrottled     = errors.New("connecting too fast")
+	errorTooManyClones = errors.New("too many connections from host")
+)
+
+var (
+	// Returned by Run after Shutdown has been called.
+	ErrServerClosed = errors.New("server closed")
+)
+
+var (
+	// Returned by Run after another process has taken over the listeners.
+	ErrServerUpgraded = errors.New("server upgraded")
+)
+
+var (
+	errorUpgradeInProgress = errors.New("upgrade is already in progress")
+	errorUpgradeListener   = errors.New("listener can not be handed over")
+	errorUpgradeNotReady   = errors.New("new process did not become ready")
+	errorUpgradeVersion    = errors.New("unsupported upgrade state version")
+)
+
+var (
+	// Returned by NewVirtualClient if the nickname is not valid.
+	ErrErroneousNickname = errors.New("erroneous nickname")
+	// Returned by NewVirtualClient if the nickname is already in use.
+	ErrNicknameInUse = errors.New("nickname is already in use")
+	// Returned by VirtualClient methods after the client has quit.
+	ErrClientQuit = errors.New("client has quit")
+)
+
+var (
+	errorAccountExists       = errors.New("account already exists")
+	errorAccountDoesNotExist = errors.New("account does not exist")
+	errorWeakPassword        = errors.New("password is too short")
+	errorNicknameNotGrouped  = errors.New("nickname is not grouped to account")
+	errorInvalidFingerprint  = errors.New("invalid certificate fingerprint")
+	errorFingerprintInUse    = errors.New("certificate fingerprint is used by another account")
+)
+
+var (
+	errorChannelRegistered    = errors.New("channel is already registered")
+	errorChannelNotRegistered = errors.New("channel is not registered")
+)
+
+var (
+	errorDatabaseCorrupt = errors.New("database record is corrupt")
+	errorDatabaseVersion = errors.New("database is newer than this server")
+	errorDatabaseLocked  = errors.New("database is in use by another process")
+)
+
+var (
+	errorServerBanDoesNotExist = errors.New("server ban does not exist")
+)
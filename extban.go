@@ -0,0 +1,184 @@
+package ircd
+
+import (
+	"strings"
+)
+
+// Prefix of extended ban masks.
+const extbanPrefix = '$'
+
+// Extended ban types and whether they take an argument.
+//
+// Example: $a:alice, $~z, m:*!*@host.example.com
+var extbanTypes = map[rune]struct {
+	// Argument is required.
+	arg bool
+	// Argument is not allowed.
+	noArg bool
+}{
+	// logged in to the account, or to any account without an argument
+	'a': {},
+	// member of the channel
+	'j': {arg: true},
+	// mute, the argument is a mask that can not speak but can join
+	'm': {arg: true},
+	// realname
+	'r': {arg: true},
+	// nick!user@host#realname
+	'x': {arg: true},
+	// not connected over TLS
+	'z': {noArg: true},
+}
+
+// Parsed extended ban.
+type extban struct {
+	// Match clients that do not match.
+	negate bool
+	kind   rune
+	arg    string
+}
+
+// Is mask an extended ban?
+func isExtban(mask string) bool {
+	return strings.HasPrefix(mask, string(extbanPrefix)) || strings.HasPrefix(mask, "m:")
+}
+
+// Parses an extended ban, m:mask is short for $m:mask.
+func parseExtban(mask string) (extban, bool) {
+	if strings.HasPrefix(mask, "m:") {
+		mask = "$" + mask
+	}
+	if !strings.HasPrefix(mask, string(extbanPrefix)) {
+		return extban{}, false
+	}
+	mask = mask[1:]
+
+	e := extban{}
+	if strings.HasPrefix(mask, "~") {
+		e.negate = true
+		mask = mask[1:]
+	}
+
+	kind, arg, hasArg := strings.Cut(mask, ":")
+	if len(kind) != 1 {
+		return extban{}, false
+	}
+	e.kind = rune(kind[0])
+	e.arg = arg
+
+	t, ok := extbanTypes[e.kind]
+	if !ok || (t.arg && arg == "") || (t.noArg && hasArg) {
+		return extban{}, false
+	}
+	// mutes can not be negated, nested or muted again
+	if e.kind == 'm' && (e.negate || strings.HasPrefix(arg, "m:") || strings.HasPrefix(arg, "$m")) {
+		return extban{}, false
+	}
+	return e, true
+}
+
+// Canonical form of the extended ban.
+func (e extban) String() string {
+	mask := string(extbanPrefix)
+	if e.negate {
+		mask += "~"
+	}
+	mask += string(e.kind)
+	if e.arg != "" {
+		mask += ":" + e.arg
+	}
+	return mask
+}
+
+// Does the extended ban match c?
+func (e extban) matches(s *Server, c clienter) bool {
+	matched := false
+	switch e.kind {
+	case 'a':
+		account := c.account()
+		matched = account != "" && (e.arg == "" || matchPattern(s.casemapping, e.arg, account))
+	case 'j':
+		if ch, exists := s.channels.get(e.arg); exists {
+			matched = ch.clients().isMember(c)
+		}
+	case 'm':
+		matched = s.matchListMask(e.arg, c)
+	case 'r':
+		matched = matchPattern(s.casemapping, e.arg, c.realname())
+	case 'x':
+		mask, realname, _ := strings.Cut(e.arg, "#")
+		matched = matchClientMask(s.casemapping, mask, c) && matchPattern(s.casemapping, realname, c.realname())
+	case 'z':
+		matched = !c.tls()
+	}
+	return matched != e.negate
+}
+
+// Does mask, a host mask or an extended ban, match c?
+func (s *Server) matchListMask(mask string, c clienter) bool {
+	if !isExtban(mask) {
+		return matchClientMask(s.casemapping, mask, c)
+	}
+	e, ok := parseExtban(mask)
+	if !ok {
+		return false
+	}
+	return e.matches(s, c)
+}
+
+// Does c match any entry on list mode of ch?
+//
+// Mutes only match if mutes is true, other entries only if it is false.
+func (s *Server) matchList(ch channeler, mode rune, c clienter, mutes bool) bool {
+	for _, entry := range ch.listEntries(mode) {
+		e, ok := parseExtban(entry.Mask)
+		mute := ok && e.kind == 'm'
+		if mute != mutes {
+			continue
+		}
+		if s.matchListMask(entry.Mask, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Is c banned from joining ch? Ban exceptions override bans, mute
+// exceptions do not.
+func (s *Server) banned(ch channeler, c clienter) bool {
+	return s.matchList(ch, 'b', c, false) && !s.matchList(ch, 'e', c, false)
+}
+
+// Is c banned from speaking on ch? Ban exceptions override bans and mutes,
+// mute exceptions only override mutes.
+func (s *Server) muted(ch channeler, c clienter) bool {
+	if s.matchList(ch, 'e', c, false) {
+		return false
+	}
+	return s.matchList(ch, 'b', c, false) ||
+		(s.matchList(ch, 'b', c, true) && !s.matchList(ch, 'e', c, true))
+}
+
+// Can c join ch without an invite when it is invite only?
+func (s *Server) inviteExempt(ch channeler, c clienter) bool {
+	return s.matchList(ch, 'I', c, false)
+}
+
+// Normalizes a list mode parameter, returns false if it is not a valid mask
+// or extended ban.
+func normalizeListMask(mask string) (string, bool) {
+	if !isExtban(mask) {
+		mask = normalizeMask(mask)
+		_, err := parseMask(mask)
+		return mask, err == nil
+	}
+
+	e, ok := parseExtban(mask)
+	if !ok {
+		return "", false
+	}
+	if e.kind == 'm' && !isExtban(e.arg) {
+		e.arg = normalizeMask(e.arg)
+	}
+	return e.String(), true
+}
@@ -0,0 +1,168 @@
+package ircd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeListMask(t *testing.T) {
+	tcs := []struct {
+		input string
+		want  string
+		valid bool
+	}{
+		{input: "host.example.com", want: "*!*@host.example.com", valid: true},
+		{input: "$a", want: "$a", valid: true},
+		{input: "$a:alice", want: "$a:alice", valid: true},
+		{input: "$~a", want: "$~a", valid: true},
+		{input: "$z", want: "$z", valid: true},
+		{input: "$z:arg", valid: false},
+		{input: "$r", valid: false},
+		{input: "$r:*bot*", want: "$r:*bot*", valid: true},
+		{input: "$j:#other", want: "$j:#other", valid: true},
+		{input: "$x:*!*@host#*bot*", want: "$x:*!*@host#*bot*", valid: true},
+		{input: "m:spammer", want: "$m:spammer!*@*", valid: true},
+		{input: "$m:$a:alice", want: "$m:$a:alice", valid: true},
+		{input: "$m:m:nested", valid: false},
+		{input: "$q:unknown", valid: false},
+		{input: "$", valid: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			got, valid := normalizeListMask(tc.input)
+			if valid != tc.valid || got != tc.want {
+				t.Errorf("got: %s %t, want: %s %t", got, valid, tc.want, tc.valid)
+			}
+		})
+	}
+}
+
+func TestExtbanMatch(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	c := newMockClient(true)
+	c.nick = "bot"
+	c.real = "Friendly Bot"
+	c.acct = "Alice"
+	c.secure = false
+	s.clients.add(c)
+
+	other := newChannel("#other", "")
+	other.clients().add(c)
+	s.channels.add(other.name(), other)
+
+	tcs := []struct {
+		mask string
+		want bool
+	}{
+		{mask: "$a", want: true},
+		{mask: "$a:alice", want: true},
+		{mask: "$a:bob", want: false},
+		{mask: "$~a:bob", want: true},
+		{mask: "$r:*bot", want: true},
+		{mask: "$r:human*", want: false},
+		{mask: "$z", want: true},
+		{mask: "$~z", want: false},
+		{mask: "$j:#other", want: true},
+		{mask: "$j:#none", want: false},
+		{mask: "$x:bot!*@*#friendly*", want: true},
+		{mask: "$x:bot!*@*#human*", want: false},
+		{mask: "$m:bot!*@*", want: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.mask, func(t *testing.T) {
+			if got := s.matchListMask(tc.mask, c); got != tc.want {
+				t.Errorf("got: %t, want: %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtbanMute(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	quiet := newMockClient(true)
+	quiet.clientID = "quiet"
+	quiet.nick = "quiet"
+	s.clients.add(quiet)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "+bb", "m:quiet", "$q:bad"}})
+
+	want := []string{
+		"696 op #test b $q:bad :Invalid mask",
+		":op!mockuser@mockhost MODE #test +b $m:quiet!*@*",
+	}
+	if slices.Compare(op.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", op.messagesOut, want)
+	}
+
+	// mutes do not stop joining
+	handleJoin(s, quiet, message{command: "JOIN", params: []string{"#test"}})
+	if !ch.clients().isMember(quiet) {
+		t.Fatalf("muted client could not join: %v", quiet.messagesOut)
+	}
+
+	quiet.reset()
+	op.reset()
+	handlePrivmsg(s, quiet, message{command: "PRIVMSG", params: []string{"#test", "hello"}})
+
+	want = []string{"404 quiet #test :Cannot send to channel (+b)."}
+	if slices.Compare(quiet.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", quiet.messagesOut, want)
+	}
+	if len(op.messagesOut) != 0 {
+		t.Errorf("message was delivered: %v", op.messagesOut)
+	}
+
+	// exceptions apply to mutes
+	ch.addListEntry('e', listEntry{Mask: "quiet!*@*"})
+	handlePrivmsg(s, quiet, message{command: "PRIVMSG", params: []string{"#test", "hello"}})
+	want = []string{":quiet!mockuser@mockhost PRIVMSG #test :hello"}
+	if slices.Compare(op.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", op.messagesOut, want)
+	}
+}
+
+func TestExtbanMuteExceptionDoesNotExemptBan(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	c := newMockClient(true)
+	c.clientID = "bad"
+	c.nick = "bad"
+	s.clients.add(c)
+
+	ch := newChannel("#test", "")
+	ch.addListEntry('b', listEntry{Mask: "bad!*@*"})
+	ch.addListEntry('e', listEntry{Mask: "$m:bad!*@*"})
+	s.channels.add(ch.name(), ch)
+
+	if !s.banned(ch, c) {
+		t.Error("mute exception exempted a ban")
+	}
+	if !s.muted(ch, c) {
+		t.Error("mute exception let a banned client speak")
+	}
+
+	handleJoin(s, c, message{command: "JOIN", params: []string{"#test"}})
+	if ch.clients().isMember(c) {
+		t.Errorf("banned client joined: %v", c.messagesOut)
+	}
+
+	ch.removeListEntry('b', "bad!*@*")
+	ch.addListEntry('b', listEntry{Mask: "$m:bad!*@*"})
+	if s.muted(ch, c) {
+		t.Error("mute exception did not exempt a mute")
+	}
+}
@@ -0,0 +1,109 @@
+package ircd
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Penalty based flood control settings, all values are in seconds.
+//
+// Every command adds its cost to a per-client penalty clock. Commands are
+// processed immediately while the clock is less than Burst seconds ahead of
+// the current time, after that processing is delayed. Clients that get more
+// than Limit seconds ahead are disconnected.
+type FloodConfig struct {
+	// Penalty a client can accumulate before processing is delayed.
+	Burst int
+	// Penalty after which a client is disconnected for flooding.
+	Limit int
+	// Penalty for commands not listed in Costs.
+	Cost int
+	// Penalty per command.
+	Costs map[string]int
+}
+
+var defaultFloodConfig = FloodConfig{
+	Burst: 10,
+	Limit: 60,
+	Cost:  2,
+	Costs: map[string]int{
+		"PONG":  0,
+		"JOIN":  4,
+		"WHOIS": 4,
+		"WHO":   6,
+		"LIST":  10,
+	},
+}
+
+// Returns config with defaults for unset values.
+func (fc FloodConfig) withDefaults() FloodConfig {
+	if fc.Burst <= 0 {
+		fc.Burst = defaultFloodConfig.Burst
+	}
+	if fc.Limit <= 0 {
+		fc.Limit = defaultFloodConfig.Limit
+	}
+	if fc.Cost <= 0 {
+		fc.Cost = defaultFloodConfig.Cost
+	}
+	if fc.Costs == nil {
+		fc.Costs = defaultFloodConfig.Costs
+	}
+	return fc
+}
+
+type floodControl struct {
+	mu  *sync.Mutex
+	now func() time.Time
+
+	config FloodConfig
+	// Penalty clock.
+	until time.Time
+}
+
+func newFloodControl(config FloodConfig) *floodControl {
+	return &floodControl{
+		mu:     &sync.Mutex{},
+		now:    time.Now,
+		config: config.withDefaults(),
+	}
+}
+
+// Replaces flood control settings, accumulated penalty is kept.
+func (f *floodControl) setConfig(config FloodConfig) {
+	f.mu.Lock()
+	f.config = config.withDefaults()
+	f.mu.Unlock()
+}
+
+// Adds the penalty for command.
+//
+// Returns the time when the command can be processed, excess is true if
+// the client went over the hard limit.
+func (f *floodControl) penalty(command string) (at time.Time, excess bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cost, ok := f.config.Costs[strings.ToUpper(command)]
+	if !ok {
+		cost = f.config.Cost
+	}
+
+	now := f.now()
+	if f.until.Before(now) {
+		f.until = now
+	}
+	f.until = f.until.Add(time.Duration(cost) * time.Second)
+
+	lead := f.until.Sub(now)
+	if lead > time.Duration(f.config.Limit)*time.Second {
+		return now, true
+	}
+
+	burst := time.Duration(f.config.Burst) * time.Second
+	if lead > burst {
+		return f.until.Add(-burst), false
+	}
+	return now, false
+}
@@ -0,0 +1,59 @@
+package ircd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloodControl(t *testing.T) {
+	now := time.Unix(0, 0)
+	f := newFloodControl(FloodConfig{
+		Burst: 4,
+		Limit: 8,
+		Cost:  2,
+		Costs: map[string]int{"PONG": 0, "LIST": 6},
+	})
+	f.now = func() time.Time { return now }
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			at, excess := f.penalty("PRIVMSG")
+			if excess || !at.Equal(now) {
+				t.Errorf("message %d was delayed", i)
+			}
+		}
+	})
+
+	t.Run("free command", func(t *testing.T) {
+		at, excess := f.penalty("PONG")
+		if excess || !at.Equal(now) {
+			t.Errorf("PONG was delayed")
+		}
+	})
+
+	t.Run("delayed", func(t *testing.T) {
+		at, excess := f.penalty("privmsg")
+		if excess {
+			t.Fatalf("excess flood before limit")
+		}
+		want := now.Add(2 * time.Second)
+		if !at.Equal(want) {
+			t.Errorf("got %v, want %v", at, want)
+		}
+	})
+
+	t.Run("excess", func(t *testing.T) {
+		_, excess := f.penalty("LIST")
+		if !excess {
+			t.Errorf("expected excess flood")
+		}
+	})
+
+	t.Run("recovers", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		at, excess := f.penalty("PRIVMSG")
+		if excess || !at.Equal(now) {
+			t.Errorf("message was delayed after penalty expired")
+		}
+	})
+}
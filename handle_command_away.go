@@ -2,7 +2,7 @@ package ircd
 
 import "strings"
 
-func handleAway(s *server, c clienter, m message) {
+func handleAway(s *Server, c clienter, m message) {
 	// unaway
 	if len(m.params) == 0 {
 		if c.away() != "" {
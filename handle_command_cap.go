@@ -0,0 +1,104 @@
+package ircd
+
+import (
+	"slices"
+	"strings"
+)
+
+// Capabilities supported by the server.
+//
+// https://ircv3.net/specs/extensions/capability-negotiation
+const (
+	capChghost             = "chghost"
+	capAccountRegistration = "draft/account-registration"
+)
+
+var supportedCapabilities = []string{
+	capChghost,
+}
+
+// Capabilities supported by s.
+func (s *Server) capabilities() []string {
+	if s.nickserv == nil {
+		return supportedCapabilities
+	}
+	return append(slices.Clone(supportedCapabilities), capAccountRegistration)
+}
+
+func handleCap(s *Server, c clienter, m message) {
+	nick := c.nickname()
+	if nick == "" {
+		nick = "*"
+	}
+
+	subcommand := strings.ToUpper(m.params[0])
+	switch subcommand {
+	case "LS":
+		// registration is suspended until CAP END
+		if !c.handshake() {
+			c.setNegotiating(true)
+		}
+		c.sendCommand(capCommand{
+			server:     s.name,
+			client:     nick,
+			subcommand: "LS",
+			caps:       strings.Join(s.capabilities(), " "),
+		})
+	case "LIST":
+		c.sendCommand(capCommand{
+			server:     s.name,
+			client:     nick,
+			subcommand: "LIST",
+			caps:       strings.Join(c.capabilities(), " "),
+		})
+	case "REQ":
+		if len(m.params) < 2 {
+			c.sendRPL(s.name, errNeedMoreParams{
+				client:  nick,
+				command: m.command,
+			})
+			return
+		}
+		if !c.handshake() {
+			c.setNegotiating(true)
+		}
+
+		requested := strings.Fields(m.params[1])
+		// requests are all or nothing
+		for _, capability := range requested {
+			if !slices.Contains(s.capabilities(), strings.TrimPrefix(capability, "-")) {
+				c.sendCommand(capCommand{
+					server:     s.name,
+					client:     nick,
+					subcommand: "NAK",
+					caps:       m.params[1],
+				})
+				return
+			}
+		}
+		for _, capability := range requested {
+			if strings.HasPrefix(capability, "-") {
+				c.setCapability(strings.TrimPrefix(capability, "-"), false)
+				continue
+			}
+			c.setCapability(capability, true)
+		}
+		c.sendCommand(capCommand{
+			server:     s.name,
+			client:     nick,
+			subcommand: "ACK",
+			caps:       strings.Join(requested, " "),
+		})
+	case "END":
+		if c.handshake() || !c.negotiating() {
+			return
+		}
+		c.setNegotiating(false)
+		tryHandshake(s, c)
+	default:
+		c.sendRPL(s.name, errInvalidCapCmd{
+			client:  nick,
+			command: m.params[0],
+		})
+	}
+}
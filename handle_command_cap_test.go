@@ -0,0 +1,60 @@
+package ircd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommandCap(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+	})
+	c := newMockClient(false)
+
+	t.Run("ls suspends registration", func(t *testing.T) {
+		want := []string{":server CAP mocknick LS :chghost"}
+		handleCap(s, c, message{command: "CAP", params: []string{"LS", "302"}})
+		if slices.Compare(c.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", c.messagesOut, want)
+		}
+		if !c.negotiating() {
+			t.Errorf("client should be negotiating")
+		}
+	})
+
+	c.reset()
+
+	t.Run("req unknown capability", func(t *testing.T) {
+		want := []string{":server CAP mocknick NAK :chghost foo"}
+		handleCap(s, c, message{command: "CAP", params: []string{"REQ", "chghost foo"}})
+		if slices.Compare(c.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", c.messagesOut, want)
+		}
+		if c.hasCapability(capChghost) {
+			t.Errorf("capability should not be enabled")
+		}
+	})
+
+	c.reset()
+
+	t.Run("req capability", func(t *testing.T) {
+		want := []string{":server CAP mocknick ACK :chghost"}
+		handleCap(s, c, message{command: "CAP", params: []string{"REQ", "chghost"}})
+		if slices.Compare(c.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", c.messagesOut, want)
+		}
+		if !c.hasCapability(capChghost) {
+			t.Errorf("capability should be enabled")
+		}
+	})
+
+	c.reset()
+
+	t.Run("invalid subcommand", func(t *testing.T) {
+		want := []string{"410 mocknick FOO :Invalid CAP command"}
+		handleCap(s, c, message{command: "CAP", params: []string{"FOO"}})
+		if slices.Compare(c.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", c.messagesOut, want)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package ircd
+
+import (
+	"fmt"
+	"strings"
+)
+
+func handleChghost(s *Server, c clienter, m message) {
+	tc, ok := s.clients.get(m.params[0])
+	if !ok {
+		c.sendRPL(s.name, errNoSuchNick{
+			client: c.nickname(),
+			nick:   m.params[0],
+		})
+		return
+	}
+
+	hostname := m.params[1]
+	if !s.validHostname(hostname) {
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Invalid hostname %s", hostname),
+		})
+		return
+	}
+
+	s.changeHost(tc, tc.username(), hostname)
+	tc.addMode(modeClientVhost)
+
+	c.sendCommand(noticeCommand{
+		client:  c.nickname(),
+		message: fmt.Sprintf("*** Changed hostname of %s to %s", tc.nickname(), hostname),
+	})
+}
+
+func handleChgident(s *Server, c clienter, m message) {
+	tc, ok := s.clients.get(m.params[0])
+	if !ok {
+		c.sendRPL(s.name, errNoSuchNick{
+			client: c.nickname(),
+			nick:   m.params[0],
+		})
+		return
+	}
+
+	username := m.params[1]
+	if !s.validUsername(username) {
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Invalid username %s", username),
+		})
+		return
+	}
+
+	s.changeHost(tc, username, tc.hostname())
+
+	c.sendCommand(noticeCommand{
+		client:  c.nickname(),
+		message: fmt.Sprintf("*** Changed username of %s to %s", tc.nickname(), username),
+	})
+}
+
+func handleChgname(s *Server, c clienter, m message) {
+	tc, ok := s.clients.get(m.params[0])
+	if !ok {
+		c.sendRPL(s.name, errNoSuchNick{
+			client: c.nickname(),
+			nick:   m.params[0],
+		})
+		return
+	}
+
+	realname := strings.Join(m.params[1:], " ")
+	tc.setUser(tc.username(), realname)
+
+	c.sendCommand(noticeCommand{
+		client:  c.nickname(),
+		message: fmt.Sprintf("*** Changed realname of %s to %s", tc.nickname(), realname),
+	})
+}
+
+func handleSethost(s *Server, c clienter, m message) {
+	hostname := m.params[0]
+	if !s.validHostname(hostname) {
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Invalid hostname %s", hostname),
+		})
+		return
+	}
+
+	s.changeHost(c, c.username(), hostname)
+	c.addMode(modeClientVhost)
+}
@@ -0,0 +1,98 @@
+package ircd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommandChghost(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+	})
+
+	oper := newMockClient(true)
+	oper.clientID = "oper"
+	oper.nick = "oper"
+	oper.addMode(modeClientOperator)
+
+	target := newMockClient(true)
+	target.clientID = "target"
+	target.nick = "target"
+
+	modern := newMockClient(true)
+	modern.clientID = "modern"
+	modern.nick = "modern"
+	modern.setCapability(capChghost, true)
+
+	legacy := newMockClient(true)
+	legacy.clientID = "legacy"
+	legacy.nick = "legacy"
+
+	ch := newChannel("#test", "")
+	ch.clients().add(target)
+	ch.clients().add(modern)
+	ch.clients().add(legacy)
+	s.channels.add(ch.name(), ch)
+
+	s.clients.add(oper)
+	s.clients.add(target)
+
+	t.Run("invalid hostname", func(t *testing.T) {
+		want := []string{"NOTICE oper :*** Invalid hostname bad..host"}
+		handleChghost(s, oper, message{command: "CHGHOST", params: []string{"target", "bad..host"}})
+		if slices.Compare(oper.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", oper.messagesOut, want)
+		}
+	})
+
+	oper.reset()
+
+	t.Run("change hostname", func(t *testing.T) {
+		handleChghost(s, oper, message{command: "CHGHOST", params: []string{"target", "cool.vhost"}})
+
+		if target.hostname() != "cool.vhost" {
+			t.Errorf("got: %s, want: %s", target.hostname(), "cool.vhost")
+		}
+
+		want := []string{":target!mockuser@mockhost CHGHOST mockuser cool.vhost"}
+		if slices.Compare(modern.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", modern.messagesOut, want)
+		}
+
+		want = []string{
+			":target!mockuser@mockhost QUIT :Changing host",
+			":target!mockuser@cool.vhost JOIN #test",
+		}
+		if slices.Compare(legacy.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", legacy.messagesOut, want)
+		}
+
+		want = []string{"396 target cool.vhost :is now your displayed host"}
+		if slices.Compare(target.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", target.messagesOut, want)
+		}
+	})
+
+	t.Run("vhost approval", func(t *testing.T) {
+		target.reset()
+		oper.reset()
+
+		handleVhost(s, target, message{command: "VHOST", params: []string{"REQUEST", "my.vhost"}})
+		if _, ok := s.vhosts.get(target.id()); !ok {
+			t.Fatalf("request was not stored")
+		}
+
+		handleVhost(s, target, message{command: "VHOST", params: []string{"APPROVE", "target"}})
+		if target.hostname() == "my.vhost" {
+			t.Errorf("non-operator was able to approve vhost")
+		}
+
+		handleVhost(s, oper, message{command: "VHOST", params: []string{"APPROVE", "target"}})
+		if target.hostname() != "my.vhost" {
+			t.Errorf("got: %s, want: %s", target.hostname(), "my.vhost")
+		}
+		if _, ok := s.vhosts.get(target.id()); ok {
+			t.Errorf("request was not removed")
+		}
+	})
+}
@@ -1,11 +1,11 @@
 package ircd
 
-func handleInvite(s *server, c clienter, m message) {
+func handleInvite(s *Server, c clienter, m message) {
 	nickname := m.params[0]
 	channel := m.params[1]
 
 	// get target client
-	tc, ok := s.Clients.get(nickname)
+	tc, ok := s.clients.get(nickname)
 	if !ok {
 		c.sendRPL(s.name, errNoSuchNick{
 			client: c.nickname(),
@@ -15,7 +15,7 @@ func handleInvite(s *server, c clienter, m message) {
 	}
 
 	// get channel
-	ch, ok := s.Channels.get(channel)
+	ch, ok := s.channels.get(channel)
 	if !ok {
 		c.sendRPL(s.name, errNoSuchChannel{
 			client:  c.nickname(),
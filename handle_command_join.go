@@ -1,12 +1,13 @@
 package ircd
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/salimnassim/ircd/metrics"
 )
 
-func handleJoin(s *server, c clienter, m message) {
+func handleJoin(s *Server, c clienter, m message) {
 	// join can have multiple channels separated by a comma
 	targets := strings.Split(m.params[0], ",")
 
@@ -44,131 +45,205 @@ func handleJoin(s *server, c clienter, m message) {
 			continue
 		}
 
-		// ptr to existing ch or ch that will be created
-		var ch channeler
+		key := ""
+		if i < len(keys) {
+			key = keys[i]
+		}
+		joinChannel(s, c, target, key, []string{})
+	}
+}
 
-		ch, exists := s.Channels.get(target)
-		if !exists {
-			// create channel if it does not exist
-			ch = newChannel(target, c.id())
+// Joins c to channel target, creating it if it does not exist.
+//
+// Clients that can not join because they are banned, not invited or the
+// channel is full are sent to its forward target (+f) instead. forwarded
+// holds the channels already tried so forwards can not loop.
+func joinChannel(s *Server, c clienter, target string, key string, forwarded []string) {
+	// ptr to existing ch or ch that will be created
+	var ch channeler
+
+	ch, exists := s.channels.get(target)
+	if !exists {
+		// registered channels are owned by their founder account
+		owner := c.id()
+		if s.chanserv != nil && s.chanserv.registered(target) {
+			owner = ""
+		}
 
-			// todo: use channel.id instead of target
-			s.Channels.add(ch.name(), ch)
+		// create channel if it does not exist
+		ch = newChannel(target, owner)
 
-			// set default channel modes
-			ch.addMode(modeChannelNoExternal)
-			ch.addMode(modeChannelRestrictTopic)
+		// todo: use channel.id instead of target
+		s.channels.add(ch.name(), ch)
 
-			metrics.Channels.Inc()
+		// set default channel modes
+		ch.addMode(modeChannelNoExternal)
+		ch.addMode(modeChannelRestrictTopic)
+
+		if s.chanserv != nil {
+			s.chanserv.restore(ch)
 		}
 
-		// if channel has +z, do not allow joining without tls
-		if ch.hasMode(modeChannelTLSOnly) && !c.tls() {
-			c.sendCommand(noticeCommand{
+		metrics.Channels.Inc()
+	}
+
+	// if channel has +z, do not allow joining without tls
+	if ch.hasMode(modeChannelTLSOnly) && !c.tls() {
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: "Cannot join channel (+z)",
+		})
+		return
+	}
+
+	if s.banned(ch, c) {
+		if !forwardJoin(s, c, ch, forwarded) {
+			c.sendRPL(s.name, errBannedFromChan{
 				client:  c.nickname(),
-				message: "Cannot join channel (+z)",
+				channel: ch.name(),
 			})
-			return
 		}
+		return
+	}
 
-		// is channel invite only, and client does not have an invitation?
-		if ch.hasMode(modeChannelInviteOnly) && !ch.isInvited(c) {
+	// is channel invite only, and client does not have an invitation
+	// or an invite exception?
+	if ch.hasMode(modeChannelInviteOnly) && !ch.isInvited(c) && !s.inviteExempt(ch, c) {
+		if !forwardJoin(s, c, ch, forwarded) {
 			c.sendRPL(s.name, errInviteOnlyChan{
 				client:  c.nickname(),
 				channel: ch.name(),
 			})
-			return
-		} else {
-			// remove from invite map if invite is accepted
-			ch.removeInvite(c.id())
-		}
-
-		// if channel has key, compare key
-		if ch.hasMode(modeChannelKey) {
-			if len(keys) < i+1 {
-				c.sendRPL(s.name, errBadChannelKey{
-					client:  c.nickname(),
-					channel: ch.name(),
-				})
-				continue
-			}
-			if ch.key() != keys[i] {
-				c.sendRPL(s.name, errBadChannelKey{
-					client:  c.nickname(),
-					channel: ch.name(),
-				})
-				continue
-			}
 		}
+		return
+	} else {
+		// remove from invite map if invite is accepted
+		ch.removeInvite(c.id())
+	}
 
-		// add client to channel
-		ch.clients().add(c)
-
-		// broadcast to all clients on the channel
-		// that a client has joined
-		ch.broadcastCommand(joinCommand{
-			prefix:  c.prefix(),
+	// if channel has key, compare key
+	if ch.hasMode(modeChannelKey) && ch.key() != key {
+		c.sendRPL(s.name, errBadChannelKey{
+			client:  c.nickname(),
 			channel: ch.name(),
-		}, c.id(), false)
-
-		// chanowner
-		if ch.owner() == c.id() {
-			ch.clients().addMode(c, modeMemberOwner)
-			ch.broadcastCommand(modeCommand{
-				source:     s.name,
-				target:     ch.name(),
-				modestring: ch.clients().modestring(c),
-				args:       c.nickname(),
-			}, c.id(), false)
-		}
-
-		topic := ch.topic()
-		if topic.text == "" {
-			// send no topic
-			c.sendRPL(s.name, rplNoTopic{
-				client:  c.nickname(),
-				channel: ch.name(),
-			})
-		} else {
-			// send topic if not empty
-			c.sendRPL(s.name, rplTopic{
-				client:  c.nickname(),
-				channel: ch.name(),
-				topic:   topic.text,
-			})
+		})
+		return
+	}
 
-			// send time and author
-			c.sendRPL(s.name, rplTopicWhoTime{
+	// is channel full?
+	if ch.hasMode(modeChannelLimit) && ch.clients().count() >= ch.limit() {
+		if !forwardJoin(s, c, ch, forwarded) {
+			c.sendRPL(s.name, errChannelIsFull{
 				client:  c.nickname(),
 				channel: ch.name(),
-				nick:    topic.author,
-				setat:   topic.timestamp,
 			})
 		}
+		return
+	}
+
+	if !emit(s, &JoinEvent{Client: &Client{s: s, c: c}, Channel: ch.name()}) {
+		return
+	}
 
-		// get channel names (user list)
-		names := ch.names()
+	// add client to channel
+	ch.clients().add(c)
 
-		// send names to client
-		symbol := "="
-		c.sendRPL(s.name, rplNamReply{
+	// broadcast to all clients on the channel
+	// that a client has joined
+	ch.broadcastCommand(joinCommand{
+		prefix:  c.prefix(),
+		channel: ch.name(),
+	}, c.id(), false)
+
+	// chanowner
+	if ch.owner() == c.id() {
+		ch.clients().addMode(c, modeMemberOwner)
+		ch.broadcastCommand(modeCommand{
+			source:     s.name,
+			target:     ch.name(),
+			modestring: ch.clients().modestring(c),
+			args:       c.nickname(),
+		}, c.id(), false)
+	}
+
+	if s.chanserv != nil {
+		s.chanserv.automode(ch, c)
+	}
+
+	topic := ch.topic()
+	if topic.text == "" {
+		// send no topic
+		c.sendRPL(s.name, rplNoTopic{
 			client:  c.nickname(),
-			symbol:  symbol,
 			channel: ch.name(),
-			nicks:   names,
 		})
-
-		c.sendRPL(s.name, rplEndOfNames{
+	} else {
+		// send topic if not empty
+		c.sendRPL(s.name, rplTopic{
 			client:  c.nickname(),
 			channel: ch.name(),
+			topic:   topic.text,
 		})
 
-		// send current channel modes to client
-		c.sendCommand(modeCommand{
-			source:     s.name,
-			target:     ch.name(),
-			modestring: ch.modestring(),
-			args:       "",
+		// send time and author
+		c.sendRPL(s.name, rplTopicWhoTime{
+			client:  c.nickname(),
+			channel: ch.name(),
+			nick:    topic.author,
+			setat:   topic.timestamp,
 		})
 	}
+
+	// get channel names (user list)
+	names := ch.names()
+
+	// send names to client
+	symbol := "="
+	c.sendRPL(s.name, rplNamReply{
+		client:  c.nickname(),
+		symbol:  symbol,
+		channel: ch.name(),
+		nicks:   names,
+	})
+
+	c.sendRPL(s.name, rplEndOfNames{
+		client:  c.nickname(),
+		channel: ch.name(),
+	})
+
+	// send current channel modes to client, the client is now a member so
+	// the key and limit are included
+	c.sendCommand(modeCommand{
+		source:     s.name,
+		target:     ch.name(),
+		modestring: ch.modestring(),
+		args:       strings.Join(channelModeArgs(ch), " "),
+	})
+}
+
+// Sends c to the forward target of ch with ERR_LINKCHANNEL. Returns false
+// if ch does not forward, the target does not exist, c is already on it or
+// it was already tried.
+func forwardJoin(s *Server, c clienter, ch channeler, forwarded []string) bool {
+	if !ch.hasMode(modeChannelForward) {
+		return false
+	}
+	target, exists := s.channels.get(ch.forward())
+	if !exists || target.clients().isMember(c) {
+		return false
+	}
+	forwarded = append(forwarded, ch.name())
+	if slices.ContainsFunc(forwarded, func(name string) bool {
+		return strings.EqualFold(name, target.name())
+	}) {
+		return false
+	}
+
+	c.sendRPL(s.name, errLinkChannel{
+		client:  c.nickname(),
+		channel: ch.name(),
+		target:  target.name(),
+	})
+	joinChannel(s, c, target.name(), "", forwarded)
+	return true
 }
@@ -2,10 +2,10 @@ package ircd
 
 import "strings"
 
-func handleKick(s *server, c clienter, m message) {
+func handleKick(s *Server, c clienter, m message) {
 	channel := m.params[0]
 
-	ch, ok := s.Channels.get(channel)
+	ch, ok := s.channels.get(channel)
 	if !ok {
 		c.sendRPL(s.name, errNoSuchChannel{
 			client:  c.nickname(),
@@ -42,7 +42,7 @@ func handleKick(s *server, c clienter, m message) {
 
 	targets := strings.Split(m.params[1], ",")
 	for _, target := range targets {
-		tc, ok := s.Clients.get(target)
+		tc, ok := s.clients.get(target)
 		// no matching client found
 		if !ok {
 			c.sendRPL(s.name, errUserNotInChannel{
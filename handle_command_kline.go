@@ -0,0 +1,127 @@
+package ircd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KLINE [minutes] <user@host | nick> [reason]
+//
+// KLINE LIST shows active bans. A nickname bans *@ the real hostname of the
+// client using it. The host may be a CIDR range such as 192.0.2.0/24.
+func handleKline(s *Server, c clienter, m message) {
+	params := m.params
+
+	if strings.ToUpper(params[0]) == "LIST" && len(params) == 1 {
+		for _, ban := range s.bans.all(s.now()) {
+			expires := "never"
+			if !ban.Expires.IsZero() {
+				expires = ban.Expires.Sub(s.now()).Round(time.Second).String()
+			}
+			c.sendCommand(noticeCommand{
+				client:  c.nickname(),
+				message: fmt.Sprintf("*** K-line %s set by %s expires %s: %s", ban.Mask, ban.Setter, expires, ban.Reason),
+			})
+		}
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: "*** End of K-lines",
+		})
+		return
+	}
+
+	duration := time.Duration(0)
+	if minutes, err := strconv.Atoi(params[0]); err == nil && len(params) > 1 {
+		if minutes < 0 {
+			minutes = 0
+		}
+		duration = time.Duration(minutes) * time.Minute
+		params = params[1:]
+	}
+
+	mask := params[0]
+	if !strings.Contains(mask, "@") {
+		tc, ok := s.clients.get(mask)
+		if !ok {
+			c.sendRPL(s.name, errNoSuchNick{
+				client: c.nickname(),
+				nick:   mask,
+			})
+			return
+		}
+		mask = "*@" + tc.realhost()
+	}
+	if _, err := parseHostMask(s.casemapping, mask); err != nil {
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Invalid mask %s", mask),
+		})
+		return
+	}
+
+	reason := strings.Join(params[1:], " ")
+	if reason == "" {
+		reason = "No reason"
+	}
+
+	ban := serverBan{
+		Mask:   strings.ToLower(mask),
+		Reason: reason,
+		Setter: c.nickname(),
+		Set:    s.now(),
+	}
+	if duration > 0 {
+		ban.Expires = ban.Set.Add(duration)
+	}
+
+	err := s.bans.add(ban)
+	if err != nil {
+		s.log.Error().Err(err).Msgf("cant save k-line %s", ban.Mask)
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Could not save K-line for %s", ban.Mask),
+		})
+		return
+	}
+
+	c.sendCommand(noticeCommand{
+		client:  c.nickname(),
+		message: fmt.Sprintf("*** Added K-line for %s: %s", ban.Mask, ban.Reason),
+	})
+
+	// disconnect everyone already connected from the banned host
+	for _, tc := range s.clients.all() {
+		if !tc.handshake() || !ban.matches(s.casemapping, tc) {
+			continue
+		}
+		tc.sendRPL(s.name, errYoureBannedCreep{
+			client: tc.nickname(),
+			reason: ban.Reason,
+		})
+		tc.kill(fmt.Sprintf("K-lined: %s", ban.Reason))
+	}
+}
+
+// UNKLINE <user@host>
+func handleUnkline(s *Server, c clienter, m message) {
+	mask := strings.ToLower(m.params[0])
+
+	err := s.bans.remove(mask)
+	if err == errorServerBanDoesNotExist {
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** No K-line for %s", mask),
+		})
+		return
+	}
+	if err != nil {
+		s.log.Error().Err(err).Msgf("cant remove k-line %s", mask)
+	}
+
+	c.sendCommand(noticeCommand{
+		client:  c.nickname(),
+		message: fmt.Sprintf("*** Removed K-line for %s", mask),
+	})
+}
@@ -0,0 +1,208 @@
+package ircd
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCommandKline(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewServer(ServerConfig{Name: "server"}, WithClock(func() time.Time { return now }))
+
+	oper := newMockClient(true)
+	oper.clientID = "oper"
+	oper.nick = "oper"
+	oper.rhost = "oper.example.com"
+	oper.addMode(modeClientOperator)
+	s.clients.add(oper)
+
+	target := newMockClient(true)
+	target.clientID = "target"
+	target.nick = "target"
+	target.user = "~evil"
+	target.rhost = "bad.example.com"
+	s.clients.add(target)
+
+	handleKline(s, oper, message{command: "KLINE", params: []string{"10", "*@bad.example.com", "go", "away"}})
+
+	want := []string{"NOTICE oper :*** Added K-line for *@bad.example.com: go away"}
+	if slices.Compare(oper.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", oper.messagesOut, want)
+	}
+	want = []string{"K-lined: go away"}
+	if slices.Compare(target.messagesKill, want) != 0 {
+		t.Errorf("got: %v, want: %v", target.messagesKill, want)
+	}
+	if len(oper.messagesKill) != 0 {
+		t.Errorf("oper was killed: %v", oper.messagesKill)
+	}
+
+	tcs := []struct {
+		name   string
+		host   string
+		after  time.Duration
+		banned bool
+	}{
+		{"matching host", "bad.example.com", 0, true},
+		{"other host", "good.example.com", 0, false},
+		{"expired", "bad.example.com", 10 * time.Minute, false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newMockClient(false)
+			c.rhost = tc.host
+			_, banned := s.bans.match(c, s.casemapping, now.Add(tc.after))
+			if banned != tc.banned {
+				t.Errorf("got: %t, want: %t", banned, tc.banned)
+			}
+		})
+	}
+
+	oper.reset()
+	handleUnkline(s, oper, message{command: "UNKLINE", params: []string{"*@BAD.example.com"}})
+	want = []string{"NOTICE oper :*** Removed K-line for *@bad.example.com"}
+	if slices.Compare(oper.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", oper.messagesOut, want)
+	}
+	if len(s.bans.all(now)) != 0 {
+		t.Error("ban was not removed")
+	}
+}
+
+func TestServerBanCIDR(t *testing.T) {
+	c := newMockClient(true)
+	c.addr = "192.0.2.44"
+
+	tcs := []struct {
+		mask string
+		want bool
+	}{
+		{"*@192.0.2.0/24", true},
+		{"mockuser@192.0.2.0/28", false},
+		{"MOCKUSER@192.0.2.32/28", true},
+		{"*@198.51.100.0/24", false},
+		{"*@2001:db8::/32", false},
+	}
+
+	for _, tc := range tcs {
+		got := serverBan{Mask: tc.mask}.matches(casemappingASCII, c)
+		if got != tc.want {
+			t.Errorf("%s: got: %t, want: %t", tc.mask, got, tc.want)
+		}
+	}
+}
+
+func TestHandshakeKline(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+	s.bans.add(serverBan{Mask: "*@127.0.0.1", Reason: "no"})
+
+	c := newMockClient(false)
+	c.nick = "nick"
+	handleHandshake(s, c, s.defaultClass)
+
+	want := []string{"465 nick :You are banned from this server: no"}
+	if !slices.Contains(c.messagesOut, want[0]) {
+		t.Errorf("got: %v, want: %v", c.messagesOut, want)
+	}
+	want = []string{"K-lined: no"}
+	if slices.Compare(c.messagesKill, want) != 0 {
+		t.Errorf("got: %v, want: %v", c.messagesKill, want)
+	}
+	if c.handshake() {
+		t.Error("banned client completed handshake")
+	}
+}
+
+func TestCommandKlineVirtualClient(t *testing.T) {
+	s := newHookServer()
+
+	oper := newMockClient(true)
+	oper.addMode(modeClientOperator)
+	s.clients.add(oper)
+
+	bot, err := s.NewVirtualClient(VirtualClientConfig{Nickname: "bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handleKline(s, oper, message{command: "KLINE", params: []string{"*@127.0.0.1", "services"}})
+	handleKline(s, oper, message{command: "KLINE", params: []string{"*@server", "services"}})
+
+	if reason := bot.c.quitReason(); reason != "" {
+		t.Errorf("virtual client was killed: %s", reason)
+	}
+}
+
+func TestServerBanStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := OpenServerBanStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.add(serverBan{Mask: "*@Example.com", Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	bs, err = OpenServerBanStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bans := bs.all(time.Now())
+	if len(bans) != 1 || bans[0].Mask != "*@example.com" || bans[0].Reason != "spam" {
+		t.Errorf("got: %v", bans)
+	}
+}
+
+func TestServerBanStoreExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := OpenServerBanStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	bs.add(serverBan{Mask: "*@old.example.com", Set: now.Add(-time.Hour), Expires: now.Add(-time.Minute)})
+	bs.add(serverBan{Mask: "*@stale.example.com", Set: now.Add(-time.Hour), Expires: now.Add(-30 * time.Minute)})
+	// adding a ban deletes bans that expired before it was set
+	bs.add(serverBan{Mask: "*@new.example.com", Set: now.Add(-10 * time.Minute), Expires: now.Add(time.Hour)})
+
+	want := []string{"kline/*@new.example.com", "kline/*@old.example.com"}
+	if keys := db.keys("kline/"); slices.Compare(keys, want) != 0 {
+		t.Errorf("got: %v, want: %v", keys, want)
+	}
+
+	// opening the store deletes bans that have expired since
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = OpenServerBanStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"kline/*@new.example.com"}
+	if keys := db.keys("kline/"); slices.Compare(keys, want) != 0 {
+		t.Errorf("got: %v, want: %v", keys, want)
+	}
+}
@@ -1,12 +1,12 @@
 package ircd
 
-func handleList(s *server, c clienter, m message) {
+func handleList(s *Server, c clienter, m message) {
 	// if no params, list all channels
 	if len(m.params) == 0 {
 		c.sendRPL(s.name, rplListStart{
 			client: c.nickname(),
 		})
-		for _, ch := range s.Channels.all() {
+		for _, ch := range s.channels.all() {
 			if ch.hasMode(modeChannelSecret) {
 				continue
 			}
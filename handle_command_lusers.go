@@ -1,7 +1,7 @@
 package ircd
 
-func handleLusers(s *server, c clienter, m message) {
-	visible, invisible, channels := s.Stats()
+func handleLusers(s *Server, c clienter, m message) {
+	visible, invisible, unknown, channels := s.Stats()
 
 	c.sendRPL(s.name, rplLuserClient{
 		client:    c.nickname(),
@@ -13,6 +13,12 @@ func handleLusers(s *server, c clienter, m message) {
 		client: c.nickname(),
 		ops:    0,
 	})
+	if unknown > 0 {
+		c.sendRPL(s.name, rplLuserUnknown{
+			client:      c.nickname(),
+			connections: unknown,
+		})
+	}
 	c.sendRPL(s.name, rplLuserChannels{
 		client:   c.nickname(),
 		channels: channels,
@@ -0,0 +1,31 @@
+package ircd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommandLusers(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+	})
+
+	c := newMockClient(true)
+	s.clients.add(c)
+
+	unregistered := newMockClient(false)
+	unregistered.clientID = "67890"
+	s.clients.add(unregistered)
+
+	handleLusers(s, c, message{command: "LUSERS"})
+
+	want := []string{
+		"251 mocknick :There are 1 users (0 invisible) on 1 servers",
+		"252 mocknick 0 :operator(s) online",
+		"253 mocknick 1 :unknown connection(s)",
+		"254 mocknick 0 :channels formed.",
+	}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", c.messagesOut, want)
+	}
+}
@@ -1,6 +1,20 @@
 package ircd
 
-func handleMode(s *server, c clienter, m message) {
+func handleMode(s *Server, c clienter, m message) {
+	// let subscribers inspect and rewrite changes, queries are not events
+	if len(m.params) >= 2 {
+		event := &ModeEvent{
+			Client: &Client{s: s, c: c},
+			Target: m.params[0],
+			Modes:  m.params[1],
+			Args:   m.params[2:],
+		}
+		if !emit(s, event) {
+			return
+		}
+		m.params = append([]string{m.params[0], event.Modes}, event.Args...)
+	}
+
 	if !m.isTargetChannel() {
 		handleModeClient(s, c, m)
 		return
@@ -8,6 +22,13 @@ func handleMode(s *server, c clienter, m message) {
 
 	if m.isTargetChannel() {
 		handleModeChannel(s, c, m)
+
+		// keep settings of registered channels
+		if len(m.params) >= 2 && s.chanserv != nil {
+			if ch, exists := s.channels.get(m.params[0]); exists {
+				s.chanserv.save(ch)
+			}
+		}
 		return
 	}
 }
@@ -1,25 +1,69 @@
 package ircd
 
 import (
-	"fmt"
+	"cmp"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func handleModeChannel(s *server, c clienter, m message) {
-	target := m.params[0]
+// Requested change of a channel mode.
+type channelModeChange struct {
+	add  bool
+	mode rune
+	// Empty if the mode does not take a parameter.
+	arg string
+}
 
-	modestring := ""
-	if len(m.params) >= 2 {
-		modestring = m.params[1]
-	}
+// Applies change to ch, returns false if the channel did not change.
+//
+// Handlers may rewrite change.arg to what is shown in the MODE line.
+type channelModeHandler func(s *Server, c clienter, ch channeler, change *channelModeChange) bool
 
-	modeargs := ""
-	if len(m.params) >= 3 {
-		modeargs = strings.Join(m.params[2:len(m.params)], " ")
-	}
+// Sends the entries of a list mode to c.
+type channelModeLister func(s *Server, c clienter, ch channeler)
+
+// Replies to list mode queries such as MODE #channel b.
+var channelModeListers = map[rune]channelModeLister{
+	'b': listBans,
+	'e': listExceptions,
+	'I': listInviteExceptions,
+}
+
+// Implemented channel modes.
+//
+// Modes that are not classified by CHANMODES or PREFIX are unknown even if
+// they are implemented here, and the other way around.
+var channelModeHandlers = map[rune]channelModeHandler{
+	'b': modeHandlerList('b'),
+	'e': modeHandlerList('e'),
+	'I': modeHandlerList('I'),
+	'k': modeHandlerKey,
+	'l': modeHandlerLimit,
+	'f': modeHandlerForward,
+	'C': modeHandlerFlag(modeChannelNoCTCP),
+	'i': modeHandlerFlag(modeChannelInviteOnly),
+	'm': modeHandlerFlag(modeChannelModerated),
+	'n': modeHandlerFlag(modeChannelNoExternal),
+	'O': modeHandlerFlag(modeChannelOpsOnly),
+	'p': modeHandlerFlag(modeChannelPrivate),
+	'R': modeHandlerFlag(modeChannelRegisteredOnly),
+	's': modeHandlerFlag(modeChannelSecret),
+	't': modeHandlerFlag(modeChannelRestrictTopic),
+	'z': modeHandlerFlag(modeChannelTLSOnly),
+	'r': modeHandlerReadOnly,
+	'v': modeHandlerPrefix(modeMemberVoice),
+	'h': modeHandlerPrefix(modeMemberHalfOperator),
+	'o': modeHandlerPrefix(modeMemberOperator),
+	'a': modeHandlerPrefix(modeMemberAdmin),
+	'q': modeHandlerPrefix(modeMemberOwner),
+}
+
+func handleModeChannel(s *Server, c clienter, m message) {
+	target := m.params[0]
 
-	ch, ok := s.Channels.get(target)
+	ch, ok := s.channels.get(target)
 	// does it exist?
 	if !ok {
 		c.sendRPL(s.name, errNoSuchChannel{
@@ -29,17 +73,40 @@ func handleModeChannel(s *server, c clienter, m message) {
 		return
 	}
 
-	// return modes if modestring is not set
-	if modestring == "" {
+	// return modes if modestring is not set, the key and limit are only
+	// shown to members
+	if len(m.params) < 2 || m.params[1] == "" {
+		modeargs := ""
+		if ch.clients().isMember(c) {
+			modeargs = strings.Join(channelModeArgs(ch), " ")
+		}
 		c.sendRPL(s.name, rplChannelModeIs{
 			client:     c.nickname(),
 			channel:    ch.name(),
 			modestring: ch.modestring(),
-			modeargs:   "",
+			modeargs:   modeargs,
 		})
 		return
 	}
 
+	changes, queries := parseChannelModeChanges(s, c, m.params[1], m.params[2:])
+
+	// anyone who can see the channel can list its masks
+	for _, mode := range queries {
+		if ch.hasMode(modeChannelSecret) && !ch.clients().isMember(c) {
+			c.sendRPL(s.name, errNotOnChannel{
+				client:  c.nickname(),
+				channel: ch.name(),
+			})
+			break
+		}
+		channelModeListers[mode](s, c, ch)
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
 	// client must be a member of the channel
 	if !ch.clients().isMember(c) {
 		c.sendRPL(s.name, errNotOnChannel{
@@ -58,259 +125,488 @@ func handleModeChannel(s *server, c clienter, m message) {
 		return
 	}
 
-	// settings channel mode
-	if modeargs == "" {
-		before := ch.mode()
-		// parse modestring
-		add, del := parseModestring[channelMode](modestring, channelModeMap)
-		for _, a := range add {
-			switch a {
-			case modeChannelModerated:
-				ch.addMode(a)
-			case modeChannelTLSOnly:
-				ch.addMode(a)
-			case modeChannelSecret:
-				ch.addMode(a)
-			case modeChannelRestrictTopic:
-				ch.addMode(a)
-			case modeChannelInviteOnly:
-				ch.addMode(a)
-			}
-		}
-		for _, d := range del {
-			switch d {
-			case modeChannelModerated:
-				ch.removeMode(d)
-			case modeChannelTLSOnly:
-				ch.removeMode(d)
-			case modeChannelSecret:
-				ch.removeMode(d)
-			case modeChannelRestrictTopic:
-				ch.removeMode(d)
-			case modeChannelInviteOnly:
-				ch.removeMode(d)
-			case modeChannelKey:
-				ch.removeMode(d)
-			}
+	applied := []channelModeChange{}
+	for _, change := range changes {
+		if channelModeHandlers[change.mode](s, c, ch, &change) {
+			applied = append(applied, change)
 		}
-		after := ch.mode()
+	}
+	if len(applied) == 0 {
+		return
+	}
+
+	modestring, args := formatChannelModeChanges(applied)
+	ch.broadcastCommand(modeCommand{
+		source:     c.prefix(),
+		target:     ch.name(),
+		modestring: modestring,
+		args:       strings.Join(args, " "),
+	}, c.id(), false)
+}
 
-		plus := []rune{}
-		minus := []rune{}
+// Splits modestring into changes, taking parameters from args in order.
+// List modes without a parameter are returned as queries.
+//
+// Unknown modes are reported to c. Changes with a missing parameter and
+// changes over the MODES limit are dropped.
+func parseChannelModeChanges(s *Server, c clienter, modestring string, args []string) (changes []channelModeChange, queries []rune) {
+	changes = []channelModeChange{}
+	queries = []rune{}
+	add := true
+	// changes with a parameter, limited by MODES
+	withArg := 0
 
-		// diff before and after, add +- if there are changes
-		da, dd := diffModes[channelMode](before, after, channelModeMap)
-		if len(da) == 0 && len(dd) == 0 {
-			return
+	for _, r := range modestring {
+		switch r {
+		case '+':
+			add = true
+			continue
+		case '-':
+			add = false
+			continue
 		}
 
-		if len(da) > 0 {
-			plus = append(plus, '+')
-		}
-		if len(dd) > 0 {
-			minus = append(minus, '-')
+		kind, known := s.channelModes[r]
+		if _, implemented := channelModeHandlers[r]; !known || !implemented {
+			c.sendRPL(s.name, errUnknownMode{
+				client:   c.nickname(),
+				modechar: r,
+			})
+			continue
 		}
 
-		// refactor this o-no bueno
-		for _, m := range da {
-			for r, mm := range channelModeMap {
-				if m == mm {
-					plus = append(plus, r)
+		change := channelModeChange{add: add, mode: r}
+
+		if kind != channelModeTypeFlag && (kind != channelModeTypeSetParam || add) {
+			if len(args) == 0 {
+				_, listable := channelModeListers[r]
+				if kind == channelModeTypeList && listable && !slices.Contains(queries, r) {
+					queries = append(queries, r)
 				}
+				continue
 			}
-		}
-		for _, m := range dd {
-			for r, mm := range channelModeMap {
-				if m == mm {
-					minus = append(minus, r)
-				}
+			change.arg = args[0]
+			args = args[1:]
+
+			if s.parameters.MaxModes > 0 && withArg >= s.parameters.MaxModes {
+				continue
 			}
+			withArg++
 		}
 
-		diff := ""
-		if len(minus) > 0 {
-			diff = fmt.Sprintf("%s%s", diff, string(minus))
+		changes = append(changes, change)
+	}
+
+	return changes, queries
+}
+
+// Joins changes into one modestring and its parameters.
+//
+// Example: +k key, -v nick, -o nick becomes +k-vo and [key nick nick]
+func formatChannelModeChanges(changes []channelModeChange) (string, []string) {
+	modestring := strings.Builder{}
+	args := []string{}
+	sign := ' '
+
+	for _, change := range changes {
+		want := '-'
+		if change.add {
+			want = '+'
 		}
-		if len(plus) > 0 {
-			diff = fmt.Sprintf("%s%s", diff, string(plus))
+		if want != sign {
+			modestring.WriteRune(want)
+			sign = want
 		}
+		modestring.WriteRune(change.mode)
+		if change.arg != "" {
+			args = append(args, change.arg)
+		}
+	}
 
-		ch.broadcastCommand(modeCommand{
-			source:     c.prefix(),
-			target:     ch.name(),
-			modestring: diff,
-			args:       "",
-		}, c.id(), false)
-		return
+	return modestring.String(), args
+}
+
+func modeHandlerFlag(mode channelMode) channelModeHandler {
+	return func(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+		if ch.hasMode(mode) == change.add {
+			return false
+		}
+		if change.add {
+			ch.addMode(mode)
+		} else {
+			ch.removeMode(mode)
+		}
+		return true
 	}
+}
 
-	if modeargs != "" {
-		// split target clients from modeargs
-		tcs := strings.Split(modeargs, " ")
-
-		// todo check for a,b,c... type modes
-		addm, _ := parseModestring[channelMode](modestring, channelModeMap)
-		if slices.Contains(addm, modeChannelKey) {
-			for i, mode := range addm {
-				if len(tcs) < i {
-					c.sendRPL(s.name, errNeedMoreParams{
-						client:  c.nickname(),
-						command: m.command,
-					})
-					return
-				}
-				switch mode {
-				case modeChannelKey:
-					ch.setKey(tcs[i])
-					ch.addMode(modeChannelKey)
-				}
+// Modes only set by the server, such as +r by ChanServ.
+func modeHandlerReadOnly(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+	return false
+}
 
-				ch.broadcastCommand(modeCommand{
-					source:     c.prefix(),
-					target:     ch.name(),
-					modestring: fmt.Sprintf("+%c", runeByMode[channelMode](modeChannelKey, channelModeMap)),
-					args:       tcs[i],
-				}, c.id(), false)
-			}
-			return
+// Parameters of the modes in the modestring of ch, in the same order.
+//
+// Example: +fklnt becomes [#overflow key 10]
+func channelModeArgs(ch channeler) []string {
+	args := []string{}
+	for _, r := range ch.modestring() {
+		switch r {
+		case 'k':
+			args = append(args, ch.key())
+		case 'l':
+			args = append(args, strconv.Itoa(ch.limit()))
+		case 'f':
+			args = append(args, ch.forward())
 		}
+	}
+	return args
+}
 
-		// todo: client can change mode only for user that is below their bitmask
-		// todo: refactor this
+// +k key sets or replaces the key, -k key removes it if key matches.
+func modeHandlerKey(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+	if !change.add {
+		if !ch.hasMode(modeChannelKey) || ch.key() != change.arg {
+			return false
+		}
+		ch.setKey("")
+		ch.removeMode(modeChannelKey)
+		// the old key is not shown
+		change.arg = "*"
+		return true
+	}
 
-		type tmc struct {
-			nick string
-			mode string
+	// keys are comma separated in JOIN
+	if change.arg == "" || strings.ContainsAny(change.arg, ", ") {
+		c.sendRPL(s.name, errInvalidModeParam{
+			client:      c.nickname(),
+			target:      ch.name(),
+			modechar:    change.mode,
+			parameter:   change.arg,
+			description: "Invalid key",
+		})
+		return false
+	}
+	if ch.hasMode(modeChannelKey) && ch.key() == change.arg {
+		return false
+	}
+	ch.setKey(change.arg)
+	ch.addMode(modeChannelKey)
+	return true
+}
+
+// +l limit sets the number of members that can join, -l takes no parameter.
+func modeHandlerLimit(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+	if !change.add {
+		if !ch.hasMode(modeChannelLimit) {
+			return false
 		}
+		ch.setLimit(0)
+		ch.removeMode(modeChannelLimit)
+		return true
+	}
 
-		// parse modestring
-		tcm := []tmc{}
-		add, del := parseModestring[channelMembershipMode](modestring, channelMembershipModeMap)
-		for i, mode := range add {
-			if len(tcs) < i {
-				c.sendRPL(s.name, errNeedMoreParams{
-					client:  c.nickname(),
-					command: m.command,
-				})
-				return
-			}
-			tc, exists := s.Clients.get(tcs[i])
-			if !exists {
-				c.sendRPL(s.name, errNoSuchNick{
-					client: c.nickname(),
-					nick:   tcs[i],
-				})
-				return
-			}
-			if !ch.clients().isMember(tc) {
-				c.sendRPL(s.name, errUserNotInChannel{
-					client:  c.nickname(),
-					nick:    tcs[i],
-					channel: ch.name(),
-				})
-				return
-			}
-			switch mode {
-			case modeMemberVoice:
-				ch.clients().addMode(tc, modeMemberVoice)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("+%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			case modeMemberHalfOperator:
-				ch.clients().addMode(tc, modeMemberHalfOperator)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("+%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			case modeMemberOperator:
-				ch.clients().addMode(tc, modeMemberOperator)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("+%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			case modeMemberAdmin:
-				ch.clients().addMode(tc, modeMemberAdmin)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("+%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			}
+	limit, err := strconv.Atoi(change.arg)
+	if err != nil || limit <= 0 {
+		c.sendRPL(s.name, errInvalidModeParam{
+			client:      c.nickname(),
+			target:      ch.name(),
+			modechar:    change.mode,
+			parameter:   change.arg,
+			description: "Invalid limit",
+		})
+		return false
+	}
+	if ch.hasMode(modeChannelLimit) && ch.limit() == limit {
+		return false
+	}
+	ch.setLimit(limit)
+	ch.addMode(modeChannelLimit)
+	change.arg = strconv.Itoa(limit)
+	return true
+}
+
+// +f channel forwards clients who can not join to channel, where the setter
+// has to be an operator. -f takes no parameter.
+func modeHandlerForward(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+	if !change.add {
+		if !ch.hasMode(modeChannelForward) {
+			return false
 		}
+		ch.setForward("")
+		ch.removeMode(modeChannelForward)
+		return true
+	}
 
-		for i, mode := range del {
-			if len(tcs) < i {
-				c.sendRPL(s.name, errNeedMoreParams{
-					client:  c.nickname(),
-					command: m.command,
-				})
-				return
-			}
-			tc, exists := s.Clients.get(tcs[i])
-			if !exists {
-				c.sendRPL(s.name, errNoSuchNick{
-					client: c.nickname(),
-					nick:   tcs[i],
-				})
-				return
-			}
-			if !ch.clients().isMember(tc) {
-				c.sendRPL(s.name, errUserNotInChannel{
-					client:  c.nickname(),
-					nick:    tcs[i],
-					channel: ch.name(),
-				})
-				return
-			}
-			switch mode {
-			case modeMemberVoice:
-				ch.clients().removeMode(tc, modeMemberVoice)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("-%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			case modeMemberHalfOperator:
-				ch.clients().removeMode(tc, modeMemberHalfOperator)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("-%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			case modeMemberOperator:
-				ch.clients().removeMode(tc, modeMemberOperator)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("-%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
-			case modeMemberAdmin:
-				ch.clients().removeMode(tc, modeMemberAdmin)
-				tcm = append(tcm, tmc{
-					nick: tc.nickname(),
-					mode: fmt.Sprintf("-%c", runeByMode[channelMembershipMode](mode, channelMembershipModeMap)),
-				})
+	if strings.EqualFold(change.arg, ch.name()) {
+		c.sendRPL(s.name, errInvalidModeParam{
+			client:      c.nickname(),
+			target:      ch.name(),
+			modechar:    change.mode,
+			parameter:   change.arg,
+			description: "Channel can not forward to itself",
+		})
+		return false
+	}
+	target, exists := s.channels.get(change.arg)
+	if !exists {
+		c.sendRPL(s.name, errNoSuchChannel{
+			client:  c.nickname(),
+			channel: change.arg,
+		})
+		return false
+	}
+	if !target.clients().hasMode(c, modeMemberOperator, modeMemberAdmin, modeMemberOwner) {
+		c.sendRPL(s.name, errChanoPrivsNeeded{
+			client:  c.nickname(),
+			channel: target.name(),
+		})
+		return false
+	}
+
+	if ch.hasMode(modeChannelForward) && ch.forward() == target.name() {
+		return false
+	}
+	ch.setForward(target.name())
+	ch.addMode(modeChannelForward)
+	change.arg = target.name()
+	return true
+}
+
+func modeHandlerList(mode rune) channelModeHandler {
+	return func(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+		duration, arg := splitListDuration(change.arg)
+		mask, valid := normalizeListMask(arg)
+		if !valid {
+			c.sendRPL(s.name, errInvalidModeParam{
+				client:      c.nickname(),
+				target:      ch.name(),
+				modechar:    mode,
+				parameter:   change.arg,
+				description: "Invalid mask",
+			})
+			return false
+		}
+
+		if !change.add {
+			entry, err := ch.removeListEntry(mode, mask)
+			if err != nil {
+				return false
 			}
+			change.arg = entry.Mask
+			return true
+		}
+
+		if s.listFull(ch, mode) {
+			c.sendRPL(s.name, errBanListFull{
+				client:  c.nickname(),
+				channel: ch.name(),
+				mode:    mode,
+			})
+			return false
 		}
 
-		if len(tcm) == 0 {
-			return
+		entry := listEntry{
+			Mask:   mask,
+			Setter: c.prefix(),
+			Set:    s.now(),
 		}
+		if duration > 0 {
+			entry.Expires = entry.Set.Add(duration)
+		}
+		err := ch.addListEntry(mode, entry)
+		if err != nil {
+			return false
+		}
+		s.scheduleListExpiry(ch, mode, entry)
+		change.arg = mask
+		return true
+	}
+}
+
+// Splits a timed list mode parameter such as 30m:*!*@host into its duration
+// and mask. Parameters without a positive duration are returned as they are.
+func splitListDuration(arg string) (time.Duration, string) {
+	prefix, mask, ok := strings.Cut(arg, ":")
+	if !ok || mask == "" {
+		return 0, arg
+	}
+	duration, err := time.ParseDuration(prefix)
+	if err != nil || duration <= 0 {
+		return 0, arg
+	}
+	return duration, mask
+}
+
+// Removes entry from list mode of ch once it expires.
+func (s *Server) scheduleListExpiry(ch channeler, mode rune, entry listEntry) {
+	if entry.Expires.IsZero() {
+		return
+	}
+	timer := time.AfterFunc(entry.Expires.Sub(s.now()), func() {
+		s.expireListEntry(ch, mode, entry)
+	})
+	ch.setListTimer(mode, entry.Mask, timer)
+}
 
-		modeNicknames := []string{}
-		modeModes := []string{}
+// Stops list entry timers of every channel, entries are no longer expired by
+// this server.
+func (s *Server) stopListTimers() {
+	for _, ch := range s.channels.all() {
+		ch.stopListTimers()
+	}
+}
 
-		for _, t := range tcm {
-			modeNicknames = append(modeNicknames, t.nick)
-			modeModes = append(modeModes, t.mode)
+// Removes entry from list mode of ch and announces it with a MODE from the
+// server. Returns false if the entry was removed or set again since.
+func (s *Server) expireListEntry(ch channeler, mode rune, entry listEntry) bool {
+	i := slices.IndexFunc(ch.listEntries(mode), func(e listEntry) bool {
+		return strings.EqualFold(e.Mask, entry.Mask) && e.Expires.Equal(entry.Expires)
+	})
+	if i < 0 {
+		return false
+	}
+	removed, err := ch.removeListEntry(mode, entry.Mask)
+	if err != nil {
+		return false
+	}
+
+	ch.broadcastCommand(modeCommand{
+		source:     s.name,
+		target:     ch.name(),
+		modestring: "-" + string(mode),
+		args:       removed.Mask,
+	}, "", false)
+	if s.chanserv != nil {
+		s.chanserv.save(ch)
+	}
+	return true
+}
+
+// Time left until entry expires, empty if it does not expire.
+func (s *Server) listEntryExpires(entry listEntry) string {
+	if entry.Expires.IsZero() {
+		return ""
+	}
+	return max(entry.Expires.Sub(s.now()), 0).Round(time.Second).String()
+}
+
+// Has list mode on ch reached its MAXLIST limit?
+func (s *Server) listFull(ch channeler, mode rune) bool {
+	for _, limit := range s.listLimits {
+		if !strings.ContainsRune(limit.modes, mode) {
+			continue
 		}
+		count := 0
+		for _, m := range limit.modes {
+			count += len(ch.listEntries(m))
+		}
+		return count >= limit.limit
+	}
+	return len(ch.listEntries(mode)) >= defaultMaxList
+}
 
-		ch.broadcastCommand(modeCommand{
-			source:     c.prefix(),
-			target:     ch.name(),
-			modestring: strings.Join(modeModes, ""),
-			args:       strings.Join(modeNicknames, " "),
-		}, c.id(), false)
-		// for i, d := range del {
+func listBans(s *Server, c clienter, ch channeler) {
+	for _, entry := range ch.listEntries('b') {
+		c.sendRPL(s.name, rplBanList{
+			client:  c.nickname(),
+			channel: ch.name(),
+			mask:    entry.Mask,
+			who:     cmp.Or(entry.Setter, s.name),
+			setTS:   entry.Set.Unix(),
+			expires: s.listEntryExpires(entry),
+		})
+	}
+	c.sendRPL(s.name, rplEndOfBanList{
+		client:  c.nickname(),
+		channel: ch.name(),
+	})
+}
 
-		// }
+func listExceptions(s *Server, c clienter, ch channeler) {
+	for _, entry := range ch.listEntries('e') {
+		c.sendRPL(s.name, rplExceptList{
+			client:  c.nickname(),
+			channel: ch.name(),
+			mask:    entry.Mask,
+			who:     cmp.Or(entry.Setter, s.name),
+			setTS:   entry.Set.Unix(),
+			expires: s.listEntryExpires(entry),
+		})
 	}
+	c.sendRPL(s.name, rplEndOfExceptList{
+		client:  c.nickname(),
+		channel: ch.name(),
+	})
+}
 
+func listInviteExceptions(s *Server, c clienter, ch channeler) {
+	for _, entry := range ch.listEntries('I') {
+		c.sendRPL(s.name, rplInviteList{
+			client:  c.nickname(),
+			channel: ch.name(),
+			mask:    entry.Mask,
+			who:     cmp.Or(entry.Setter, s.name),
+			setTS:   entry.Set.Unix(),
+			expires: s.listEntryExpires(entry),
+		})
+	}
+	c.sendRPL(s.name, rplEndOfInviteList{
+		client:  c.nickname(),
+		channel: ch.name(),
+	})
+}
+
+func modeHandlerPrefix(mode channelMembershipMode) channelModeHandler {
+	return func(s *Server, c clienter, ch channeler, change *channelModeChange) bool {
+		tc, exists := s.clients.get(change.arg)
+		if !exists {
+			c.sendRPL(s.name, errNoSuchNick{
+				client: c.nickname(),
+				nick:   change.arg,
+			})
+			return false
+		}
+		if !ch.clients().isMember(tc) {
+			c.sendRPL(s.name, errUserNotInChannel{
+				client:  c.nickname(),
+				nick:    tc.nickname(),
+				channel: ch.name(),
+			})
+			return false
+		}
+
+		// members can hand out prefixes up to their own, half-operators
+		// only voice
+		own := memberRank(ch, c)
+		if mode > own || (own == modeMemberHalfOperator && mode != modeMemberVoice) {
+			c.sendRPL(s.name, errChanoPrivsNeeded{
+				client:  c.nickname(),
+				channel: ch.name(),
+			})
+			return false
+		}
+
+		if ch.clients().hasMode(tc, mode) == change.add {
+			return false
+		}
+		if change.add {
+			ch.clients().addMode(tc, mode)
+		} else {
+			ch.clients().removeMode(tc, mode)
+		}
+		change.arg = tc.nickname()
+		return true
+	}
+}
+
+// Highest membership mode of c on ch, 0 if c has none.
+func memberRank(ch channeler, c clienter) channelMembershipMode {
+	for _, mode := range []channelMembershipMode{
+		modeMemberOwner, modeMemberAdmin, modeMemberOperator, modeMemberHalfOperator, modeMemberVoice} {
+		if ch.clients().hasMode(c, mode) {
+			return mode
+		}
+	}
+	return 0
 }
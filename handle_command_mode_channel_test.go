@@ -0,0 +1,625 @@
+package ircd
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHandleModeChannel(t *testing.T) {
+	tcs := []struct {
+		name   string
+		params []string
+		// expected MODE line sent to the channel, empty if none
+		want string
+		// replies sent only to the source
+		rpls []string
+	}{
+		{
+			name:   "flags",
+			params: []string{"#test", "+mt-s"},
+			want:   ":op!mockuser@mockhost MODE #test +mt",
+		},
+		{
+			name:   "mixed parameters in order",
+			params: []string{"#test", "+kv-o", "secret", "voice", "deop"},
+			want:   ":op!mockuser@mockhost MODE #test +kv-o secret voice deop",
+		},
+		{
+			name:   "no effective change",
+			params: []string{"#test", "-kv", "*", "deop"},
+		},
+		{
+			name:   "unknown mode",
+			params: []string{"#test", "+Xm"},
+			want:   ":op!mockuser@mockhost MODE #test +m",
+			rpls:   []string{"472 op X :is unknown mode char to me"},
+		},
+		{
+			name:   "missing parameter",
+			params: []string{"#test", "+mo"},
+			want:   ":op!mockuser@mockhost MODE #test +m",
+		},
+		{
+			name:   "max modes",
+			params: []string{"#test", "+vvvk", "voice", "deop", "op", "secret"},
+			want:   ":op!mockuser@mockhost MODE #test +vvv voice deop op",
+		},
+		{
+			name:   "ban list",
+			params: []string{"#test", "+b-b", "*!*@bad", "*!*@none"},
+			want:   ":op!mockuser@mockhost MODE #test +b *!*@bad",
+		},
+		{
+			name:   "no such nick",
+			params: []string{"#test", "+o", "ghost"},
+			rpls:   []string{"401 op ghost :No such nickname."},
+		},
+		{
+			name:   "prefix above own",
+			params: []string{"#test", "+q", "voice"},
+			rpls:   []string{"482 op #test :You're not channel operator."},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer(ServerConfig{
+				Name:       "server",
+				Parameters: ServerConfigParameters{MaxModes: 3},
+			})
+
+			op := newMockClient(true)
+			op.clientID = "op"
+			op.nick = "op"
+			voice := newMockClient(true)
+			voice.clientID = "voice"
+			voice.nick = "voice"
+			deop := newMockClient(true)
+			deop.clientID = "deop"
+			deop.nick = "deop"
+
+			ch := newChannel("#test", "")
+			for _, c := range []*clientMock{op, voice, deop} {
+				s.clients.add(c)
+				ch.clients().add(c)
+			}
+			ch.clients().addMode(op, modeMemberOperator)
+			ch.clients().addMode(deop, modeMemberOperator)
+			s.channels.add(ch.name(), ch)
+
+			handleModeChannel(s, op, message{command: "MODE", params: tc.params})
+
+			want := []string{}
+			want = append(want, tc.rpls...)
+			if tc.want != "" {
+				want = append(want, tc.want)
+				if slices.Compare(voice.messagesOut, []string{tc.want}) != 0 {
+					t.Errorf("got: %v, want: %v", voice.messagesOut, []string{tc.want})
+				}
+			}
+			if slices.Compare(op.messagesOut, want) != 0 {
+				t.Errorf("got: %v, want: %v", op.messagesOut, want)
+			}
+		})
+	}
+}
+
+func TestHandleModeChannelPrivileges(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	c := newMockClient(true)
+	c.nick = "user"
+	s.clients.add(c)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(c)
+	s.channels.add(ch.name(), ch)
+
+	handleModeChannel(s, c, message{command: "MODE", params: []string{"#test", "+m"}})
+
+	want := []string{"482 user #test :You're not channel operator."}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", c.messagesOut, want)
+	}
+	if ch.hasMode(modeChannelModerated) {
+		t.Error("mode was set without privileges")
+	}
+}
+
+func TestChannelClientStoreRemoveMode(t *testing.T) {
+	cs := newChannelClientStore()
+	c := newMockClient(true)
+	cs.add(c)
+	cs.addMode(c, modeMemberOperator)
+	cs.addMode(c, modeMemberVoice)
+
+	cs.removeMode(c, modeMemberOperator)
+
+	if cs.hasMode(c, modeMemberOperator) {
+		t.Error("mode was not removed")
+	}
+	if !cs.hasMode(c, modeMemberVoice) {
+		t.Error("other mode was removed")
+	}
+}
+
+func TestChannelBans(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewServer(ServerConfig{
+		Name:       "server",
+		Parameters: ServerConfigParameters{MaxList: "b:2"},
+	}, WithClock(func() time.Time { return now }))
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	bad := newMockClient(true)
+	bad.clientID = "bad"
+	bad.nick = "bad"
+	bad.host = "bad.example.com"
+	s.clients.add(bad)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "+bbb", "*.example.com", "other", "third"}})
+
+	want := []string{
+		"478 op #test b :Channel list is full",
+		":op!mockuser@mockhost MODE #test +bb *!*@*.example.com other!*@*",
+	}
+	if slices.Compare(op.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", op.messagesOut, want)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		op.reset()
+		handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "b"}})
+
+		want := []string{
+			"367 op #test *!*@*.example.com op!mockuser@mockhost 1700000000",
+			"367 op #test other!*@* op!mockuser@mockhost 1700000000",
+			"368 op #test :End of channel ban list",
+		}
+		if slices.Compare(op.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", op.messagesOut, want)
+		}
+	})
+
+	t.Run("join", func(t *testing.T) {
+		handleJoin(s, bad, message{command: "JOIN", params: []string{"#test"}})
+
+		want := []string{"474 bad #test :Cannot join channel (+b)"}
+		if slices.Compare(bad.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", bad.messagesOut, want)
+		}
+		if ch.clients().isMember(bad) {
+			t.Error("banned client joined")
+		}
+	})
+
+	t.Run("speak", func(t *testing.T) {
+		bad.reset()
+		op.reset()
+		ch.clients().add(bad)
+
+		handlePrivmsg(s, bad, message{command: "PRIVMSG", params: []string{"#test", "hello"}})
+
+		want := []string{"404 bad #test :Cannot send to channel (+b)."}
+		if slices.Compare(bad.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", bad.messagesOut, want)
+		}
+		if len(op.messagesOut) != 0 {
+			t.Errorf("message was delivered: %v", op.messagesOut)
+		}
+	})
+
+	t.Run("unban", func(t *testing.T) {
+		op.reset()
+		handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "-b", "*.EXAMPLE.com"}})
+
+		want := []string{":op!mockuser@mockhost MODE #test -b *!*@*.example.com"}
+		if slices.Compare(op.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", op.messagesOut, want)
+		}
+		if s.banned(ch, bad) {
+			t.Error("client is still banned")
+		}
+	})
+}
+
+func TestChannelExceptions(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewServer(ServerConfig{Name: "server"}, WithClock(func() time.Time { return now }))
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	friend := newMockClient(true)
+	friend.clientID = "friend"
+	friend.nick = "friend"
+	friend.host = "bad.example.com"
+	s.clients.add(friend)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	handleModeChannel(s, op, message{command: "MODE", params: []string{
+		"#test", "+ibeI", "*.example.com", "friend", "*!*@*.example.com"}})
+
+	want := []string{":op!mockuser@mockhost MODE #test +ibeI *!*@*.example.com friend!*@* *!*@*.example.com"}
+	if slices.Compare(op.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", op.messagesOut, want)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		op.reset()
+		handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "eI"}})
+
+		want := []string{
+			"348 op #test friend!*@* op!mockuser@mockhost 1700000000",
+			"349 op #test :End of Channel Exception List",
+			"346 op #test *!*@*.example.com op!mockuser@mockhost 1700000000",
+			"347 op #test :End of Channel Invite Exception List",
+		}
+		if slices.Compare(op.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", op.messagesOut, want)
+		}
+	})
+
+	t.Run("exception overrides ban and invex bypasses invite only", func(t *testing.T) {
+		handleJoin(s, friend, message{command: "JOIN", params: []string{"#test"}})
+		if !ch.clients().isMember(friend) {
+			t.Errorf("client could not join: %v", friend.messagesOut)
+		}
+	})
+}
+
+func TestChannelTimedBans(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewServer(ServerConfig{Name: "server"}, WithClock(func() time.Time { return now }))
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "+be", "30m:*.example.com", "1h:m:bad"}})
+
+	want := []string{":op!mockuser@mockhost MODE #test +be *!*@*.example.com $m:bad!*@*"}
+	if slices.Compare(op.messagesOut, want) != 0 {
+		t.Errorf("got: %v, want: %v", op.messagesOut, want)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		op.reset()
+		now = now.Add(30 * time.Second)
+		handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "b"}})
+
+		want := []string{
+			"367 op #test *!*@*.example.com op!mockuser@mockhost 1700000000 :expires in 29m30s",
+			"368 op #test :End of channel ban list",
+		}
+		if slices.Compare(op.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", op.messagesOut, want)
+		}
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		op.reset()
+		entry := ch.listEntries('b')[0]
+		if !s.expireListEntry(ch, 'b', entry) {
+			t.Fatal("entry was not removed")
+		}
+
+		want := []string{":server MODE #test -b *!*@*.example.com"}
+		if slices.Compare(op.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", op.messagesOut, want)
+		}
+		if len(ch.listEntries('b')) != 0 {
+			t.Errorf("got: %v, want no bans", ch.listEntries('b'))
+		}
+	})
+
+	t.Run("set again", func(t *testing.T) {
+		op.reset()
+		entry := ch.listEntries('e')[0]
+		handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "-e+e", "m:bad", "m:bad"}})
+
+		if s.expireListEntry(ch, 'e', entry) {
+			t.Error("entry set again was removed")
+		}
+		if len(ch.listEntries('e')) != 1 {
+			t.Errorf("got: %v, want one exception", ch.listEntries('e'))
+		}
+	})
+
+	t.Run("not a duration", func(t *testing.T) {
+		tcs := []struct {
+			input    string
+			duration time.Duration
+			mask     string
+		}{
+			{input: "10m:nick", duration: 10 * time.Minute, mask: "nick"},
+			{input: "1h30m:m:nick", duration: 90 * time.Minute, mask: "m:nick"},
+			{input: "m:nick", mask: "m:nick"},
+			{input: "2001:db8::1", mask: "2001:db8::1"},
+			{input: "-5m:nick", mask: "-5m:nick"},
+			{input: "5m:", mask: "5m:"},
+		}
+		for _, tc := range tcs {
+			duration, mask := splitListDuration(tc.input)
+			if duration != tc.duration || mask != tc.mask {
+				t.Errorf("%s: got: %s %s, want: %s %s", tc.input, duration, mask, tc.duration, tc.mask)
+			}
+		}
+	})
+}
+
+func TestChannelListTimers(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "+bb", "1h:*.example.com", "1h:*.example.org"}})
+	if len(ch.timers) != 2 {
+		t.Fatalf("got %d timers, want 2", len(ch.timers))
+	}
+	removed := ch.timers[listTimerKey('b', "*!*@*.example.com")]
+	kept := ch.timers[listTimerKey('b', "*!*@*.example.org")]
+
+	// removing the entry stops its timer
+	handleModeChannel(s, op, message{command: "MODE", params: []string{"#test", "-b", "*!*@*.EXAMPLE.com"}})
+	if removed.Stop() {
+		t.Error("timer of removed entry was running")
+	}
+	if len(ch.timers) != 1 {
+		t.Errorf("got %d timers, want 1", len(ch.timers))
+	}
+
+	// destroying the channel stops the rest
+	handlePart(s, op, message{command: "PART", params: []string{"#test"}})
+	if kept.Stop() {
+		t.Error("timer of destroyed channel was running")
+	}
+	if len(ch.timers) != 0 {
+		t.Errorf("got %d timers, want 0", len(ch.timers))
+	}
+}
+
+func TestChannelKeyAndLimit(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	other := newMockClient(true)
+	other.clientID = "other"
+	other.nick = "other"
+	s.clients.add(other)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	tcs := []struct {
+		name   string
+		client *clientMock
+		params []string
+		want   []string
+	}{
+		{
+			name:   "set",
+			client: op,
+			params: []string{"#test", "+kl", "secret", "1"},
+			want:   []string{":op!mockuser@mockhost MODE #test +kl secret 1"},
+		},
+		{
+			name:   "member sees parameters",
+			client: op,
+			params: []string{"#test"},
+			want:   []string{"324 op #test +kl secret 1"},
+		},
+		{
+			name:   "others do not",
+			client: other,
+			params: []string{"#test"},
+			want:   []string{"324 other #test +kl"},
+		},
+		{
+			name:   "invalid",
+			client: op,
+			params: []string{"#test", "+lk", "many", "a,b"},
+			want: []string{
+				"696 op #test l many :Invalid limit",
+				"696 op #test k a,b :Invalid key",
+			},
+		},
+		{
+			name:   "wrong key",
+			client: op,
+			params: []string{"#test", "-k", "wrong"},
+			want:   []string{},
+		},
+		{
+			name:   "unset",
+			client: op,
+			params: []string{"#test", "-lk", "secret"},
+			want:   []string{":op!mockuser@mockhost MODE #test -lk *"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.client.reset()
+			handleModeChannel(s, tc.client, message{command: "MODE", params: tc.params})
+			if slices.Compare(tc.client.messagesOut, tc.want) != 0 {
+				t.Errorf("got: %v, want: %v", tc.client.messagesOut, tc.want)
+			}
+		})
+	}
+
+	t.Run("full", func(t *testing.T) {
+		ch.setLimit(1)
+		ch.addMode(modeChannelLimit)
+		other.reset()
+		handleJoin(s, other, message{command: "JOIN", params: []string{"#test"}})
+
+		want := []string{"471 other #test :Cannot join channel (+l)"}
+		if slices.Compare(other.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", other.messagesOut, want)
+		}
+		if ch.clients().isMember(other) {
+			t.Error("client joined a full channel")
+		}
+	})
+}
+
+func TestChannelForward(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	op := newMockClient(true)
+	op.clientID = "op"
+	op.nick = "op"
+	s.clients.add(op)
+
+	ch := newChannel("#test", "")
+	ch.clients().add(op)
+	ch.clients().addMode(op, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	overflow := newChannel("#overflow", "")
+	overflow.clients().add(op)
+	s.channels.add(overflow.name(), overflow)
+
+	tcs := []struct {
+		name   string
+		setup  func()
+		params []string
+		want   []string
+	}{
+		{
+			name:   "not operator in target",
+			params: []string{"#test", "+f", "#overflow"},
+			want:   []string{"482 op #overflow :You're not channel operator."},
+		},
+		{
+			name:   "no such channel",
+			params: []string{"#test", "+f", "#nope"},
+			want:   []string{"403 op #nope :No such channel."},
+		},
+		{
+			name:   "itself",
+			params: []string{"#test", "+f", "#TEST"},
+			want:   []string{"696 op #test f #TEST :Channel can not forward to itself"},
+		},
+		{
+			name:   "set",
+			setup:  func() { overflow.clients().addMode(op, modeMemberOperator) },
+			params: []string{"#test", "+fi", "#overflow"},
+			want:   []string{":op!mockuser@mockhost MODE #test +fi #overflow"},
+		},
+		{
+			name:   "shown to members",
+			params: []string{"#test"},
+			want:   []string{"324 op #test +fi #overflow"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.setup != nil {
+				tc.setup()
+			}
+			op.reset()
+			handleModeChannel(s, op, message{command: "MODE", params: tc.params})
+			if slices.Compare(op.messagesOut, tc.want) != 0 {
+				t.Errorf("got: %v, want: %v", op.messagesOut, tc.want)
+			}
+		})
+	}
+
+	t.Run("join", func(t *testing.T) {
+		c := newMockClient(true)
+		c.clientID = "joiner"
+		c.nick = "joiner"
+		handleJoin(s, c, message{command: "JOIN", params: []string{"#test"}})
+
+		if len(c.messagesOut) == 0 || c.messagesOut[0] != "470 joiner #test #overflow :Forwarding to another channel" {
+			t.Errorf("got: %v, want a forward", c.messagesOut)
+		}
+		if ch.clients().isMember(c) || !overflow.clients().isMember(c) {
+			t.Error("client was not forwarded")
+		}
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		overflow.setForward(ch.name())
+		overflow.addMode(modeChannelForward)
+		overflow.addMode(modeChannelInviteOnly)
+
+		c := newMockClient(true)
+		c.clientID = "looper"
+		c.nick = "looper"
+		handleJoin(s, c, message{command: "JOIN", params: []string{"#test"}})
+
+		want := []string{
+			"470 looper #test #overflow :Forwarding to another channel",
+			"473 looper #overflow :Cannot join channel (+i)",
+		}
+		if slices.Compare(c.messagesOut, want) != 0 {
+			t.Errorf("got: %v, want: %v", c.messagesOut, want)
+		}
+	})
+}
+
+func TestJoinModeArgs(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	c := newMockClient(true)
+	c.clientID = "alice"
+	c.nick = "alice"
+	s.clients.add(c)
+
+	ch := newChannel("#test", "")
+	ch.addMode(modeChannelKey)
+	ch.setKey("secret")
+	ch.addMode(modeChannelLimit)
+	ch.setLimit(10)
+	s.channels.add(ch.name(), ch)
+
+	handleJoin(s, c, message{command: "JOIN", params: []string{"#test", "secret"}})
+	if !ch.clients().isMember(c) {
+		t.Fatalf("client could not join: %v", c.messagesOut)
+	}
+
+	want := ":server MODE #test +kl secret 10"
+	if got := c.messagesOut[len(c.messagesOut)-1]; got != want {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
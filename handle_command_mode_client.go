@@ -1,6 +1,6 @@
 package ircd
 
-func handleModeClient(s *server, c clienter, m message) {
+func handleModeClient(s *Server, c clienter, m message) {
 	target := m.params[0]
 
 	modestring := ""
@@ -1,6 +1,6 @@
 package ircd
 
-func handleNick(s *server, c clienter, m message) {
+func handleNick(s *Server, c clienter, m message) {
 	// validate nickname
 	ok := s.regex[regexNick].MatchString(m.params[0])
 	if !ok {
@@ -12,7 +12,7 @@ func handleNick(s *server, c clienter, m message) {
 	}
 
 	// check if nick is already in use
-	_, exists := s.Clients.get(m.params[0])
+	_, exists := s.clients.get(m.params[0])
 	if exists {
 		c.sendRPL(s.name, errNicknameInUse{
 			client: m.params[0],
@@ -21,16 +21,16 @@ func handleNick(s *server, c clienter, m message) {
 		return
 	}
 
-	c.setNickname(m.params[0])
+	old := c.nickname()
+	if !emit(s, &NickEvent{Client: &Client{s: s, c: c}, Old: old, New: m.params[0]}) {
+		return
+	}
 
-	if !c.handshake() && c.nickname() != "" && c.username() != "" {
-		if s.password != "" && !c.password() {
-			c.sendRPL(s.name, errPasswdMismatch{
-				client: c.nickname(),
-			})
-			c.kill("Wrong server password.")
-			return
-		}
-		handleHandshake(s, c)
+	if c.handshake() {
+		s.changeNick(c, m.params[0])
+		return
 	}
+
+	c.setNickname(m.params[0])
+	tryHandshake(s, c)
 }
@@ -0,0 +1,67 @@
+package ircd
+
+import (
+	"strings"
+)
+
+// Like PRIVMSG, but errors are never sent back.
+//
+// https://modern.ircdocs.horse/#notice-message
+func handleNotice(s *Server, c clienter, m message) {
+	targets := strings.Split(m.params[0], ",")
+	text := strings.Join(m.params[1:len(m.params)], " ")
+
+	for _, target := range targets {
+		if m.isTargetChannel() {
+			ch, exists := s.channels.get(target)
+			if !exists || !ch.clients().isMember(c) {
+				continue
+			}
+
+			voiced := ch.clients().hasMode(
+				c, modeMemberVoice, modeMemberHalfOperator, modeMemberOperator, modeMemberAdmin, modeMemberOwner)
+			if !voiced && (ch.hasMode(modeChannelModerated) || s.muted(ch, c)) {
+				continue
+			}
+
+			event := &PrivmsgEvent{
+				Client: &Client{s: s, c: c},
+				Target: ch.name(),
+				Text:   text,
+				Notice: true,
+			}
+			if !emit(s, event) {
+				continue
+			}
+
+			ch.broadcastCommand(clientNoticeCommand{
+				prefix: c.prefix(),
+				target: ch.name(),
+				text:   event.Text,
+			}, c.id(), true)
+			s.recordHistory(ch, c.prefix(), "NOTICE", event.Text)
+			continue
+		}
+
+		tc, exists := s.clients.get(target)
+		if tc == nil || !exists {
+			continue
+		}
+
+		event := &PrivmsgEvent{
+			Client: &Client{s: s, c: c},
+			Target: tc.nickname(),
+			Text:   text,
+			Notice: true,
+		}
+		if !emit(s, event) {
+			continue
+		}
+
+		tc.sendCommand(clientNoticeCommand{
+			prefix: c.prefix(),
+			target: tc.nickname(),
+			text:   event.Text,
+		})
+	}
+}
@@ -1,17 +1,30 @@
 package ircd
 
-func handleOper(s *server, c clienter, m message) {
+import "slices"
+
+func handleOper(s *Server, c clienter, m message) {
 	user := m.params[0]
 	password := m.params[1]
 
 	// if not successful
-	if !s.Operators.auth(user, password) {
+	if !s.operators.auth(user, password) {
 		c.sendRPL(s.name, errPasswdMismatch{
 			client: c.nickname(),
 		})
 		return
 	}
 
+	// credentials can be limited to hosts
+	hostmasks := s.operators.hostmasks(user)
+	if len(hostmasks) > 0 && !slices.ContainsFunc(hostmasks, func(mask string) bool {
+		return matchUserHostMask(s.casemapping, mask, c)
+	}) {
+		c.sendRPL(s.name, errNoOperHost{
+			client: c.nickname(),
+		})
+		return
+	}
+
 	c.addMode(modeClientOperator)
 	c.sendCommand(modeCommand{
 		target:     c.nickname(),
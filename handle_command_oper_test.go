@@ -11,7 +11,7 @@ func TestCommandOper(t *testing.T) {
 		Name: "server",
 	})
 
-	s.Operators.add("test", "test")
+	s.operators.add("test", "test")
 
 	t.Run("bad auth", func(t *testing.T) {
 		m := message{
@@ -41,3 +41,53 @@ func TestCommandOper(t *testing.T) {
 	})
 
 }
+
+func TestCommandOperHost(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+	})
+	s.AddOperator("test", "test", "admin@*.example.com", "*@10.0.0.0/8")
+
+	tcs := []struct {
+		name string
+		user string
+		host string
+		addr string
+		want []string
+	}{
+		{
+			name: "matching host",
+			user: "admin",
+			host: "shell.example.com",
+			addr: "192.0.2.1",
+			want: []string{"MODE mocknick +o", "381 mocknick :You are now an IRC operator."},
+		},
+		{
+			name: "matching network",
+			user: "someone",
+			host: "other.example.net",
+			addr: "10.1.2.3",
+			want: []string{"MODE mocknick +o", "381 mocknick :You are now an IRC operator."},
+		},
+		{
+			name: "wrong user",
+			user: "someone",
+			host: "shell.example.com",
+			addr: "192.0.2.1",
+			want: []string{"491 mocknick :No O-lines for your host."},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newMockClient(true)
+			c.user = tc.user
+			c.rhost = tc.host
+			c.addr = tc.addr
+			handleOper(s, c, message{command: "OPER", params: []string{"test", "test"}})
+			if slices.Compare(c.messagesOut, tc.want) != 0 {
+				t.Errorf("got %v, want: %v", c.messagesOut, tc.want)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"github.com/salimnassim/ircd/metrics"
 )
 
-func handlePart(s *server, c clienter, m message) {
+func handlePart(s *Server, c clienter, m message) {
 	targets := strings.Split(m.params[0], ",")
 
 	reason := "no reason given"
@@ -24,7 +24,7 @@ func handlePart(s *server, c clienter, m message) {
 		}
 
 		// try to get ch
-		ch, exists := s.Channels.get(target)
+		ch, exists := s.channels.get(target)
 		if !exists {
 			c.sendRPL(s.name, errNoSuchChannel{
 				client:  c.nickname(),
@@ -33,6 +33,15 @@ func handlePart(s *server, c clienter, m message) {
 			continue
 		}
 
+		event := &PartEvent{
+			Client:  &Client{s: s, c: c},
+			Channel: ch.name(),
+			Reason:  reason,
+		}
+		if !emit(s, event) {
+			continue
+		}
+
 		// remove client
 		ch.clients().remove(c)
 
@@ -40,11 +49,12 @@ func handlePart(s *server, c clienter, m message) {
 		ch.broadcastCommand(partCommand{
 			prefix:  c.prefix(),
 			channel: ch.name(),
-			text:    reason,
+			text:    event.Reason,
 		}, c.id(), false)
 
 		if ch.clients().count() == 0 {
-			s.Channels.delete(ch.name())
+			ch.stopListTimers()
+			s.channels.delete(ch.name())
 			metrics.Channels.Dec()
 		}
 	}
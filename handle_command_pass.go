@@ -1,10 +1,6 @@
 package ircd
 
-func handlePass(s *server, c clienter, m message) {
-	if s.password == "" {
-		return
-	}
-
+func handlePass(s *Server, c clienter, m message) {
 	// handshaked clients cant PASS
 	if c.handshake() {
 		c.sendRPL(s.name, errAlreadyRegistered{
@@ -13,8 +9,6 @@ func handlePass(s *server, c clienter, m message) {
 		return
 	}
 
-	password := m.params[0]
-	if password == s.password {
-		c.setPassword(true)
-	}
+	// checked against the connection class during registration
+	c.setPassword(m.params[0])
 }
@@ -4,6 +4,6 @@ import (
 	"strings"
 )
 
-func handlePing(s *server, c clienter, m message) {
+func handlePing(s *Server, c clienter, m message) {
 	c.send(strings.Replace(m.raw, "PING", "PONG", 1))
 }
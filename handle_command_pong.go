@@ -1,5 +1,5 @@
 package ircd
 
-func handlePong(s *server, c clienter, m message) {
+func handlePong(s *Server, c clienter, m message) {
 	c.pong(true)
 }
@@ -4,14 +4,14 @@ import (
 	"strings"
 )
 
-func handlePrivmsg(s *server, c clienter, m message) {
+func handlePrivmsg(s *Server, c clienter, m message) {
 	targets := strings.Split(m.params[0], ",")
 	text := strings.Join(m.params[1:len(m.params)], " ")
 
 	for _, target := range targets {
 		// is channel
 		if m.isTargetChannel() {
-			ch, exists := s.Channels.get(target)
+			ch, exists := s.channels.get(target)
 			if !exists {
 				c.sendRPL(s.name, errNoSuchChannel{
 					client:  c.nickname(),
@@ -29,6 +29,17 @@ func handlePrivmsg(s *server, c clienter, m message) {
 				continue
 			}
 
+			// banned and muted members can not speak unless they are voiced
+			if s.muted(ch, c) && !ch.clients().hasMode(
+				c, modeMemberVoice, modeMemberHalfOperator, modeMemberOperator, modeMemberAdmin, modeMemberOwner) {
+				c.sendRPL(s.name, errCannotSendToChan{
+					client:  c.nickname(),
+					channel: ch.name(),
+					text:    "Cannot send to channel (+b).",
+				})
+				continue
+			}
+
 			if ch.hasMode(modeChannelModerated) && !ch.clients().hasMode(
 				c, modeMemberVoice, modeMemberHalfOperator, modeMemberOperator, modeMemberAdmin, modeMemberOwner) {
 				c.sendRPL(s.name, errCannotSendToChan{
@@ -39,16 +50,26 @@ func handlePrivmsg(s *server, c clienter, m message) {
 				return
 			}
 
+			event := &PrivmsgEvent{
+				Client: &Client{s: s, c: c},
+				Target: ch.name(),
+				Text:   text,
+			}
+			if !emit(s, event) {
+				continue
+			}
+
 			ch.broadcastCommand(privmsgCommand{
 				prefix: c.prefix(),
 				target: ch.name(),
-				text:   text,
+				text:   event.Text,
 			}, c.id(), true)
+			s.recordHistory(ch, c.prefix(), "PRIVMSG", event.Text)
 			continue
 		}
 
 		// is user
-		tc, exists := s.Clients.get(target)
+		tc, exists := s.clients.get(target)
 		if tc == nil || !exists {
 			c.sendRPL(s.name, errNoSuchChannel{
 				client:  c.nickname(),
@@ -57,6 +78,15 @@ func handlePrivmsg(s *server, c clienter, m message) {
 			continue
 		}
 
+		event := &PrivmsgEvent{
+			Client: &Client{s: s, c: c},
+			Target: tc.nickname(),
+			Text:   text,
+		}
+		if !emit(s, event) {
+			continue
+		}
+
 		// is away?
 		if tc.away() != "" {
 			tc.sendRPL(s.name, rplAway{
@@ -69,7 +99,7 @@ func handlePrivmsg(s *server, c clienter, m message) {
 		tc.sendCommand(privmsgCommand{
 			prefix: c.nickname(),
 			target: tc.nickname(),
-			text:   text,
+			text:   event.Text,
 		})
 		continue
 	}
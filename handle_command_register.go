@@ -0,0 +1,69 @@
+package ircd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// REGISTER <account> <email> <password>
+//
+// https://ircv3.net/specs/extensions/account-registration
+func handleRegister(s *Server, c clienter, m message) {
+	account, email, password := m.params[0], m.params[1], m.params[2]
+	if account == "*" {
+		account = c.nickname()
+	}
+	if email == "*" {
+		email = ""
+	}
+
+	fail := func(code string, text string) {
+		c.sendCommand(failCommand{
+			server:  s.name,
+			cmd:     "REGISTER",
+			code:    code,
+			context: []string{account},
+			text:    text,
+		})
+	}
+
+	// registration before connecting (before-connect) is not supported
+	if !c.handshake() {
+		fail("COMPLETE_CONNECTION_REQUIRED", "Complete connection registration first")
+		return
+	}
+	if c.account() != "" {
+		fail("ALREADY_AUTHENTICATED", "You are already authenticated")
+		return
+	}
+	if !s.regex[regexNick].MatchString(account) {
+		fail("BAD_ACCOUNT_NAME", "Account name is not valid")
+		return
+	}
+	if !strings.EqualFold(account, c.nickname()) {
+		fail("ACCOUNT_NAME_MUST_BE_NICK", "Account name must be your nickname")
+		return
+	}
+
+	err := s.accounts.register(c.nickname(), password, email, s.now())
+	switch err {
+	case nil:
+	case errorAccountExists:
+		fail("ACCOUNT_EXISTS", "Account already exists")
+		return
+	case errorWeakPassword:
+		fail("WEAK_PASSWORD", fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+		return
+	default:
+		s.log.Error().Err(err).Msgf("cant register account %s", account)
+		fail("TEMPORARILY_UNAVAILABLE", "Registration is not available, try again later")
+		return
+	}
+
+	c.sendCommand(registerSuccessCommand{
+		server:  s.name,
+		account: c.nickname(),
+		text:    "Account successfully registered",
+	})
+	s.login(c, c.nickname())
+}
@@ -4,7 +4,7 @@ import (
 	"strings"
 )
 
-func handleTopic(s *server, c clienter, m message) {
+func handleTopic(s *Server, c clienter, m message) {
 	target := m.params[0]
 
 	if !m.isTargetChannel() {
@@ -15,7 +15,7 @@ func handleTopic(s *server, c clienter, m message) {
 		return
 	}
 
-	ch, exists := s.Channels.get(target)
+	ch, exists := s.channels.get(target)
 	if !exists {
 		c.sendRPL(s.name, errNoSuchChannel{
 			client:  c.nickname(),
@@ -34,7 +34,10 @@ func handleTopic(s *server, c clienter, m message) {
 
 	// set topic
 	text := strings.Join(m.params[1:len(m.params)], " ")
-	ch.setTopic(text, c.nickname())
+	ch.setTopic(text, c.nickname(), s.now())
+	if s.chanserv != nil {
+		s.chanserv.save(ch)
+	}
 
 	// get topic
 	topic := ch.topic()
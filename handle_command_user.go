@@ -1,6 +1,6 @@
 package ircd
 
-func handleUser(s *server, c clienter, m message) {
+func handleUser(s *Server, c clienter, m message) {
 	if c.username() != "" {
 		c.sendRPL(s.name, errAlreadyRegistered{
 			client: c.nickname(),
@@ -13,13 +13,5 @@ func handleUser(s *server, c clienter, m message) {
 
 	c.setUser(username, realname)
 
-	if !c.handshake() && c.nickname() != "" && c.username() != "" {
-		if s.password != "" && !c.password() {
-			c.sendRPL(s.name, errPasswdMismatch{
-				client: c.nickname(),
-			})
-			return
-		}
-		handleHandshake(s, c)
-	}
+	tryHandshake(s, c)
 }
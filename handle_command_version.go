@@ -2,7 +2,7 @@ package ircd
 
 import "fmt"
 
-func handleVersion(s *server, c clienter, m message) {
+func handleVersion(s *Server, c clienter, m message) {
 	if len(m.params) == 0 {
 		c.sendRPL(s.name, rplVersion{
 			client:   c.nickname(),
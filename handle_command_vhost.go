@@ -0,0 +1,130 @@
+package ircd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VHOST REQUEST <hostname>
+//
+// VHOST LIST, VHOST APPROVE <nick> and VHOST REJECT <nick> [reason] require operator privileges.
+func handleVhost(s *Server, c clienter, m message) {
+	subcommand := strings.ToUpper(m.params[0])
+
+	if subcommand == "REQUEST" {
+		if len(m.params) < 2 {
+			c.sendRPL(s.name, errNeedMoreParams{
+				client:  c.nickname(),
+				command: m.command,
+			})
+			return
+		}
+
+		hostname := m.params[1]
+		if !s.validHostname(hostname) {
+			c.sendCommand(noticeCommand{
+				client:  c.nickname(),
+				message: fmt.Sprintf("*** Invalid hostname %s", hostname),
+			})
+			return
+		}
+
+		s.vhosts.add(c.id(), hostname)
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Your request for %s is waiting for operator approval", hostname),
+		})
+
+		// let operators know there is something to review
+		for _, op := range s.clients.all() {
+			if !op.hasMode(modeClientOperator) {
+				continue
+			}
+			op.sendCommand(noticeCommand{
+				client:  op.nickname(),
+				message: fmt.Sprintf("*** %s requested vhost %s", c.nickname(), hostname),
+			})
+		}
+		return
+	}
+
+	if !c.hasMode(modeClientOperator) {
+		c.sendRPL(s.name, errNoPrivileges{
+			client: c.nickname(),
+		})
+		return
+	}
+
+	switch subcommand {
+	case "LIST":
+		for _, tc := range s.clients.all() {
+			hostname, ok := s.vhosts.get(tc.id())
+			if !ok {
+				continue
+			}
+			c.sendCommand(noticeCommand{
+				client:  c.nickname(),
+				message: fmt.Sprintf("*** %s (%s) requested %s", tc.nickname(), tc.prefix(), hostname),
+			})
+		}
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: "*** End of vhost requests",
+		})
+	case "APPROVE", "REJECT":
+		if len(m.params) < 2 {
+			c.sendRPL(s.name, errNeedMoreParams{
+				client:  c.nickname(),
+				command: m.command,
+			})
+			return
+		}
+
+		tc, ok := s.clients.get(m.params[1])
+		if !ok {
+			c.sendRPL(s.name, errNoSuchNick{
+				client: c.nickname(),
+				nick:   m.params[1],
+			})
+			return
+		}
+
+		hostname, ok := s.vhosts.get(tc.id())
+		if !ok {
+			c.sendCommand(noticeCommand{
+				client:  c.nickname(),
+				message: fmt.Sprintf("*** %s has no pending vhost request", tc.nickname()),
+			})
+			return
+		}
+		s.vhosts.delete(tc.id())
+
+		if subcommand == "REJECT" {
+			reason := "No reason given"
+			if len(m.params) >= 3 {
+				reason = strings.Join(m.params[2:], " ")
+			}
+			tc.sendCommand(noticeCommand{
+				client:  tc.nickname(),
+				message: fmt.Sprintf("*** Your request for %s was rejected: %s", hostname, reason),
+			})
+			c.sendCommand(noticeCommand{
+				client:  c.nickname(),
+				message: fmt.Sprintf("*** Rejected vhost %s for %s", hostname, tc.nickname()),
+			})
+			return
+		}
+
+		s.changeHost(tc, tc.username(), hostname)
+		tc.addMode(modeClientVhost)
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Approved vhost %s for %s", hostname, tc.nickname()),
+		})
+	default:
+		c.sendCommand(noticeCommand{
+			client:  c.nickname(),
+			message: fmt.Sprintf("*** Unknown VHOST subcommand %s", m.params[0]),
+		})
+	}
+}
@@ -2,7 +2,7 @@ package ircd
 
 import "strings"
 
-func handleWho(s *server, c clienter, m message) {
+func handleWho(s *Server, c clienter, m message) {
 	if len(m.params) == 0 {
 		c.sendRPL(s.name, errNeedMoreParams{
 			client:  c.nickname(),
@@ -13,7 +13,7 @@ func handleWho(s *server, c clienter, m message) {
 
 	target := m.params[0]
 	if m.isTargetChannel() {
-		channel, ok := s.Channels.get(target)
+		channel, ok := s.channels.get(target)
 		if !ok {
 			c.sendRPL(s.name, errNoSuchChannel{
 				client:  c.nickname(),
@@ -23,24 +23,7 @@ func handleWho(s *server, c clienter, m message) {
 		}
 
 		for _, cl := range channel.clients().all() {
-			flags := []string{}
-			if cl.away() == "" {
-				flags = append(flags, "H")
-			} else {
-				flags = append(flags, "G")
-			}
-
-			c.sendRPL(s.name, rplWhoReply{
-				client:   c.nickname(),
-				channel:  channel.name(),
-				username: cl.username(),
-				host:     cl.hostname(),
-				server:   s.name,
-				nick:     cl.nickname(),
-				flags:    strings.Join(flags, ""),
-				hopcount: 0,
-				realname: cl.realname(),
-			})
+			sendWhoReply(s, c, cl, channel.name())
 		}
 
 		c.sendRPL(s.name, rplEndOfWho{
@@ -49,5 +32,61 @@ func handleWho(s *server, c clienter, m message) {
 		})
 		return
 	}
-	// todo: support querying users with mask
+
+	// operators also match real hostnames and IP addresses
+	mask, err := parseHostMask(s.casemapping, normalizeMask(target))
+	if err == nil {
+		for _, cl := range s.clients.all() {
+			if !cl.handshake() || !whoVisible(s, c, cl) {
+				continue
+			}
+			hosts := []string{cl.hostname()}
+			if c.hasMode(modeClientOperator) {
+				hosts = append(hosts, cl.realhost(), cl.ip())
+			}
+			if mask.match(s.casemapping, cl.nickname()+"!"+cl.username(), hosts...) {
+				sendWhoReply(s, c, cl, "*")
+			}
+		}
+	}
+
+	c.sendRPL(s.name, rplEndOfWho{
+		client: c.nickname(),
+		mask:   target,
+	})
+}
+
+// Invisible clients are only listed to operators, themselves and clients
+// sharing a channel with them.
+func whoVisible(s *Server, c clienter, cl clienter) bool {
+	if !cl.hasMode(modeClientInvisible) || c.hasMode(modeClientOperator) || c.id() == cl.id() {
+		return true
+	}
+	for _, ch := range s.channels.memberOf(c) {
+		if ch.clients().isMember(cl) {
+			return true
+		}
+	}
+	return false
+}
+
+func sendWhoReply(s *Server, c clienter, cl clienter, channel string) {
+	flags := []string{}
+	if cl.away() == "" {
+		flags = append(flags, "H")
+	} else {
+		flags = append(flags, "G")
+	}
+
+	c.sendRPL(s.name, rplWhoReply{
+		client:   c.nickname(),
+		channel:  channel,
+		username: cl.username(),
+		host:     cl.hostname(),
+		server:   s.name,
+		nick:     cl.nickname(),
+		flags:    strings.Join(flags, ""),
+		hopcount: 0,
+		realname: cl.realname(),
+	})
 }
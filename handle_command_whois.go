@@ -1,8 +1,8 @@
 package ircd
 
-func handleWhois(s *server, c clienter, m message) {
+func handleWhois(s *Server, c clienter, m message) {
 	target := m.params[0]
-	who, exists := s.Clients.get(target)
+	who, exists := s.clients.get(target)
 	if who == nil || !exists {
 		c.sendRPL(s.name, errNoSuchNick{
 			client: c.nickname(),
@@ -20,8 +20,18 @@ func handleWhois(s *server, c clienter, m message) {
 		realname: who.realname(),
 	})
 
+	// real hostname is only visible to operators and the client itself
+	if c.hasMode(modeClientOperator) || c.id() == who.id() {
+		c.sendRPL(s.name, rplWhoisHost{
+			client:   c.nickname(),
+			nick:     who.nickname(),
+			hostname: who.realhost(),
+			ip:       who.ip(),
+		})
+	}
+
 	channels := []string{}
-	memberOf := s.Channels.memberOf(who)
+	memberOf := s.channels.memberOf(who)
 	for _, ch := range memberOf {
 		if ch.hasMode(modeChannelSecret) {
 			continue
@@ -38,6 +48,14 @@ func handleWhois(s *server, c clienter, m message) {
 		channels: channels,
 	})
 
+	if who.account() != "" {
+		c.sendRPL(s.name, rplWhoisAccount{
+			client:  c.nickname(),
+			nick:    who.nickname(),
+			account: who.account(),
+		})
+	}
+
 	if who.away() != "" {
 		c.sendRPL(s.name, rplWhoisSpecial{
 			client: c.nickname(),
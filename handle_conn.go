@@ -1,28 +1,117 @@
 package ircd
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/rs/zerolog/log"
 	"github.com/salimnassim/ircd/metrics"
 )
 
-func handleConnection(conn net.Conn, s *server) {
+const (
+	tlsHandshakeTimeout        = 10 * time.Second
+	defaultRegistrationTimeout = 60
+)
+
+func handleConnection(conn net.Conn, s *Server, config ListenerConfig) {
 	id := uuid.Must(uuid.NewRandom()).String()
 	c, err := newClient(conn, id)
 	if err != nil {
-		log.Error().Err(err).Msg("cant create client")
+		s.log.Error().Err(err).Msg("cant create client")
+		s.limiter.release(remoteIP(conn))
+		conn.Close()
 		return
 	}
 
-	s.Clients.add(c)
+	// complete the TLS handshake so the client certificate is known before
+	// the client is matched to a connection class
+	if tc, ok := conn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		err := tc.Handshake()
+		tc.SetDeadline(time.Time{})
+		if err != nil {
+			s.log.Error().Err(err).Msgf("tls handshake failed for %s", c.ip())
+			s.limiter.release(c.ip())
+			conn.Close()
+			return
+		}
+		c.setTLS(true)
+		if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+			sum := sha256.Sum256(certs[0].Raw)
+			c.fp = hex.EncodeToString(sum[:])
+		}
+	}
+
+	c.cls = s.defaultClass
+	c.flood = newFloodControl(s.defaultClass.flood)
+	c.sendq = newSendQueue(s.defaultClass.sendq)
+
+	s.clients.add(c)
 	metrics.Clients.Inc()
 
+	// accepted while the server was shutting down or upgrading
+	select {
+	case <-s.closing:
+		c.kill(s.shutdownReason)
+	default:
+		if s.upgradeInProgress() {
+			c.kill("Server is restarting, please reconnect")
+		} else if !emit(s, &ConnectEvent{Client: &Client{s: s, c: c}}) {
+			c.kill("Connection refused")
+		}
+	}
+
+	serveClient(c, s, config)
+}
+
+// Runs the connection goroutines of c until it is killed or detached.
+//
+// Killed clients are cleaned up, detached clients are left as they are so
+// they can be handed over or served again.
+func serveClient(c *client, s *Server, config ListenerConfig) {
+	// connections that do not complete registration in time are dropped
+	registration := time.AfterFunc(s.registrationTimeout, func() {
+		if !c.handshake() {
+			c.kill("Registration timed out")
+		}
+	})
+
 	// starts goroutines for procesing incoming and outgoing messages
-	go handleConnectionIn(c, s)
-	go handleConnectionOut(c)
+	fs := []func(){
+		func() { handleConnectionIn(c, s) },
+		func() { handleConnectionProcess(c, s) },
+		func() { handleConnectionOut(c) },
+	}
+	select {
+	case <-c.lookups():
+	default:
+		fs = append(fs, func() { handleConnectionLookup(c, s, config) })
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, f := range fs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
 	handleConnectionPong(c, s)
+	registration.Stop()
+
+	if c.isDetached() {
+		wg.Wait()
+		close(c.stopped)
+		return
+	}
+
+	s.limiter.release(c.ip())
+	s.cleanup(c)
 
-	go s.cleanup(c)
+	// send queue is flushed by handleConnectionOut before it returns
+	wg.Wait()
 }
@@ -2,11 +2,47 @@ package ircd
 
 import (
 	"fmt"
-	"net"
 	"strings"
 )
 
-func handleHandshake(s *server, c clienter) {
+// Completes registration once the client has sent NICK and USER, capability
+// negotiation has ended and connection lookups have finished.
+func tryHandshake(s *Server, c clienter) {
+	if c.handshake() || c.negotiating() || c.nickname() == "" || c.username() == "" {
+		return
+	}
+
+	select {
+	case <-c.lookups():
+	default:
+		// lookup goroutine will try again when it is done
+		return
+	}
+
+	class := s.matchClass(c)
+	if !class.authenticate(c.password()) {
+		c.sendRPL(s.name, errPasswdMismatch{
+			client: c.nickname(),
+		})
+		c.kill("Wrong server password.")
+		return
+	}
+
+	handleHandshake(s, c, class)
+}
+
+func handleHandshake(s *Server, c clienter, class *connectionClass) {
+	// handshake can be attempted from the read loop and the lookup goroutine
+	if _, loaded := s.handshakes.LoadOrStore(c.id(), true); loaded {
+		return
+	}
+
+	if !class.join() {
+		c.kill(fmt.Sprintf("No more connections allowed in class %s", class.name))
+		return
+	}
+	c.setClass(class)
+
 	if !c.handshake() {
 		// send handshake preamble
 		c.sendCommand(noticeCommand{
@@ -19,19 +55,33 @@ func handleHandshake(s *server, c clienter) {
 			message: fmt.Sprintf("AUTH :*** Your IP address is: %s", c.ip()),
 		})
 
-		c.sendCommand(noticeCommand{
-			client:  c.nickname(),
-			message: "AUTH :*** Looking up your hostname...",
-		})
+		// usernames not verified by ident are prefixed with ~
+		username := c.ident()
+		if username == "" {
+			username = "~" + c.username()
+		}
+		if s.parameters.MaxUserLength > 0 && len(username) > s.parameters.MaxUserLength {
+			username = username[:s.parameters.MaxUserLength]
+		}
+		c.setUser(username, c.realname())
 
-		// lookup address
-		// todo: resolver
-		addr, err := net.LookupAddr(c.ip())
-		if err != nil {
-			// if it cant be resolved use ip
-			c.setHostname(c.ip())
-		} else {
-			c.setHostname(addr[0])
+		if ban, banned := s.bans.match(c, s.casemapping, s.now()); banned {
+			class.leave()
+			c.sendRPL(s.name, errYoureBannedCreep{
+				client: c.nickname(),
+				reason: ban.Reason,
+			})
+			c.kill(fmt.Sprintf("K-lined: %s", ban.Reason))
+			return
+		}
+
+		// cloak before the prefix is visible to anyone
+		c.setHostname(s.cloak.host(c.ip()))
+
+		if !emit(s, &RegisterEvent{Client: &Client{s: s, c: c}}) {
+			class.leave()
+			c.kill("Registration refused")
+			return
 		}
 
 		c.sendRPL(s.name, rplWelcome{
@@ -46,19 +96,6 @@ func handleHandshake(s *server, c clienter) {
 			version:    s.version,
 		})
 
-		// ipv4 or ipv6 connection for cloaking mask
-		prefix := 4
-		if strings.Count(c.ip(), ":") > 1 {
-			prefix = 6
-		}
-
-		tls := "plain"
-		if c.tls() {
-			tls = "tls"
-		}
-
-		// cloak
-		c.setHostname(fmt.Sprintf("ipv%d-%s-%s.vhost", prefix, tls, c.id()))
 		c.sendCommand(noticeCommand{
 			client:  c.nickname(),
 			message: fmt.Sprintf("AUTH :*** Your hostname has been cloaked to %s", c.hostname()),
@@ -78,7 +115,11 @@ func handleHandshake(s *server, c clienter) {
 			text:   "MOTD -",
 		})
 
-		for _, line := range s.MOTD() {
+		motd := class.motd
+		if len(motd) == 0 {
+			motd = s.MOTD()
+		}
+		for _, line := range motd {
 			c.sendRPL(s.name, rplMotd{
 				client: c.nickname(),
 				text:   line,
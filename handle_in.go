@@ -3,35 +3,91 @@ package ircd
 import (
 	"bufio"
 	"strings"
+	"time"
 )
 
-func handleConnectionIn(c *client, s *server) {
-	reader := bufio.NewReader(c.conn)
-	scanner := bufio.NewScanner(reader)
-
+func handleConnectionIn(c *client, s *Server) {
 	alive := true
 	for alive {
 		select {
 		case <-c.killIn:
 			alive = false
 		default:
-			scanner.Scan()
-			if scanner.Err() != nil {
+			data, err := c.reader.ReadSlice('\n')
+			c.partial = append(c.partial, data...)
+			if err == bufio.ErrBufferFull || len(c.partial) > inputBufferSize {
+				if c.quitReason() == "" {
+					c.kill("Input line too long")
+				}
+				alive = false
+				continue
+			}
+			if err != nil {
+				// read deadline was set to stop the reader for an upgrade,
+				// partial line is kept and handed over
+				if c.isDetached() {
+					alive = false
+					continue
+				}
 				if c.quitReason() == "" {
 					c.kill("EOF")
 				}
+				alive = false
 				continue
 			}
 			line := strings.Trim(
-				scanner.Text(), "\r\n",
+				string(c.partial), "\r\n",
 			)
+			c.partial = c.partial[:0]
 			parsed, err := parseMessage(line)
 			if err != nil {
 				continue
 			}
-			s.router.handle(s, c, parsed)
+
+			// operators are not subject to flood control
+			at := time.Now()
+			if !c.hasMode(modeClientOperator) {
+				var excess bool
+				at, excess = c.flood.penalty(parsed.command)
+				if excess {
+					if c.quitReason() == "" {
+						c.kill("Excess Flood")
+					}
+					continue
+				}
+			}
+
+			select {
+			case c.in <- queuedMessage{message: parsed, at: at}:
+			case <-c.killIn:
+				alive = false
+			}
 		}
 	}
 
-	c.conn.Close()
+	if !c.isDetached() {
+		c.conn.Close()
+	}
+}
+
+// Processes incoming messages, waiting for flood control delays.
+func handleConnectionProcess(c *client, s *Server) {
+	alive := true
+	for alive {
+		select {
+		case <-c.killProcess:
+			alive = false
+		case qm := <-c.in:
+			delay := time.Until(qm.at)
+			if delay > 0 {
+				select {
+				case <-c.killProcess:
+					alive = false
+					continue
+				case <-time.After(delay):
+				}
+			}
+			s.router.handle(s, c, qm.message)
+		}
+	}
 }
@@ -0,0 +1,86 @@
+package ircd
+
+import (
+	"net"
+	"sync"
+)
+
+// Runs connection lookups in the background so that the read loop is never
+// blocked on DNS or ident. Registration is completed once lookups are done.
+func handleConnectionLookup(c *client, s *Server, config ListenerConfig) {
+	wg := &sync.WaitGroup{}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lookupHostname(c, s)
+	}()
+
+	if config.Ident {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lookupIdent(c, s)
+		}()
+	}
+
+	wg.Wait()
+	close(c.lookupDone)
+
+	// NICK and USER may have arrived while waiting
+	tryHandshake(s, c)
+}
+
+func lookupHostname(c *client, s *Server) {
+	c.sendCommand(noticeCommand{
+		client:  "*",
+		message: "AUTH :*** Looking up your hostname...",
+	})
+
+	hostname, ok := s.resolver.lookup(c.ip())
+	if ok {
+		c.setRealhost(hostname)
+		c.sendCommand(noticeCommand{
+			client:  "*",
+			message: "AUTH :*** Found your hostname",
+		})
+		return
+	}
+
+	c.setRealhost(c.ip())
+	c.sendCommand(noticeCommand{
+		client:  "*",
+		message: "AUTH :*** Couldn't look up your hostname, using your IP address instead",
+	})
+}
+
+func lookupIdent(c *client, s *Server) {
+	remote, ok := c.conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	local, ok := c.conn.LocalAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+
+	c.sendCommand(noticeCommand{
+		client:  "*",
+		message: "AUTH :*** Checking Ident",
+	})
+
+	ident, err := identLookup(remote, local, identPort, s.identTimeout)
+	if err != nil || !s.validUsername(ident) {
+		c.sendCommand(noticeCommand{
+			client:  "*",
+			message: "AUTH :*** No Ident response",
+		})
+		return
+	}
+
+	c.setIdent(ident)
+	c.sendCommand(noticeCommand{
+		client:  "*",
+		message: "AUTH :*** Got Ident response",
+	})
+}
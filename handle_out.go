@@ -1,17 +1,28 @@
 package ircd
 
 import (
-	"io"
+	"bufio"
+	"time"
 )
 
+// How long a write can block before the client is disconnected.
+const writeTimeout = 30 * time.Second
+
 func handleConnectionOut(c *client) {
+	writer := bufio.NewWriter(c.conn)
+
 	alive := true
 	for alive {
 		select {
 		case <-c.killOut:
 			alive = false
-		case m := <-c.out:
-			_, err := io.WriteString(c.conn, m+"\r\n")
+		case <-c.sendq.ready():
+			// killed clients only get the short last attempt below
+			if c.isKilled() {
+				alive = false
+				continue
+			}
+			err := flushSendQueue(c, writer, time.Now().Add(writeTimeout))
 			if err != nil {
 				c.kill("Broken pipe")
 				continue
@@ -19,5 +30,30 @@ func handleConnectionOut(c *client) {
 		}
 	}
 
+	// queued lines are handed over with the connection
+	if c.isDetached() {
+		return
+	}
+
+	// try to deliver whatever is left, but do not wait for long. A write
+	// interrupted by kill leaves the writer failed, so start over.
+	writer.Reset(c.conn)
+	flushSendQueue(c, writer, time.Now().Add(time.Second))
+
 	c.conn.Close()
 }
+
+// Writes all queued lines to the connection, giving up at deadline.
+func flushSendQueue(c *client, writer *bufio.Writer, deadline time.Time) error {
+	err := c.conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	for _, line := range c.sendq.drain() {
+		_, err := writer.WriteString(line + "\r\n")
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
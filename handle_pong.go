@@ -5,13 +5,15 @@ import (
 	"time"
 )
 
-func handleConnectionPong(c *client, s *server) {
-	pingDuration := time.Duration(s.pingFrequency) * time.Second
-	pongDuration := time.Duration(s.pongMaxLatency) * time.Second
-
+func handleConnectionPong(c *client, s *Server) {
 	var timer <-chan time.Time
 	alive := true
 	for alive {
+		// class can change during registration
+		class := c.class()
+		pingDuration := time.Duration(class.pingFrequency) * time.Second
+		pongDuration := time.Duration(class.pongMaxLatency) * time.Second
+
 		select {
 		case <-c.killPong:
 			alive = false
@@ -23,7 +25,7 @@ func handleConnectionPong(c *client, s *server) {
 			})
 			timer = time.After(pongDuration)
 		case <-timer:
-			c.kill(fmt.Sprintf("Timeout after %d seconds", s.pongMaxLatency))
+			c.kill(fmt.Sprintf("Timeout after %d seconds", class.pongMaxLatency))
 			continue
 		}
 	}
@@ -0,0 +1,226 @@
+package ircd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHistoryLimit = 100
+
+// How often saved history is written to the database.
+const historyFlushInterval = time.Second
+
+type HistoryStorer interface {
+	// Appends entry to the history of its target.
+	add(entry HistoryEntry) error
+	// Returns up to limit most recent entries of target, oldest first.
+	get(target string, limit int) []HistoryEntry
+	// Writes pending entries to the database, if history is saved.
+	flush() error
+}
+
+// Message sent to a channel.
+type HistoryEntry struct {
+	// Increases with every entry, used to order entries.
+	Seq     uint64
+	Time    time.Time
+	Target  string
+	Prefix  string
+	Command string
+	Text    string
+}
+
+// Channel history kept in memory and optionally saved to a database.
+//
+// Only the most recent entries of each target are kept. Saved entries are
+// written in batches in the background, so up to historyFlushInterval of
+// history can be lost in a crash.
+type HistoryStore struct {
+	mu *sync.RWMutex
+
+	// Nil if history is not saved.
+	db *Database
+	// Writes waiting for the next flush.
+	pending []databaseOp
+	// Serializes flushes so batches are written in order.
+	flushMu *sync.Mutex
+	// Closed to stop the flusher.
+	done chan struct{}
+	// Closed when the flusher has stopped.
+	stopped chan struct{}
+	// Entries per target.
+	limit int
+	seq   uint64
+	// Keyed by lowercase target, oldest first.
+	entries map[string][]HistoryEntry
+}
+
+// Creates a history store that is not saved, keeping limit entries per
+// target.
+func NewHistoryStore(limit int) *HistoryStore {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	return &HistoryStore{
+		mu:      &sync.RWMutex{},
+		flushMu: &sync.Mutex{},
+		limit:   limit,
+		entries: make(map[string][]HistoryEntry),
+	}
+}
+
+// Creates a history store saved to db, existing history is loaded. Close
+// must be called before db is closed.
+func OpenHistoryStore(db *Database, limit int) (*HistoryStore, error) {
+	hs := NewHistoryStore(limit)
+	hs.db = db
+	hs.done = make(chan struct{})
+	hs.stopped = make(chan struct{})
+
+	// keys are ordered by sequence within a target
+	for _, raw := range db.scan("history/") {
+		entry := HistoryEntry{}
+		err := json.Unmarshal(raw, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("cant read history: %w", err)
+		}
+		key := strings.ToLower(entry.Target)
+		hs.entries[key] = append(hs.entries[key], entry)
+		hs.seq = max(hs.seq, entry.Seq)
+	}
+
+	go hs.flusher()
+	return hs, nil
+}
+
+// Writes pending history every historyFlushInterval until the store is
+// closed.
+func (hs *HistoryStore) flusher() {
+	defer close(hs.stopped)
+
+	ticker := time.NewTicker(historyFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// a failed batch stays pending and is retried on the next tick
+			hs.flush()
+		case <-hs.done:
+			return
+		}
+	}
+}
+
+// Writes pending history to the database in one batch.
+func (hs *HistoryStore) flush() error {
+	hs.flushMu.Lock()
+	defer hs.flushMu.Unlock()
+
+	hs.mu.Lock()
+	ops := hs.pending
+	hs.pending = nil
+	hs.mu.Unlock()
+
+	if len(ops) == 0 {
+		return nil
+	}
+	err := hs.db.write(ops...)
+	if err != nil {
+		// put the batch back in front of anything added since
+		hs.mu.Lock()
+		hs.pending = append(ops, hs.pending...)
+		hs.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Stops the background writer and writes pending history. Does nothing if
+// history is not saved.
+func (hs *HistoryStore) Close() error {
+	if hs.db == nil {
+		return nil
+	}
+	select {
+	case <-hs.done:
+	default:
+		close(hs.done)
+	}
+	<-hs.stopped
+	return hs.flush()
+}
+
+func historyKey(entry HistoryEntry) string {
+	return fmt.Sprintf("history/%s/%020d", strings.ToLower(entry.Target), entry.Seq)
+}
+
+func (hs *HistoryStore) add(entry HistoryEntry) error {
+	key := strings.ToLower(entry.Target)
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.seq++
+	entry.Seq = hs.seq
+
+	entries := append(hs.entries[key], entry)
+	trimmed := []HistoryEntry{}
+	if len(entries) > hs.limit {
+		trimmed = entries[:len(entries)-hs.limit]
+		entries = slices.Clone(entries[len(entries)-hs.limit:])
+	}
+	hs.entries[key] = entries
+
+	if hs.db == nil {
+		return nil
+	}
+	op, err := databasePut(historyKey(entry), entry)
+	if err != nil {
+		return err
+	}
+	hs.pending = append(hs.pending, op)
+	for _, old := range trimmed {
+		hs.pending = append(hs.pending, databaseOp{Key: historyKey(old), Delete: true})
+	}
+	return nil
+}
+
+func (hs *HistoryStore) get(target string, limit int) []HistoryEntry {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	entries := hs.entries[strings.ToLower(target)]
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return slices.Clone(entries)
+}
+
+// Returns up to limit most recent messages sent to channel target, oldest
+// first. A limit of 0 returns all kept messages.
+func (s *Server) History(target string, limit int) []HistoryEntry {
+	return s.history.get(target, limit)
+}
+
+// Records a message sent to a channel. Secret and private channels are not
+// recorded.
+func (s *Server) recordHistory(ch channeler, prefix string, command string, text string) {
+	if ch.hasMode(modeChannelSecret) || ch.hasMode(modeChannelPrivate) {
+		return
+	}
+	target := ch.name()
+	err := s.history.add(HistoryEntry{
+		Time:    s.now(),
+		Target:  target,
+		Prefix:  prefix,
+		Command: command,
+		Text:    text,
+	})
+	if err != nil {
+		s.log.Error().Err(err).Msgf("cant save history of %s", target)
+	}
+}
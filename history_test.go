@@ -0,0 +1,134 @@
+package ircd
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, err := OpenHistoryStore(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"one", "two", "three"} {
+		if err := hs.add(HistoryEntry{Target: "#Test", Command: "PRIVMSG", Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hs.add(HistoryEntry{Target: "#other", Command: "PRIVMSG", Text: "other"})
+
+	hs.Close()
+	db.Close()
+	db, err = OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	hs, err = OpenHistoryStore(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hs.Close()
+
+	tcs := []struct {
+		target string
+		limit  int
+		want   []string
+	}{
+		{"#test", 0, []string{"two", "three"}},
+		{"#TEST", 1, []string{"three"}},
+		{"#other", 0, []string{"other"}},
+		{"#none", 0, []string{}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.target, func(t *testing.T) {
+			got := []string{}
+			for _, entry := range hs.get(tc.target, tc.limit) {
+				got = append(got, entry.Text)
+			}
+			if slices.Compare(got, tc.want) != 0 {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+
+	// sequence continues after reopening
+	hs.add(HistoryEntry{Target: "#test", Command: "PRIVMSG", Text: "four"})
+	entries := hs.get("#test", 0)
+	if entries[1].Text != "four" || entries[1].Seq <= entries[0].Seq {
+		t.Errorf("got: %v", entries)
+	}
+}
+
+func TestHistoryStoreBatch(t *testing.T) {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	hs, err := OpenHistoryStore(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hs.Close()
+
+	for _, text := range []string{"one", "two", "three"} {
+		hs.add(HistoryEntry{Target: "#test", Command: "PRIVMSG", Text: text})
+	}
+	// adding does not write to the database
+	if values := db.scan("history/"); len(values) != 0 {
+		t.Fatalf("got entries before flush: %s", values)
+	}
+
+	if err := hs.flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, raw := range db.scan("history/") {
+		got = append(got, string(raw))
+	}
+	if len(got) != 2 {
+		t.Errorf("got: %v, want the 2 most recent entries", got)
+	}
+}
+
+func TestHistorySecretChannels(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+
+	c := newMockClient(true)
+	c.clientID = "alice"
+	c.nick = "alice"
+	s.clients.add(c)
+
+	for _, tc := range []struct {
+		name string
+		mode channelMode
+		want int
+	}{
+		{"#public", 0, 1},
+		{"#secret", modeChannelSecret, 0},
+		{"#private", modeChannelPrivate, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := newChannel(tc.name, "")
+			if tc.mode != 0 {
+				ch.addMode(tc.mode)
+			}
+			ch.clients().add(c)
+			s.channels.add(ch.name(), ch)
+
+			handlePrivmsg(s, c, message{command: "PRIVMSG", params: []string{tc.name, "hello"}})
+			if got := s.History(tc.name, 0); len(got) != tc.want {
+				t.Errorf("got: %v, want %d entries", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package ircd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Message received from a client.
+type Message struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Returns the message in wire format without the trailing CRLF.
+func (m Message) String() string {
+	var b strings.Builder
+	if len(m.Tags) > 0 {
+		tags := []string{}
+		for k, v := range m.Tags {
+			if v == "" {
+				tags = append(tags, k)
+			} else {
+				tags = append(tags, k+"="+v)
+			}
+		}
+		b.WriteString("@" + strings.Join(tags, ";") + " ")
+	}
+	if m.Prefix != "" {
+		b.WriteString(":" + m.Prefix + " ")
+	}
+	b.WriteString(m.Command)
+	for i, p := range m.Params {
+		if i == len(m.Params)-1 && (p == "" || strings.Contains(p, " ") || strings.HasPrefix(p, ":")) {
+			b.WriteString(" :" + p)
+			continue
+		}
+		b.WriteString(" " + p)
+	}
+	return b.String()
+}
+
+func exportMessage(m message) Message {
+	return Message{
+		Tags:    m.tags,
+		Prefix:  m.prefix,
+		Command: m.command,
+		Params:  m.params,
+	}
+}
+
+func (m Message) message() message {
+	return message{
+		raw:     m.String(),
+		tags:    m.Tags,
+		prefix:  m.Prefix,
+		command: m.Command,
+		params:  m.Params,
+	}
+}
+
+// Client passed to commands and event subscribers.
+type Client struct {
+	s *Server
+	c clienter
+}
+
+func (c *Client) ID() string {
+	return string(c.c.id())
+}
+
+func (c *Client) Nickname() string {
+	return c.c.nickname()
+}
+
+// Returns a snapshot of the client.
+func (c *Client) View() ClientView {
+	return c.s.clientView(c.c)
+}
+
+// Sends a raw line to the client.
+func (c *Client) Send(line string) {
+	c.c.send(line)
+}
+
+// Sends a NOTICE from the server to the client.
+func (c *Client) Notice(text string) {
+	c.c.send(fmt.Sprintf(":%s NOTICE %s :%s", c.s.name, c.c.nickname(), text))
+}
+
+// Disconnects the client.
+func (c *Client) Kill(reason string) {
+	c.c.kill(reason)
+}
+
+// Handler for a command registered with RegisterCommand.
+type CommandFunc func(s *Server, c *Client, m Message)
+
+// Command registered with RegisterCommand.
+type Command struct {
+	// Minimum number of parameters.
+	MinParams int
+	// Can only be used after registration.
+	Registered bool
+	// Can only be used by operators.
+	Operator bool
+	Handler  CommandFunc
+}
+
+// Registers a command, replacing any existing command with the same name.
+func (s *Server) RegisterCommand(name string, cmd Command) {
+	mws := []middlewareFunc{}
+	if cmd.Registered || cmd.Operator {
+		mws = append(mws, middlewareNeedHandshake)
+	}
+	if cmd.Operator {
+		mws = append(mws, middlewareNeedOper)
+	}
+	if cmd.MinParams > 0 {
+		mws = append(mws, middlewareNeedParams(cmd.MinParams))
+	}
+
+	s.router.registerHandler(strings.ToUpper(name), func(s *Server, c clienter, m message) {
+		cmd.Handler(s, &Client{s: s, c: c}, exportMessage(m))
+	}, mws...)
+}
+
+// Wraps an existing command.
+//
+// The wrapper is called after the checks of the command (registration,
+// parameters) have passed and decides whether and how to call next. Returns
+// false if the command does not exist.
+func (s *Server) WrapCommand(name string, wrap func(next CommandFunc) CommandFunc) bool {
+	return s.router.wrapHandler(strings.ToUpper(name), func(h handlerFunc) handlerFunc {
+		next := func(s *Server, c *Client, m Message) {
+			h(s, c.c, m.message())
+		}
+		wrapped := wrap(next)
+		return func(s *Server, c clienter, m message) {
+			wrapped(s, &Client{s: s, c: c}, exportMessage(m))
+		}
+	})
+}
+
+// Client connected, returning false disconnects it.
+type ConnectEvent struct {
+	Client *Client
+}
+
+// Client completed registration, returning false disconnects it.
+type RegisterEvent struct {
+	Client *Client
+}
+
+// Client is joining a channel, returning false prevents the join.
+type JoinEvent struct {
+	Client  *Client
+	Channel string
+}
+
+// Client is leaving a channel, returning false prevents the part. Reason can
+// be rewritten.
+type PartEvent struct {
+	Client  *Client
+	Channel string
+	Reason  string
+}
+
+// Client is sending a message to a channel or a client, returning false
+// drops the message. Text can be rewritten.
+type PrivmsgEvent struct {
+	Client *Client
+	Target string
+	Text   string
+	// True if the message is a NOTICE.
+	Notice bool
+}
+
+// Client is changing nickname, returning false keeps the old nickname.
+type NickEvent struct {
+	Client *Client
+	Old    string
+	New    string
+}
+
+// Client is changing modes of target, returning false ignores the change.
+// Modes and Args can be rewritten.
+type ModeEvent struct {
+	Client *Client
+	Target string
+	Modes  string
+	Args   []string
+}
+
+// Client is disconnecting, returning false hides the quit from other
+// clients. Reason can be rewritten.
+type QuitEvent struct {
+	Client *Client
+	Reason string
+}
+
+// Events that can be subscribed to.
+type Event interface {
+	ConnectEvent | RegisterEvent | JoinEvent | PartEvent | PrivmsgEvent | NickEvent | ModeEvent | QuitEvent
+}
+
+type hooks struct {
+	mu       *sync.RWMutex
+	handlers map[reflect.Type][]any
+}
+
+func newHooks() *hooks {
+	return &hooks{
+		mu:       &sync.RWMutex{},
+		handlers: make(map[reflect.Type][]any),
+	}
+}
+
+// Calls fn for every event of type E.
+//
+// Subscribers are called in the order they were added from the goroutine of
+// the client causing the event. If a subscriber returns false the action is
+// vetoed and later subscribers are not called.
+func Subscribe[E Event](s *Server, fn func(e *E) bool) {
+	t := reflect.TypeFor[E]()
+	s.hooks.mu.Lock()
+	s.hooks.handlers[t] = append(s.hooks.handlers[t], fn)
+	s.hooks.mu.Unlock()
+}
+
+// Calls subscribers of E, returns false if the event was vetoed.
+func emit[E Event](s *Server, e *E) bool {
+	s.hooks.mu.RLock()
+	handlers := s.hooks.handlers[reflect.TypeFor[E]()]
+	s.hooks.mu.RUnlock()
+
+	for _, h := range handlers {
+		if !h.(func(e *E) bool)(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package ircd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func newHookServer() *Server {
+	return NewServer(
+		ServerConfig{Name: "server"},
+		WithLogger(zerolog.Nop()),
+		WithMetricsRegistry(prometheus.NewRegistry()),
+	)
+}
+
+func TestMessageString(t *testing.T) {
+	type tc struct {
+		input Message
+		want  string
+	}
+
+	tcs := []tc{
+		{
+			input: Message{Command: "PING", Params: []string{"token"}},
+			want:  "PING token",
+		},
+		{
+			input: Message{Prefix: "nick", Command: "PRIVMSG", Params: []string{"#test", "hello world"}},
+			want:  ":nick PRIVMSG #test :hello world",
+		},
+		{
+			input: Message{Command: "TOPIC", Params: []string{"#test", ""}},
+			want:  "TOPIC #test :",
+		},
+	}
+
+	for _, tc := range tcs {
+		if got := tc.input.String(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	s := newHookServer()
+	s.RegisterCommand("hello", Command{
+		MinParams:  1,
+		Registered: true,
+		Handler: func(s *Server, c *Client, m Message) {
+			c.Notice("hello " + m.Params[0])
+		},
+	})
+
+	c := newMockClient(true)
+	err := s.router.handle(s, c, message{command: "HELLO", params: []string{"world"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{":server NOTICE mocknick :hello world"}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", c.messagesOut, want)
+	}
+
+	// parameters are checked before the handler is called
+	c.reset()
+	s.router.handle(s, c, message{command: "HELLO", params: []string{}})
+	if len(c.messagesOut) != 1 || !strings.HasPrefix(c.messagesOut[0], "461 ") {
+		t.Errorf("got %v, want ERR_NEEDMOREPARAMS", c.messagesOut)
+	}
+}
+
+func TestWrapCommand(t *testing.T) {
+	s := newHookServer()
+	ok := s.WrapCommand("PING", func(next CommandFunc) CommandFunc {
+		return func(s *Server, c *Client, m Message) {
+			if m.Params[0] == "blocked" {
+				c.Notice("no")
+				return
+			}
+			m.Params = []string{strings.ToUpper(m.Params[0])}
+			next(s, c, m)
+		}
+	})
+	if !ok {
+		t.Fatal("PING not wrapped")
+	}
+	if s.WrapCommand("NOSUCHCOMMAND", func(next CommandFunc) CommandFunc { return next }) {
+		t.Error("wrapped command that does not exist")
+	}
+
+	c := newMockClient(true)
+	s.router.handle(s, c, message{command: "PING", params: []string{"blocked"}})
+	s.router.handle(s, c, message{command: "PING", params: []string{"token"}})
+	want := []string{
+		":server NOTICE mocknick :no",
+		"PONG TOKEN",
+	}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", c.messagesOut, want)
+	}
+}
+
+func TestSubscribePrivmsg(t *testing.T) {
+	s := newHookServer()
+	Subscribe(s, func(e *PrivmsgEvent) bool {
+		if strings.Contains(e.Text, "spam") {
+			return false
+		}
+		e.Text = strings.ReplaceAll(e.Text, "darn", "****")
+		return true
+	})
+
+	sender := newMockClient(true)
+	receiver := newMockClient(true)
+	receiver.clientID = "54321"
+	receiver.nick = "receiver"
+	s.clients.add(sender)
+	s.clients.add(receiver)
+
+	ch := newChannel("#test", sender.id())
+	ch.clients().add(sender)
+	ch.clients().add(receiver)
+	s.channels.add(ch.name(), ch)
+
+	handlePrivmsg(s, sender, message{command: "PRIVMSG", params: []string{"#test", "buy spam"}})
+	handlePrivmsg(s, sender, message{command: "PRIVMSG", params: []string{"#test", "darn it"}})
+
+	want := []string{":mocknick!mockuser@mockhost PRIVMSG #test :**** it"}
+	if slices.Compare(receiver.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", receiver.messagesOut, want)
+	}
+
+	receiver.reset()
+	handleNotice(s, sender, message{command: "NOTICE", params: []string{"#test", "buy spam"}})
+	handleNotice(s, sender, message{command: "NOTICE", params: []string{"receiver", "buy spam"}})
+	handleNotice(s, sender, message{command: "NOTICE", params: []string{"#test", "darn it"}})
+	handleNotice(s, sender, message{command: "NOTICE", params: []string{"receiver", "darn it"}})
+
+	want = []string{
+		":mocknick!mockuser@mockhost NOTICE #test :**** it",
+		":mocknick!mockuser@mockhost NOTICE receiver :**** it",
+	}
+	if slices.Compare(receiver.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", receiver.messagesOut, want)
+	}
+}
+
+func TestSubscribeNick(t *testing.T) {
+	s := newHookServer()
+	Subscribe(s, func(e *NickEvent) bool {
+		return !strings.HasPrefix(e.New, "bad")
+	})
+
+	c := newMockClient(true)
+	other := newMockClient(true)
+	other.clientID = "54321"
+	other.nick = "other"
+	s.clients.add(c)
+	s.clients.add(other)
+
+	ch := newChannel("#test", c.id())
+	ch.clients().add(c)
+	ch.clients().add(other)
+	s.channels.add(ch.name(), ch)
+
+	handleNick(s, c, message{command: "NICK", params: []string{"badnick"}})
+	if c.nickname() != "mocknick" {
+		t.Errorf("vetoed nick was changed to %s", c.nickname())
+	}
+
+	handleNick(s, c, message{command: "NICK", params: []string{"goodnick"}})
+	want := []string{":mocknick!mockuser@mockhost NICK goodnick"}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", c.messagesOut, want)
+	}
+	if slices.Compare(other.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", other.messagesOut, want)
+	}
+}
@@ -0,0 +1,89 @@
+package ircd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	identPort           = 113
+	defaultIdentTimeout = 5
+)
+
+// RFC 1413 ident lookup.
+//
+// Connects to the ident port on the remote host and asks which user owns the
+// connection between remote and local.
+//
+// https://datatracker.ietf.org/doc/html/rfc1413
+func identLookup(remote *net.TCPAddr, local *net.TCPAddr, port int, timeout time.Duration) (string, error) {
+	dialer := net.Dialer{
+		Timeout: timeout,
+		// connect from the address the client connected to
+		LocalAddr: &net.TCPAddr{IP: local.IP},
+	}
+
+	conn, err := dialer.Dial("tcp", net.JoinHostPort(remote.IP.String(), strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return "", err
+	}
+
+	_, err = fmt.Fprintf(conn, "%d, %d\r\n", remote.Port, local.Port)
+	if err != nil {
+		return "", err
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return parseIdentResponse(line, remote.Port, local.Port)
+}
+
+// Parses ident response.
+//
+// Example: 6193, 23 : USERID : UNIX : stjohns
+func parseIdentResponse(line string, remotePort int, localPort int) (string, error) {
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), ":", 4)
+	if len(fields) < 3 {
+		return "", errorIdentMalformed
+	}
+
+	ports := strings.Split(fields[0], ",")
+	if len(ports) != 2 {
+		return "", errorIdentMalformed
+	}
+	rp, err := strconv.Atoi(strings.TrimSpace(ports[0]))
+	if err != nil {
+		return "", errorIdentMalformed
+	}
+	lp, err := strconv.Atoi(strings.TrimSpace(ports[1]))
+	if err != nil {
+		return "", errorIdentMalformed
+	}
+	if rp != remotePort || lp != localPort {
+		return "", errorIdentPortMismatch
+	}
+
+	if strings.TrimSpace(fields[1]) != "USERID" || len(fields) != 4 {
+		return "", errorIdentNoUser
+	}
+
+	user := strings.TrimSpace(fields[3])
+	if user == "" {
+		return "", errorIdentNoUser
+	}
+
+	return user, nil
+}
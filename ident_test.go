@@ -0,0 +1,63 @@
+package ircd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIdentResponse(t *testing.T) {
+	type tc struct {
+		input string
+		want  string
+		err   error
+	}
+
+	tcs := []tc{
+		{input: "6193, 23 : USERID : UNIX : stjohns\r\n", want: "stjohns", err: nil},
+		{input: "6193,23:USERID:UNIX:stjohns", want: "stjohns", err: nil},
+		{input: "6193, 23 : ERROR : NO-USER", want: "", err: errorIdentNoUser},
+		{input: "6193, 24 : USERID : UNIX : stjohns", want: "", err: errorIdentPortMismatch},
+		{input: "garbage", want: "", err: errorIdentMalformed},
+	}
+
+	for _, tc := range tcs {
+		got, err := parseIdentResponse(tc.input, 6193, 23)
+		if got != tc.want || err != tc.err {
+			t.Errorf("got %s (%v), want %s (%v)", got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestIdentLookup(t *testing.T) {
+	identd, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer identd.Close()
+
+	go func() {
+		conn, err := identd.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		fmt.Fprintf(conn, "%s : USERID : UNIX : alice\r\n", strings.TrimSpace(line))
+	}()
+
+	remote := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 40000}
+	local := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 6667}
+	port := identd.Addr().(*net.TCPAddr).Port
+
+	got, err := identLookup(remote, local, port, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "alice" {
+		t.Errorf("got %s, want %s", got, "alice")
+	}
+}
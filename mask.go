@@ -1,51 +1,223 @@
 package ircd
 
-func parseMask(mask string) ([]byte, error) {
-	var result []byte
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+// Casemapping used to compare nicknames and masks.
+//
+// https://modern.ircdocs.horse/#casemapping-parameter
+type casemapping int
+
+const (
+	casemappingASCII casemapping = iota
+	casemappingRFC1459
+	casemappingStrictRFC1459
+)
+
+// Parses the CASEMAPPING parameter, unknown values are ascii.
+func parseCasemapping(name string) casemapping {
+	switch strings.ToLower(name) {
+	case "rfc1459":
+		return casemappingRFC1459
+	case "strict-rfc1459":
+		return casemappingStrictRFC1459
+	default:
+		return casemappingASCII
+	}
+}
 
-	for _, char := range mask {
+// Lowercases s. Only ASCII characters are changed, rfc1459 also treats []\^
+// as the uppercase of {}|~ and strict-rfc1459 does the same except for ^.
+func (cm casemapping) fold(s string) string {
+	b := []byte(s)
+	for i, char := range b {
 		switch {
-		case char == '?':
-			result = append(result, 0x3F)
-		case char == '*':
-			result = append(result, 0x2A)
-		case (char >= 0x01 && char <= 0x29) || (char >= 0x2B && char <= 0x3E) || (char >= 0x40 && char <= 0xFF):
-			result = append(result, byte(char))
-		case (char >= 0x01 && char <= 0x5B) || (char >= 0x5D && char <= 0xFF):
-			result = append(result, byte(char))
-		default:
-			return nil, errorBadMaskCharacter
+		case char >= 'A' && char <= 'Z':
+			b[i] = char + 'a' - 'A'
+		case cm == casemappingASCII:
+		case char >= '[' && char <= ']':
+			b[i] = char + '{' - '['
+		case char == '^' && cm == casemappingRFC1459:
+			b[i] = '~'
 		}
 	}
+	return string(b)
+}
 
-	return result, nil
+// Checks that mask has no characters that can not appear in a message.
+//
+// * matches any number of bytes and ? matches exactly one byte, every other
+// byte matches itself.
+func parseMask(mask string) ([]byte, error) {
+	if strings.ContainsAny(mask, "\x00\r\n") {
+		return nil, errorBadMaskCharacter
+	}
+	return []byte(mask), nil
 }
 
+// Does mask match all of input? An empty mask matches everything.
+//
+// Stars never backtrack: the parts between stars are matched at the first
+// position they fit, so input is scanned once per part.
 func matchMask(mask []byte, input string) bool {
 	if len(mask) == 0 {
 		return true
 	}
 
-	if len(mask) > len(input) {
+	parts := bytes.Split(mask, []byte("*"))
+	if len(parts) == 1 {
+		return len(mask) == len(input) && matchMaskPart(mask, input)
+	}
+
+	first, last := parts[0], parts[len(parts)-1]
+	if len(first)+len(last) > len(input) {
+		return false
+	}
+	if !matchMaskPart(first, input[:len(first)]) || !matchMaskPart(last, input[len(input)-len(last):]) {
 		return false
 	}
 
-	for i := 0; i < len(mask); i++ {
-		switch mask[i] {
-		case '?':
-			continue
-		case '*':
-			for j := 0; j <= len(input)-i; j++ {
-				if matchMask(mask[i+1:], input[i+j:]) {
-					return true
-				}
-			}
+	input = input[len(first) : len(input)-len(last)]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := indexMaskPart(part, input)
+		if i < 0 {
 			return false
-		default:
-			if mask[i] != input[i] {
-				return false
-			}
 		}
+		input = input[i+len(part):]
 	}
 	return true
 }
+
+// Does part, which has no stars, match input of the same length?
+func matchMaskPart(part []byte, input string) bool {
+	for i, char := range part {
+		if char != '?' && char != input[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the first position in input where part matches, or -1.
+func indexMaskPart(part []byte, input string) int {
+	if bytes.IndexByte(part, '?') < 0 {
+		return strings.Index(input, string(part))
+	}
+	for i := 0; i+len(part) <= len(input); i++ {
+		if matchMaskPart(part, input[i:i+len(part)]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Parsed nick!user@host or user@host mask.
+type hostMask struct {
+	// Everything before the last @, * if the mask has no @.
+	user []byte
+	host []byte
+	// Set if the host is a CIDR range such as 192.0.2.0/24.
+	network *net.IPNet
+}
+
+func parseHostMask(cm casemapping, mask string) (hostMask, error) {
+	user, host := "*", mask
+	if i := strings.LastIndexByte(mask, '@'); i >= 0 {
+		user, host = mask[:i], mask[i+1:]
+	}
+
+	m := hostMask{}
+	var err error
+	m.user, err = parseMask(cm.fold(user))
+	if err != nil {
+		return hostMask{}, err
+	}
+	if strings.Contains(host, "/") {
+		if _, network, err := net.ParseCIDR(host); err == nil {
+			m.network = network
+			return m, nil
+		}
+	}
+	m.host, err = parseMask(cm.fold(host))
+	if err != nil {
+		return hostMask{}, err
+	}
+	return m, nil
+}
+
+// Does the mask match user (nick!user or user) on any of hosts? A CIDR mask
+// only matches hosts that are IP addresses in its range.
+func (m hostMask) match(cm casemapping, user string, hosts ...string) bool {
+	if !matchMask(m.user, cm.fold(user)) {
+		return false
+	}
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		if m.network != nil {
+			if ip := net.ParseIP(host); ip != nil && m.network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if matchMask(m.host, cm.fold(host)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expands a partial mask to nick!user@host.
+//
+// Example: nick becomes nick!*@*, user@host becomes *!user@host and
+// example.com becomes *!*@example.com.
+func normalizeMask(mask string) string {
+	hasNick := strings.Contains(mask, "!")
+	hasHost := strings.Contains(mask, "@")
+
+	switch {
+	case hasNick && hasHost:
+		return mask
+	case hasNick:
+		return mask + "@*"
+	case hasHost:
+		return "*!" + mask
+	case strings.ContainsAny(mask, ".:"):
+		return "*!*@" + mask
+	default:
+		return mask + "!*@*"
+	}
+}
+
+// Does nick!user@host mask match the prefix of c with its visible hostname,
+// real hostname or IP address?
+func matchClientMask(cm casemapping, mask string, c clienter) bool {
+	m, err := parseHostMask(cm, mask)
+	if err != nil {
+		return false
+	}
+	return m.match(cm, c.nickname()+"!"+c.username(), c.hostname(), c.realhost(), c.ip())
+}
+
+// Does user@host mask match the username of c on its real hostname or IP
+// address? Used for K-lines and operator hosts, which ignore cloaks.
+func matchUserHostMask(cm casemapping, mask string, c clienter) bool {
+	m, err := parseHostMask(cm, mask)
+	if err != nil {
+		return false
+	}
+	return m.match(cm, c.username(), c.realhost(), c.ip())
+}
+
+// Does mask match input under cm?
+func matchPattern(cm casemapping, mask string, input string) bool {
+	m, err := parseMask(cm.fold(mask))
+	if err != nil {
+		return false
+	}
+	return matchMask(m, cm.fold(input))
+}
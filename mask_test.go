@@ -1,7 +1,9 @@
 package ircd
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestMask(t *testing.T) {
@@ -67,6 +69,31 @@ func TestMask(t *testing.T) {
 			mask:  "asd!zxc@foo.ru",
 			want:  false,
 		},
+		{
+			input: "nick!user@host.com",
+			mask:  "nick!user@host",
+			want:  false,
+		},
+		{
+			input: "nick!user@host.com",
+			mask:  "*!*@*.*",
+			want:  true,
+		},
+		{
+			input: "aaa",
+			mask:  "a*a*a*a",
+			want:  false,
+		},
+		{
+			input: "abcbcxd",
+			mask:  "*bc?d",
+			want:  true,
+		},
+		{
+			input: "",
+			mask:  "*",
+			want:  true,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -102,3 +129,94 @@ func TestBadMaskCharacter(t *testing.T) {
 	}
 
 }
+
+func TestNormalizeMask(t *testing.T) {
+	tcs := []struct {
+		input string
+		want  string
+	}{
+		{input: "nick", want: "nick!*@*"},
+		{input: "nick!user", want: "nick!user@*"},
+		{input: "user@host", want: "*!user@host"},
+		{input: "host.example.com", want: "*!*@host.example.com"},
+		{input: "2001:db8::1", want: "*!*@2001:db8::1"},
+		{input: "nick!user@host", want: "nick!user@host"},
+	}
+
+	for _, tc := range tcs {
+		got := normalizeMask(tc.input)
+		if got != tc.want {
+			t.Errorf("got: %s, want: %s", got, tc.want)
+		}
+	}
+}
+
+func TestMaskLinear(t *testing.T) {
+	mask, err := parseMask(strings.Repeat("*a", 100) + "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Repeat("a", 500)
+
+	start := time.Now()
+	if matchMask(mask, input) {
+		t.Error("mask matched")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s", elapsed)
+	}
+}
+
+func TestCasemappingFold(t *testing.T) {
+	tcs := []struct {
+		casemapping string
+		input       string
+		want        string
+	}{
+		{casemapping: "ascii", input: "Nick[]\\^", want: "nick[]\\^"},
+		{casemapping: "rfc1459", input: "Nick[]\\^", want: "nick{}|~"},
+		{casemapping: "strict-rfc1459", input: "Nick[]\\^", want: "nick{}|^"},
+		{casemapping: "", input: "ÄBC", want: "Äbc"},
+	}
+
+	for _, tc := range tcs {
+		got := parseCasemapping(tc.casemapping).fold(tc.input)
+		if got != tc.want {
+			t.Errorf("%s: got: %s, want: %s", tc.casemapping, got, tc.want)
+		}
+	}
+}
+
+func TestMatchClientMask(t *testing.T) {
+	c := newMockClient(true)
+	c.nick = "Nick[1]"
+	c.user = "~User"
+	c.host = "cloaked.ip"
+	c.rhost = "host.example.com"
+	c.addr = "192.0.2.10"
+
+	tcs := []struct {
+		mask        string
+		casemapping casemapping
+		want        bool
+	}{
+		{mask: "nick[1]!*@*", casemapping: casemappingASCII, want: true},
+		{mask: "nick{1}!*@*", casemapping: casemappingASCII, want: false},
+		{mask: "nick{1}!*@*", casemapping: casemappingRFC1459, want: true},
+		{mask: "*!~user@cloaked.ip", casemapping: casemappingASCII, want: true},
+		{mask: "*!*@HOST.example.com", casemapping: casemappingASCII, want: true},
+		{mask: "*!*@192.0.2.*", casemapping: casemappingASCII, want: true},
+		{mask: "*!*@192.0.2.0/24", casemapping: casemappingASCII, want: true},
+		{mask: "*!*@192.0.2.0/29", casemapping: casemappingASCII, want: false},
+		{mask: "other!*@192.0.2.0/24", casemapping: casemappingASCII, want: false},
+		{mask: "*!*@host", casemapping: casemappingASCII, want: false},
+		{mask: "nick", casemapping: casemappingASCII, want: false},
+	}
+
+	for _, tc := range tcs {
+		got := matchClientMask(tc.casemapping, tc.mask, c)
+		if got != tc.want {
+			t.Errorf("%s: got: %t, want: %t", tc.mask, got, tc.want)
+		}
+	}
+}
@@ -2,25 +2,43 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var (
 	// Number of connected clients.
-	Clients = promauto.NewGauge(prometheus.GaugeOpts{
+	Clients = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "ircd",
 		Name:      "clients",
 		Help:      "Number of connected clients.",
 	})
 	// Number of existing channels.
-	Channels = promauto.NewGauge(prometheus.GaugeOpts{
+	Channels = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "ircd",
 		Name:      "channels",
 		Help:      "Number of existing channels.",
 	})
+	// Number of connections rejected by connection limits.
+	// This is a vector where the only label is 'reason'.
+	Rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ircd",
+		Name:      "rejected",
+		Help:      "Number of connections rejected by connection limits.",
+	}, []string{"reason"})
+	// Number of bytes waiting in client send queues.
+	SendQueue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ircd",
+		Name:      "sendq_bytes",
+		Help:      "Number of bytes waiting in client send queues.",
+	})
+	// Number of clients disconnected for exceeding their send queue.
+	SendQueueExceeded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ircd",
+		Name:      "sendq_exceeded",
+		Help:      "Number of clients disconnected for exceeding their send queue.",
+	})
 	// Number of commands received.
 	// This is a vector where the only label is 'name'.
-	Command = promauto.NewCounterVec(prometheus.CounterOpts{
+	Command = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "ircd",
 		Name:      "command",
 		Help:      "Number of commands received.",
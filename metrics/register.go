@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registers all metrics with registerer.
+//
+// Metrics that are already registered are skipped, so it is safe to call
+// Register for every server sharing a registry.
+func Register(registerer prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		Clients,
+		Channels,
+		Rejected,
+		SendQueue,
+		SendQueueExceeded,
+		Command,
+	}
+
+	for _, collector := range collectors {
+		err := registerer.Register(collector)
+		var are prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &are) {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,7 +13,7 @@ func TestMiddlewareHandshake(t *testing.T) {
 
 	t.Run("not registered", func(t *testing.T) {
 		want := []string{"451 mocknick :You have not registered."}
-		middlewareNeedHandshake(s, c, m, func(s *server, c clienter, m message) {})
+		middlewareNeedHandshake(s, c, m, func(s *Server, c clienter, m message) {})
 		if slices.Compare(c.messagesOut, want) != 0 {
 			t.Errorf("got: %v, want: %v", c.messagesOut, want)
 		}
@@ -24,7 +24,7 @@ func TestMiddlewareHandshake(t *testing.T) {
 
 	t.Run("registered", func(t *testing.T) {
 		want := []string{}
-		middlewareNeedHandshake(s, c, m, func(s *server, c clienter, m message) {})
+		middlewareNeedHandshake(s, c, m, func(s *Server, c clienter, m message) {})
 		if slices.Compare(c.messagesOut, want) != 0 {
 			t.Errorf("got: %v, want: %v", c.messagesOut, want)
 		}
@@ -1,7 +1,7 @@
 package ircd
 
 // Require client to be an operator for commands using this middleware.
-func middlewareNeedOper(s *server, c clienter, _ message, next handlerFunc) handlerFunc {
+func middlewareNeedOper(s *Server, c clienter, _ message, next handlerFunc) handlerFunc {
 	if !c.hasMode(modeClientOperator) {
 		c.sendRPL(s.name, errNoPrivileges{
 			client: c.nickname(),
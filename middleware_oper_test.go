@@ -12,7 +12,7 @@ func TestMiddlewareOper(t *testing.T) {
 
 	t.Run("not an op", func(t *testing.T) {
 		want := []string{"481 mocknick :Permission Denied - You're not an IRC operator."}
-		middlewareNeedOper(s, c, m, func(s *server, c clienter, m message) {})
+		middlewareNeedOper(s, c, m, func(s *Server, c clienter, m message) {})
 		if slices.Compare(c.messagesOut, want) != 0 {
 			t.Errorf("got: %v, want: %v", c.messagesOut, want)
 		}
@@ -23,7 +23,7 @@ func TestMiddlewareOper(t *testing.T) {
 
 	t.Run("is an op", func(t *testing.T) {
 		want := []string{}
-		middlewareNeedOper(s, c, m, func(s *server, c clienter, m message) {})
+		middlewareNeedOper(s, c, m, func(s *Server, c clienter, m message) {})
 		if slices.Compare(c.messagesOut, want) != 0 {
 			t.Errorf("got: %v, want: %v", c.messagesOut, want)
 		}
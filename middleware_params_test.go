@@ -11,7 +11,7 @@ func TestMiddlewareParams(t *testing.T) {
 	m := message{command: "TEST", params: []string{"one"}}
 
 	r := NewCommandRouter(s)
-	r.registerHandler("TEST", func(s *server, c clienter, m message) {}, middlewareNeedParams(2))
+	r.registerHandler("TEST", func(s *Server, c clienter, m message) {}, middlewareNeedParams(2))
 	r.handle(s, c, m)
 
 	t.Run("not enough params", func(t *testing.T) {
@@ -23,7 +23,7 @@ func TestMiddlewareParams(t *testing.T) {
 
 	c.reset()
 
-	r.registerHandler("TEST", func(s *server, c clienter, m message) {}, middlewareNeedParams(1))
+	r.registerHandler("TEST", func(s *Server, c clienter, m message) {}, middlewareNeedParams(1))
 	r.handle(s, c, m)
 
 	t.Run("enough params", func(t *testing.T) {
@@ -6,6 +6,8 @@ import (
 	"net"
 	"slices"
 	"time"
+
+	"github.com/rs/zerolog"
 )
 
 type connMock struct {
@@ -31,6 +33,20 @@ func (C *connMock) RemoteAddr() net.Addr {
 	}
 }
 
+// In-memory connection with the addresses of connMock, writes block until
+// the other end reads.
+type pipeConnMock struct {
+	net.Conn
+}
+
+func newPipeConnMock() (*pipeConnMock, net.Conn) {
+	conn, peer := net.Pipe()
+	return &pipeConnMock{Conn: conn}, peer
+}
+
+func (c *pipeConnMock) LocalAddr() net.Addr  { return (&connMock{}).LocalAddr() }
+func (c *pipeConnMock) RemoteAddr() net.Addr { return (&connMock{}).RemoteAddr() }
+
 type clientMock struct {
 	messagesIn   []string
 	messagesOut  []string
@@ -42,14 +58,21 @@ type clientMock struct {
 
 	nick   string
 	user   string
+	idnt   string
 	real   string
 	host   string
+	rhost  string
 	secure bool
 	afk    string
 	hs     bool
-	pw     bool
+	pw     string
+	fp     string
+	acct   string
+	cls    *connectionClass
 	modes  clientMode
 	q      string
+	caps   map[string]bool
+	capNeg bool
 }
 
 func newMockClient(handshake bool) *clientMock {
@@ -64,11 +87,14 @@ func newMockClient(handshake bool) *clientMock {
 		user:         "mockuser",
 		real:         "mockreal",
 		host:         "mockhost",
+		rhost:        "mockhost",
 		secure:       false,
 		afk:          "",
 		hs:           handshake,
-		pw:           false,
+		pw:           "",
+		cls:          newConnectionClass(ConnectionClass{Name: "default"}, zerolog.Nop()),
 		modes:        0,
+		caps:         make(map[string]bool),
 	}
 }
 
@@ -104,6 +130,14 @@ func (c *clientMock) username() string {
 	return c.user
 }
 
+func (c *clientMock) ident() string {
+	return c.idnt
+}
+
+func (c *clientMock) setIdent(ident string) {
+	c.idnt = ident
+}
+
 func (c *clientMock) realname() string {
 	return c.real
 }
@@ -121,6 +155,14 @@ func (c *clientMock) setHostname(hostname string) {
 	c.host = hostname
 }
 
+func (c *clientMock) realhost() string {
+	return c.rhost
+}
+
+func (c *clientMock) setRealhost(hostname string) {
+	c.rhost = hostname
+}
+
 func (c *clientMock) tls() bool {
 	return c.secure
 }
@@ -137,6 +179,12 @@ func (c *clientMock) setAway(text string) {
 	c.afk = text
 }
 
+func (c *clientMock) lookups() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
 func (c *clientMock) handshake() bool {
 	return c.hs
 }
@@ -145,12 +193,32 @@ func (c *clientMock) setHandshake(handshake bool) {
 	c.hs = handshake
 }
 
-func (c *clientMock) password() bool {
+func (c *clientMock) password() string {
 	return c.pw
 }
 
-func (c *clientMock) setPassword(correct bool) {
-	c.pw = correct
+func (c *clientMock) setPassword(password string) {
+	c.pw = password
+}
+
+func (c *clientMock) certfp() string {
+	return c.fp
+}
+
+func (c *clientMock) account() string {
+	return c.acct
+}
+
+func (c *clientMock) setAccount(account string) {
+	c.acct = account
+}
+
+func (c *clientMock) class() *connectionClass {
+	return c.cls
+}
+
+func (c *clientMock) setClass(class *connectionClass) {
+	c.cls = class
 }
 
 func (c *clientMock) prefix() string {
@@ -204,6 +272,38 @@ func (c *clientMock) setQuitreason(reason string) {
 	c.q = reason
 }
 
+func (c *clientMock) hasCapability(capability string) bool {
+	return c.caps[capability]
+}
+
+func (c *clientMock) setCapability(capability string, enabled bool) {
+	if c.caps == nil {
+		c.caps = make(map[string]bool)
+	}
+	if enabled {
+		c.caps[capability] = true
+	} else {
+		delete(c.caps, capability)
+	}
+}
+
+func (c *clientMock) capabilities() []string {
+	caps := []string{}
+	for capability := range c.caps {
+		caps = append(caps, capability)
+	}
+	slices.Sort(caps)
+	return caps
+}
+
+func (c *clientMock) negotiating() bool {
+	return c.capNeg
+}
+
+func (c *clientMock) setNegotiating(negotiating bool) {
+	c.capNeg = negotiating
+}
+
 func (c *clientMock) send(text string) {
 	c.messagesOut = append(c.messagesOut, text)
 }
@@ -1,5 +1,10 @@
 package ircd
 
+import (
+	"strconv"
+	"strings"
+)
+
 // client modes
 type clientMode uint16
 
@@ -27,6 +32,8 @@ type channelMode uint16
 var channelModeMap = map[rune]channelMode{
 	'i': modeChannelInviteOnly,
 	'k': modeChannelKey,
+	'l': modeChannelLimit,
+	'f': modeChannelForward,
 	'm': modeChannelModerated,
 	's': modeChannelSecret,
 	'p': modeChannelPrivate,
@@ -52,6 +59,8 @@ const (
 	modeChannelNoExternal
 	modeChannelTLSOnly
 	modeChannelRestrictTopic
+	modeChannelLimit
+	modeChannelForward
 )
 
 type channelMembershipMode uint16
@@ -125,18 +134,107 @@ func parseModestring[T ~uint16](modestring string, m map[rune]T) (add []T, del [
 // Add represents modes that been added from the original list..
 //
 // Del represents modes that been removed from the original list.
+//
+// Modes are ordered by their bit so the result does not depend on map order.
 func diffModes[T ~uint16](old T, new T, m map[rune]T) (add []T, del []T) {
 	d := old ^ new
 
+	known := T(0)
 	for _, b := range m {
-		if d&b != 0 {
-			if new&b != 0 {
-				add = append(add, b)
-			} else {
-				del = append(del, b)
-			}
+		known |= b
+	}
+
+	for b := T(1); b != 0; b <<= 1 {
+		if d&b == 0 || known&b == 0 {
+			continue
+		}
+		if new&b != 0 {
+			add = append(add, b)
+		} else {
+			del = append(del, b)
 		}
 	}
 
 	return add, del
 }
+
+// Channel mode types.
+//
+// https://modern.ircdocs.horse/#chanmodes-parameter
+type channelModeType int
+
+const (
+	// Type A, list of masks. Always has a parameter, listed without one.
+	channelModeTypeList channelModeType = iota
+	// Type B, always has a parameter.
+	channelModeTypeParam
+	// Type C, has a parameter only when set.
+	channelModeTypeSetParam
+	// Type D, never has a parameter.
+	channelModeTypeFlag
+	// Membership prefix from the PREFIX parameter, always has a nickname.
+	channelModeTypePrefix
+)
+
+const (
+	defaultChannelModes    = "beI,k,fl,CimnOprRstz"
+	defaultChannelPrefixes = "(qaohv)~&@%+"
+	// Entries per list mode if MAXLIST does not limit it.
+	defaultMaxList = 100
+)
+
+// Classifies channel modes using the CHANMODES and PREFIX parameters.
+//
+// Example: chanmodes b,k,l,imnt and prefixes (ov)@+
+func parseChannelModeTypes(chanmodes string, prefixes string) map[rune]channelModeType {
+	if chanmodes == "" {
+		chanmodes = defaultChannelModes
+	}
+	if prefixes == "" {
+		prefixes = defaultChannelPrefixes
+	}
+
+	types := make(map[rune]channelModeType)
+
+	for i, group := range strings.SplitN(chanmodes, ",", 4) {
+		for _, r := range group {
+			types[r] = channelModeType(i)
+		}
+	}
+
+	// (qaohv)~&@%+
+	if strings.HasPrefix(prefixes, "(") {
+		if end := strings.Index(prefixes, ")"); end > 0 {
+			for _, r := range prefixes[1:end] {
+				types[r] = channelModeTypePrefix
+			}
+		}
+	}
+
+	return types
+}
+
+// Number of entries list modes can hold together.
+type listLimit struct {
+	modes string
+	limit int
+}
+
+// Parses the MAXLIST parameter.
+//
+// Example: beI:100,q:50
+func parseMaxList(maxlist string) []listLimit {
+	limits := []listLimit{}
+	for _, group := range strings.Split(maxlist, ",") {
+		modes, limit, ok := strings.Cut(group, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			continue
+		}
+		limits = append(limits, listLimit{modes: modes, limit: n})
+	}
+	return limits
+}
@@ -178,3 +178,30 @@ func TestDiffModes(t *testing.T) {
 	}
 
 }
+
+func TestParseChannelModeTypes(t *testing.T) {
+	types := parseChannelModeTypes("beI,k,l,imnt", "(ov)@+")
+
+	tcs := []struct {
+		mode  rune
+		want  channelModeType
+		known bool
+	}{
+		{'b', channelModeTypeList, true},
+		{'I', channelModeTypeList, true},
+		{'k', channelModeTypeParam, true},
+		{'l', channelModeTypeSetParam, true},
+		{'t', channelModeTypeFlag, true},
+		{'o', channelModeTypePrefix, true},
+		{'v', channelModeTypePrefix, true},
+		{'q', 0, false},
+		{'z', 0, false},
+	}
+
+	for _, tc := range tcs {
+		got, known := types[tc.mode]
+		if known != tc.known || got != tc.want {
+			t.Errorf("%c: got: %d %t, want: %d %t", tc.mode, got, known, tc.want, tc.known)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package ircd
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAccountServiceNick = "NickServ"
+	defaultEnforceDelay       = 30
+)
+
+// Account registration settings.
+type AccountConfig struct {
+	// Enables accounts, the account service and the REGISTER command.
+	Enabled bool
+	// Nickname of the account service, defaults to NickServ.
+	ServiceNick string
+	// Nickname of the channel registration service, defaults to ChanServ.
+	ChannelServiceNick string
+	// Seconds a client using a registered nickname has to identify,
+	// defaults to 30.
+	EnforceDelay int
+	// Disconnect clients that do not identify instead of renaming them.
+	EnforceKill bool
+}
+
+// Account service, a virtual client that handles commands sent to it with
+// PRIVMSG.
+type nickServ struct {
+	s   *Server
+	bot *VirtualClient
+
+	enforceDelay time.Duration
+	enforceKill  bool
+
+	mu *sync.Mutex
+	// Clients whose password is being hashed, one request at a time.
+	hashing map[clientID]bool
+	// Password requests in progress.
+	pending *sync.WaitGroup
+}
+
+func newNickServ(s *Server, config AccountConfig) (*nickServ, error) {
+	nick := config.ServiceNick
+	if nick == "" {
+		nick = defaultAccountServiceNick
+	}
+	delay := config.EnforceDelay
+	if delay <= 0 {
+		delay = defaultEnforceDelay
+	}
+
+	ns := &nickServ{
+		s:            s,
+		enforceDelay: time.Duration(delay) * time.Second,
+		enforceKill:  config.EnforceKill,
+		mu:           &sync.Mutex{},
+		hashing:      make(map[clientID]bool),
+		pending:      &sync.WaitGroup{},
+	}
+
+	bot, err := s.NewVirtualClient(VirtualClientConfig{
+		Nickname: nick,
+		Username: strings.ToLower(nick),
+		Realname: "Account Service",
+		Deliver:  ns.deliver,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ns.bot = bot
+
+	Subscribe(s, func(e *RegisterEvent) bool {
+		c := e.Client.c
+		if account, ok := s.accounts.authenticateCertificate(c.certfp()); ok {
+			s.login(c, account)
+		}
+		ns.protect(c, c.nickname())
+		return true
+	})
+	Subscribe(s, func(e *NickEvent) bool {
+		if e.Client.c.handshake() {
+			ns.protect(e.Client.c, e.New)
+		}
+		return true
+	})
+
+	return ns, nil
+}
+
+// Handles a line sent to the service.
+func (ns *nickServ) deliver(line string) {
+	m, err := parseMessage(line)
+	if err != nil || m.command != "PRIVMSG" || len(m.params) < 2 {
+		return
+	}
+	nick, _, _ := strings.Cut(m.prefix, "!")
+	c, ok := ns.s.clients.get(nick)
+	if !ok {
+		return
+	}
+
+	fields := strings.Fields(m.params[1])
+	if len(fields) == 0 {
+		return
+	}
+	args := fields[1:]
+
+	switch strings.ToUpper(fields[0]) {
+	case "HELP":
+		ns.help(c)
+	case "REGISTER":
+		ns.hash(c, func() { ns.register(c, args) })
+	case "IDENTIFY":
+		ns.hash(c, func() { ns.identify(c, args) })
+	case "LOGOUT":
+		ns.logout(c)
+	case "GROUP":
+		ns.group(c)
+	case "DROP":
+		ns.drop(c, args)
+	case "CERT":
+		ns.cert(c, args)
+	default:
+		ns.notice(c, fmt.Sprintf("Unknown command %s, see HELP.", strings.ToUpper(fields[0])))
+	}
+}
+
+// Runs fn, which hashes a password, on its own goroutine so other clients are
+// not kept waiting. A client can only have one such request in progress.
+func (ns *nickServ) hash(c clienter, fn func()) {
+	ns.mu.Lock()
+	if ns.hashing[c.id()] {
+		ns.mu.Unlock()
+		ns.notice(c, "Your previous request is still being processed.")
+		return
+	}
+	ns.hashing[c.id()] = true
+	ns.mu.Unlock()
+
+	ns.pending.Add(1)
+	go func() {
+		defer ns.pending.Done()
+		fn()
+		ns.mu.Lock()
+		delete(ns.hashing, c.id())
+		ns.mu.Unlock()
+	}()
+}
+
+func (ns *nickServ) notice(c clienter, text string) {
+	ns.bot.Notice(c.nickname(), text)
+}
+
+func (ns *nickServ) help(c clienter) {
+	for _, line := range []string{
+		"REGISTER <password> [email]: registers your current nickname",
+		"IDENTIFY [account] <password>: logs in to an account",
+		"LOGOUT: logs out of your account",
+		"GROUP: adds your current nickname to your account",
+		"DROP [nickname]: removes a nickname from your account, or the account itself",
+		"CERT ADD [fingerprint]|DEL <fingerprint>|LIST: manages certificates that log you in",
+	} {
+		ns.notice(c, line)
+	}
+}
+
+func (ns *nickServ) register(c clienter, args []string) {
+	if len(args) < 1 {
+		ns.notice(c, "Syntax: REGISTER <password> [email]")
+		return
+	}
+	if c.account() != "" {
+		ns.notice(c, fmt.Sprintf("You are already logged in as %s.", c.account()))
+		return
+	}
+	email := ""
+	if len(args) >= 2 {
+		email = args[1]
+	}
+
+	err := ns.s.accounts.register(c.nickname(), args[0], email, ns.s.now())
+	switch err {
+	case nil:
+	case errorAccountExists:
+		ns.notice(c, fmt.Sprintf("%s is already registered.", c.nickname()))
+		return
+	case errorWeakPassword:
+		ns.notice(c, fmt.Sprintf("Password must be at least %d characters.", minPasswordLength))
+		return
+	default:
+		ns.s.log.Error().Err(err).Msgf("cant register account %s", c.nickname())
+		ns.notice(c, "Registration failed, try again later.")
+		return
+	}
+
+	ns.notice(c, fmt.Sprintf("%s is now registered.", c.nickname()))
+	ns.s.login(c, c.nickname())
+}
+
+func (ns *nickServ) identify(c clienter, args []string) {
+	if c.account() != "" {
+		ns.notice(c, fmt.Sprintf("You are already logged in as %s.", c.account()))
+		return
+	}
+
+	// certificate fingerprint is used if no password is given
+	if len(args) == 0 {
+		account, ok := ns.s.accounts.authenticateCertificate(c.certfp())
+		if !ok {
+			ns.notice(c, "Syntax: IDENTIFY [account] <password>")
+			return
+		}
+		ns.s.login(c, account)
+		return
+	}
+
+	name, password := c.nickname(), args[0]
+	if len(args) >= 2 {
+		name, password = args[0], args[1]
+	} else if owner, ok := ns.s.accounts.owner(name); ok {
+		name = owner
+	}
+
+	account, ok := ns.s.accounts.authenticate(name, password)
+	if !ok {
+		ns.notice(c, "Invalid account or password.")
+		return
+	}
+	ns.s.login(c, account)
+}
+
+func (ns *nickServ) logout(c clienter) {
+	if c.account() == "" {
+		ns.notice(c, "You are not logged in.")
+		return
+	}
+	ns.s.logout(c)
+	ns.protect(c, c.nickname())
+}
+
+func (ns *nickServ) group(c clienter) {
+	if c.account() == "" {
+		ns.notice(c, "You have to be logged in to group nicknames.")
+		return
+	}
+
+	err := ns.s.accounts.group(c.account(), c.nickname())
+	switch err {
+	case nil:
+		ns.notice(c, fmt.Sprintf("%s is now grouped to %s.", c.nickname(), c.account()))
+	case errorAccountExists:
+		ns.notice(c, fmt.Sprintf("%s is registered to another account.", c.nickname()))
+	default:
+		ns.s.log.Error().Err(err).Msgf("cant group %s to %s", c.nickname(), c.account())
+		ns.notice(c, "Grouping failed, try again later.")
+	}
+}
+
+func (ns *nickServ) drop(c clienter, args []string) {
+	account := c.account()
+	if account == "" {
+		ns.notice(c, "You have to be logged in to drop nicknames.")
+		return
+	}
+
+	if len(args) >= 1 && !strings.EqualFold(args[0], account) {
+		err := ns.s.accounts.ungroup(account, args[0])
+		switch err {
+		case nil:
+			ns.notice(c, fmt.Sprintf("%s is no longer grouped to %s.", args[0], account))
+		case errorNicknameNotGrouped:
+			ns.notice(c, fmt.Sprintf("%s is not grouped to %s.", args[0], account))
+		default:
+			ns.s.log.Error().Err(err).Msgf("cant ungroup %s from %s", args[0], account)
+			ns.notice(c, "Dropping failed, try again later.")
+		}
+		return
+	}
+
+	err := ns.s.accounts.drop(account)
+	if err != nil {
+		ns.s.log.Error().Err(err).Msgf("cant drop account %s", account)
+		ns.notice(c, "Dropping failed, try again later.")
+		return
+	}
+	ns.notice(c, fmt.Sprintf("Account %s has been dropped.", account))
+
+	// log out everyone using the account
+	for _, other := range ns.s.clients.all() {
+		if other.account() == account {
+			ns.s.logout(other)
+		}
+	}
+}
+
+func (ns *nickServ) cert(c clienter, args []string) {
+	account := c.account()
+	if account == "" {
+		ns.notice(c, "You have to be logged in to manage certificates.")
+		return
+	}
+	if len(args) == 0 {
+		ns.notice(c, "Syntax: CERT ADD [fingerprint]|DEL <fingerprint>|LIST")
+		return
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "ADD":
+		fp := c.certfp()
+		if len(args) >= 2 {
+			fp = args[1]
+		}
+		err := ns.s.accounts.addCertificate(account, fp)
+		switch err {
+		case nil:
+			ns.notice(c, fmt.Sprintf("Added %s to %s.", normalizeFingerprint(fp), account))
+		case errorInvalidFingerprint:
+			ns.notice(c, "No certificate fingerprint given and you are not using a client certificate.")
+		case errorFingerprintInUse:
+			ns.notice(c, "Certificate is used by another account.")
+		default:
+			ns.s.log.Error().Err(err).Msgf("cant add certificate to %s", account)
+			ns.notice(c, "Adding certificate failed, try again later.")
+		}
+	case "DEL":
+		if len(args) < 2 {
+			ns.notice(c, "Syntax: CERT DEL <fingerprint>")
+			return
+		}
+		err := ns.s.accounts.removeCertificate(account, args[1])
+		switch err {
+		case nil:
+			ns.notice(c, fmt.Sprintf("Removed %s from %s.", normalizeFingerprint(args[1]), account))
+		case errorInvalidFingerprint:
+			ns.notice(c, fmt.Sprintf("%s is not on %s.", args[1], account))
+		default:
+			ns.s.log.Error().Err(err).Msgf("cant remove certificate from %s", account)
+			ns.notice(c, "Removing certificate failed, try again later.")
+		}
+	case "LIST":
+		certificates := ns.s.accounts.certificates(account)
+		for _, fp := range certificates {
+			ns.notice(c, fp)
+		}
+		ns.notice(c, fmt.Sprintf("%d certificate(s) on %s.", len(certificates), account))
+	default:
+		ns.notice(c, "Syntax: CERT ADD [fingerprint]|DEL <fingerprint>|LIST")
+	}
+}
+
+// Warns c if nickname is registered to another account and enforces
+// ownership if c has not identified when the grace period ends.
+func (ns *nickServ) protect(c clienter, nickname string) {
+	owner, ok := ns.s.accounts.owner(nickname)
+	if !ok || strings.EqualFold(owner, c.account()) {
+		return
+	}
+
+	ns.notice(c, fmt.Sprintf(
+		"%s is registered. Identify with /msg %s IDENTIFY <password> within %d seconds or your nickname will be changed.",
+		nickname, ns.bot.c.nickname(), int(ns.enforceDelay.Seconds()),
+	))
+	time.AfterFunc(ns.enforceDelay, func() {
+		ns.enforce(c, nickname)
+	})
+}
+
+func (ns *nickServ) enforce(c clienter, nickname string) {
+	if c.quitReason() != "" || c.nickname() != nickname {
+		return
+	}
+	owner, ok := ns.s.accounts.owner(nickname)
+	if !ok || strings.EqualFold(owner, c.account()) {
+		return
+	}
+
+	if ns.enforceKill {
+		c.kill("Nickname enforcement")
+		return
+	}
+	ns.notice(c, "You did not identify, your nickname has been changed.")
+	ns.s.changeNick(c, ns.s.guestNick())
+}
+
+// Returns an unused GuestNNNNN nickname.
+func (s *Server) guestNick() string {
+	for {
+		nick := fmt.Sprintf("Guest%05d", rand.IntN(100000))
+		if _, exists := s.clients.get(nick); !exists {
+			return nick
+		}
+	}
+}
+
+// Logs c in to account.
+func (s *Server) login(c clienter, account string) {
+	c.setAccount(account)
+	c.sendRPL(s.name, rplLoggedIn{
+		client:  c.nickname(),
+		prefix:  c.prefix(),
+		account: account,
+	})
+
+	if c.hasMode(modeClientRegistered) {
+		return
+	}
+	c.addMode(modeClientRegistered)
+	// registering clients receive their modes with the welcome burst
+	if c.handshake() {
+		c.sendCommand(modeCommand{
+			source:     s.name,
+			target:     c.nickname(),
+			modestring: "+r",
+		})
+	}
+
+	if s.chanserv != nil {
+		for _, ch := range s.channels.memberOf(c) {
+			s.chanserv.automode(ch, c)
+		}
+	}
+}
+
+// Logs c out of its account.
+func (s *Server) logout(c clienter) {
+	c.setAccount("")
+	c.sendRPL(s.name, rplLoggedOut{
+		client: c.nickname(),
+		prefix: c.prefix(),
+	})
+
+	if !c.hasMode(modeClientRegistered) {
+		return
+	}
+	c.removeMode(modeClientRegistered)
+	c.sendCommand(modeCommand{
+		source:     s.name,
+		target:     c.nickname(),
+		modestring: "-r",
+	})
+}
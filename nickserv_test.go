@@ -0,0 +1,195 @@
+package ircd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func newAccountServer() *Server {
+	return NewServer(
+		ServerConfig{Name: "server", Accounts: AccountConfig{Enabled: true}},
+		WithLogger(zerolog.Nop()),
+		WithMetricsRegistry(prometheus.NewRegistry()),
+	)
+}
+
+func TestNickServ(t *testing.T) {
+	s := newAccountServer()
+	c := newMockClient(true)
+	s.clients.add(c)
+
+	type tc struct {
+		text string
+		want []string
+	}
+
+	tcs := []tc{
+		{
+			text: "REGISTER secret1",
+			want: []string{
+				":NickServ!nickserv@server NOTICE mocknick :mocknick is now registered.",
+				"900 mocknick mocknick!mockuser@mockhost mocknick :You are now logged in as mocknick",
+				":server MODE mocknick +r",
+			},
+		},
+		{
+			text: "LOGOUT",
+			want: []string{
+				"901 mocknick mocknick!mockuser@mockhost :You are now logged out",
+				":server MODE mocknick -r",
+				":NickServ!nickserv@server NOTICE mocknick :mocknick is registered. Identify with /msg NickServ IDENTIFY <password> within 30 seconds or your nickname will be changed.",
+			},
+		},
+		{
+			text: "IDENTIFY wrong",
+			want: []string{
+				":NickServ!nickserv@server NOTICE mocknick :Invalid account or password.",
+			},
+		},
+		{
+			text: "IDENTIFY secret1",
+			want: []string{
+				"900 mocknick mocknick!mockuser@mockhost mocknick :You are now logged in as mocknick",
+				":server MODE mocknick +r",
+			},
+		},
+		{
+			text: "CERT ADD 01:02:03",
+			want: []string{
+				":NickServ!nickserv@server NOTICE mocknick :Added 010203 to mocknick.",
+			},
+		},
+		{
+			text: "CERT LIST",
+			want: []string{
+				":NickServ!nickserv@server NOTICE mocknick :010203",
+				":NickServ!nickserv@server NOTICE mocknick :1 certificate(s) on mocknick.",
+			},
+		},
+		{
+			text: "DROP",
+			want: []string{
+				":NickServ!nickserv@server NOTICE mocknick :Account mocknick has been dropped.",
+				"901 mocknick mocknick!mockuser@mockhost :You are now logged out",
+				":server MODE mocknick -r",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		c.reset()
+		s.nickserv.deliver(":mocknick PRIVMSG NickServ :" + tc.text)
+		s.nickserv.pending.Wait()
+		if slices.Compare(c.messagesOut, tc.want) != 0 {
+			t.Errorf("%s: got %v, want %v", tc.text, c.messagesOut, tc.want)
+		}
+	}
+}
+
+func TestNickServHashing(t *testing.T) {
+	s := newAccountServer()
+	err := s.accounts.register("mocknick", "secret1", "", s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newMockClient(true)
+	s.clients.add(c)
+
+	// a second request is refused while the first is hashing
+	s.nickserv.hashing[c.id()] = true
+	s.nickserv.deliver(":mocknick PRIVMSG NickServ :IDENTIFY secret1")
+	s.nickserv.pending.Wait()
+	want := []string{":NickServ!nickserv@server NOTICE mocknick :Your previous request is still being processed."}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", c.messagesOut, want)
+	}
+
+	c.reset()
+	delete(s.nickserv.hashing, c.id())
+	s.nickserv.deliver(":mocknick PRIVMSG NickServ :IDENTIFY secret1")
+	s.nickserv.pending.Wait()
+	if c.account() != "mocknick" {
+		t.Errorf("got account %q, want mocknick", c.account())
+	}
+	if len(s.nickserv.hashing) != 0 {
+		t.Errorf("request was not finished: %v", s.nickserv.hashing)
+	}
+}
+
+func TestNickServEnforce(t *testing.T) {
+	s := newAccountServer()
+	err := s.accounts.register("owner", "secret1", "", s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newMockClient(true)
+	c.nick = "owner"
+	s.clients.add(c)
+
+	s.nickserv.enforce(c, "owner")
+	if !strings.HasPrefix(c.nickname(), "Guest") {
+		t.Errorf("got nickname %s, want Guest", c.nickname())
+	}
+
+	// identified clients keep the nickname
+	c.nick = "owner"
+	c.acct = "owner"
+	s.nickserv.enforce(c, "owner")
+	if c.nickname() != "owner" {
+		t.Errorf("got nickname %s, want owner", c.nickname())
+	}
+
+	s.nickserv.enforceKill = true
+	c.acct = ""
+	s.nickserv.enforce(c, "owner")
+	if slices.Compare(c.messagesKill, []string{"Nickname enforcement"}) != 0 {
+		t.Errorf("got %v, want [Nickname enforcement]", c.messagesKill)
+	}
+}
+
+func TestHandleRegister(t *testing.T) {
+	s := newAccountServer()
+	c := newMockClient(true)
+	s.clients.add(c)
+
+	type tc struct {
+		params []string
+		want   []string
+	}
+
+	tcs := []tc{
+		{
+			params: []string{"other", "*", "secret1"},
+			want:   []string{":server FAIL REGISTER ACCOUNT_NAME_MUST_BE_NICK other :Account name must be your nickname"},
+		},
+		{
+			params: []string{"*", "*", "short"},
+			want:   []string{":server FAIL REGISTER WEAK_PASSWORD mocknick :Password must be at least 6 characters"},
+		},
+		{
+			params: []string{"*", "mock@example.com", "secret1"},
+			want: []string{
+				":server REGISTER SUCCESS mocknick :Account successfully registered",
+				"900 mocknick mocknick!mockuser@mockhost mocknick :You are now logged in as mocknick",
+				":server MODE mocknick +r",
+			},
+		},
+		{
+			params: []string{"*", "*", "secret1"},
+			want:   []string{":server FAIL REGISTER ALREADY_AUTHENTICATED mocknick :You are already authenticated"},
+		},
+	}
+
+	for _, tc := range tcs {
+		c.reset()
+		handleRegister(s, c, message{command: "REGISTER", params: tc.params})
+		if slices.Compare(c.messagesOut, tc.want) != 0 {
+			t.Errorf("got %v, want %v", c.messagesOut, tc.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package ircd
+
+import (
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// Configures a server created with NewServer.
+type Option func(s *Server)
+
+// Adds a listener that is served by Serve.
+func WithListener(listener net.Listener, config ListenerConfig) Option {
+	return func(s *Server) {
+		s.serve = append(s.serve, InheritedListener{
+			Listener: listener,
+			Config:   config,
+		})
+	}
+}
+
+// Sets the logger, defaults to the global zerolog logger.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(s *Server) {
+		s.log = logger
+	}
+}
+
+// Sets the registry metrics are registered with, defaults to
+// prometheus.DefaultRegisterer. A nil registerer disables registration.
+//
+// Metrics are shared by all servers in the process.
+func WithMetricsRegistry(registerer prometheus.Registerer) Option {
+	return func(s *Server) {
+		s.registry = registerer
+	}
+}
+
+// Sets the store of operator credentials. See NewOperatorStore.
+func WithOperatorStore(store *OperatorStore) Option {
+	return func(s *Server) {
+		s.operators = store
+	}
+}
+
+// Sets the store of accounts, defaults to an account store that is not
+// saved. See OpenAccountStore.
+func WithAccountStore(store *AccountStore) Option {
+	return func(s *Server) {
+		s.accounts = store
+	}
+}
+
+// Sets the store of registered channels, defaults to a store that is not
+// saved. See OpenChannelRegistrationStore.
+func WithChannelRegistrationStore(store *ChannelRegistrationStore) Option {
+	return func(s *Server) {
+		s.registrations = store
+	}
+}
+
+// Sets the store of server bans, defaults to a store that is not saved.
+// See OpenServerBanStore.
+func WithServerBanStore(store *ServerBanStore) Option {
+	return func(s *Server) {
+		s.bans = store
+	}
+}
+
+// Sets the store of channel message history, defaults to a store that is
+// not saved. See OpenHistoryStore.
+func WithHistoryStore(store *HistoryStore) Option {
+	return func(s *Server) {
+		s.history = store
+	}
+}
+
+// Sets the database the stores are saved to. It is closed while an upgrade
+// starts the new process, which opens it again, and reopened if the upgrade
+// fails.
+func WithDatabase(db *Database) Option {
+	return func(s *Server) {
+		s.db = db
+	}
+}
+
+// Sets the function used for the current time, defaults to time.Now.
+//
+// The clock is used for timestamps and expiry, network timeouts always use
+// the system clock.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
@@ -0,0 +1,112 @@
+package ircd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLookupTimeout  = 5
+	defaultLookupCacheTTL = 300
+)
+
+// Subset of *net.Resolver used for hostname lookups.
+type dnsResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type hostnameCacheEntry struct {
+	hostname string
+	expires  time.Time
+}
+
+// Forward-confirmed reverse DNS resolver with a result cache.
+type hostnameResolver struct {
+	mu       *sync.Mutex
+	now      func() time.Time
+	resolver dnsResolver
+	timeout  time.Duration
+	ttl      time.Duration
+	cache    map[string]hostnameCacheEntry
+}
+
+func newHostnameResolver(resolver dnsResolver, timeout time.Duration, ttl time.Duration) *hostnameResolver {
+	return &hostnameResolver{
+		mu:       &sync.Mutex{},
+		now:      time.Now,
+		resolver: resolver,
+		timeout:  timeout,
+		ttl:      ttl,
+		cache:    make(map[string]hostnameCacheEntry),
+	}
+}
+
+// Returns the hostname of ip.
+//
+// The PTR record is only accepted if the name resolves back to ip. Failed
+// lookups are cached as well so repeated connections are not slowed down.
+func (r *hostnameResolver) lookup(ip string) (hostname string, ok bool) {
+	r.mu.Lock()
+	entry, cached := r.cache[ip]
+	r.mu.Unlock()
+	if cached && r.now().Before(entry.expires) {
+		return entry.hostname, entry.hostname != ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	hostname = r.confirm(ctx, ip)
+
+	r.mu.Lock()
+	r.cache[ip] = hostnameCacheEntry{
+		hostname: hostname,
+		expires:  r.now().Add(r.ttl),
+	}
+	// drop expired entries so the cache does not grow forever
+	for k, v := range r.cache {
+		if r.now().After(v.expires) {
+			delete(r.cache, k)
+		}
+	}
+	r.mu.Unlock()
+
+	return hostname, hostname != ""
+}
+
+// Returns the first PTR name of ip that resolves back to ip.
+func (r *hostnameResolver) confirm(ctx context.Context, ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+
+	names, err := r.resolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return ""
+	}
+
+	for _, name := range names {
+		name = strings.TrimSuffix(name, ".")
+		if name == "" {
+			continue
+		}
+
+		addrs, err := r.resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			if a.IP.Equal(addr) {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
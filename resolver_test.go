@@ -0,0 +1,74 @@
+package ircd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type resolverMock struct {
+	ptr     map[string][]string
+	a       map[string][]net.IPAddr
+	lookups int
+}
+
+func (r *resolverMock) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.lookups++
+	names, ok := r.ptr[addr]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return names, nil
+}
+
+func (r *resolverMock) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r.a[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestHostnameResolver(t *testing.T) {
+	mock := &resolverMock{
+		ptr: map[string][]string{
+			"192.0.2.1": {"good.example.com."},
+			"192.0.2.2": {"spoofed.example.com."},
+		},
+		a: map[string][]net.IPAddr{
+			"good.example.com":    {{IP: net.ParseIP("192.0.2.1")}},
+			"spoofed.example.com": {{IP: net.ParseIP("198.51.100.1")}},
+		},
+	}
+	r := newHostnameResolver(mock, time.Second, time.Minute)
+
+	type tc struct {
+		ip   string
+		want string
+		ok   bool
+	}
+
+	tcs := []tc{
+		{ip: "192.0.2.1", want: "good.example.com", ok: true},
+		{ip: "192.0.2.2", want: "", ok: false},
+		{ip: "192.0.2.3", want: "", ok: false},
+	}
+
+	for _, tc := range tcs {
+		got, ok := r.lookup(tc.ip)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("got %s (%t), want %s (%t)", got, ok, tc.want, tc.ok)
+		}
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		before := mock.lookups
+		r.lookup("192.0.2.1")
+		r.lookup("192.0.2.3")
+		if mock.lookups != before {
+			t.Errorf("got %d lookups, want %d", mock.lookups, before)
+		}
+	})
+}
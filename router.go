@@ -4,30 +4,33 @@ import (
 	"sync"
 )
 
-var nilHandler handlerFunc = func(s *server, c clienter, m message) {}
+var nilHandler handlerFunc = func(s *Server, c clienter, m message) {}
 
-type handlerFunc func(s *server, c clienter, m message)
-type middlewareFunc func(s *server, c clienter, m message, next handlerFunc) handlerFunc
+type handlerFunc func(s *Server, c clienter, m message)
+type middlewareFunc func(s *Server, c clienter, m message, next handlerFunc) handlerFunc
 
 type router interface {
 	// Register cmd route, assign optional middleware.
 	registerHandler(cmd string, h handlerFunc, mws ...middlewareFunc)
 	// Register a global middleware. Middleware has return 'nil' to exit early.
 	registerGlobalMiddleware(mw middlewareFunc)
+	// Replace cmd handler with wrap(handler), middleware is kept. Returns false
+	// if cmd is not registered.
+	wrapHandler(cmd string, wrap func(h handlerFunc) handlerFunc) bool
 	// Execute handler.
-	handle(s *server, c clienter, m message) error
+	handle(s *Server, c clienter, m message) error
 }
 
 type commandRouter struct {
 	mu *sync.RWMutex
 
-	server           *server
+	server           *Server
 	handlers         map[string]handlerFunc
 	middleware       map[string][]middlewareFunc
 	globalMiddleware []middlewareFunc
 }
 
-func NewCommandRouter(s *server) *commandRouter {
+func NewCommandRouter(s *Server) *commandRouter {
 	return &commandRouter{
 		mu: &sync.RWMutex{},
 
@@ -50,20 +53,32 @@ func (cr *commandRouter) registerHandler(cmd string, h handlerFunc, mws ...middl
 	cr.middleware[cmd] = mws
 }
 
-func (cr *commandRouter) handle(s *server, c clienter, m message) error {
+func (cr *commandRouter) wrapHandler(cmd string, wrap func(h handlerFunc) handlerFunc) bool {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	h, ok := cr.handlers[cmd]
+	if !ok {
+		return false
+	}
+	cr.handlers[cmd] = wrap(h)
+	return true
+}
+
+func (cr *commandRouter) handle(s *Server, c clienter, m message) error {
 	cr.mu.RLock()
 	h, ok := cr.handlers[m.command]
+	mws := cr.middleware[m.command]
+	cr.mu.RUnlock()
 	if !ok {
 		return errorCommandNotFound
 	}
-	mws := cr.middleware[m.command]
-	cr.mu.RUnlock()
 
 	cr.wrap(s, c, m, h, mws)(cr.server, c, m)
 	return nil
 }
 
-func (cr *commandRouter) wrap(s *server, c clienter, m message, handler handlerFunc, middleware []middlewareFunc) handlerFunc {
+func (cr *commandRouter) wrap(s *Server, c clienter, m message, handler handlerFunc, middleware []middlewareFunc) handlerFunc {
 	if handler == nil {
 		return nil
 	}
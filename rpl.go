@@ -107,6 +107,22 @@ func (r rplLuserOp) rpl() string {
 	)
 }
 
+// 253 RPL_LUSERUNKNOWN
+//
+// https://modern.ircdocs.horse/#rplluserunknown-253
+type rplLuserUnknown struct {
+	client string
+	// Number of connections that have not completed registration.
+	connections int
+}
+
+func (r rplLuserUnknown) rpl() string {
+	return fmt.Sprintf(
+		"253 %s %d :unknown connection(s)",
+		r.client, r.connections,
+	)
+}
+
 // 254 RPL_LUSERCHANNELS
 //
 // https://modern.ircdocs.horse/#rplluserchannels-254
@@ -302,6 +318,22 @@ func (r rplChannelModeIs) rpl() string {
 	)
 }
 
+// 330 RPL_WHOISACCOUNT
+//
+// https://modern.ircdocs.horse/#rplwhoisaccount-330
+type rplWhoisAccount struct {
+	client  string
+	nick    string
+	account string
+}
+
+func (r rplWhoisAccount) rpl() string {
+	return fmt.Sprintf(
+		"330 %s %s %s :is logged in as",
+		r.client, r.nick, r.account,
+	)
+}
+
 // 331 RPL_NOTOPIC
 //
 // https://modern.ircdocs.horse/#rplnotopic-331
@@ -366,6 +398,88 @@ func (r rplInviting) rpl() string {
 	)
 }
 
+// 346 RPL_INVITELIST
+//
+// https://modern.ircdocs.horse/#rplinvitelist-346
+type rplInviteList struct {
+	client  string
+	channel string
+	mask    string
+	who     string
+	setTS   int64
+	// Time left until the entry expires, empty if it does not expire.
+	expires string
+}
+
+func (r rplInviteList) rpl() string {
+	if r.expires == "" {
+		return fmt.Sprintf(
+			"346 %s %s %s %s %d",
+			r.client, r.channel, r.mask, r.who, r.setTS,
+		)
+	}
+	return fmt.Sprintf(
+		"346 %s %s %s %s %d :expires in %s",
+		r.client, r.channel, r.mask, r.who, r.setTS, r.expires,
+	)
+}
+
+// 347 RPL_ENDOFINVITELIST
+//
+// https://modern.ircdocs.horse/#rplendofinvitelist-347
+type rplEndOfInviteList struct {
+	client  string
+	channel string
+}
+
+func (r rplEndOfInviteList) rpl() string {
+	return fmt.Sprintf(
+		"347 %s %s :End of Channel Invite Exception List",
+		r.client, r.channel,
+	)
+}
+
+// 348 RPL_EXCEPTLIST
+//
+// https://modern.ircdocs.horse/#rplexceptlist-348
+type rplExceptList struct {
+	client  string
+	channel string
+	mask    string
+	who     string
+	setTS   int64
+	// Time left until the entry expires, empty if it does not expire.
+	expires string
+}
+
+func (r rplExceptList) rpl() string {
+	if r.expires == "" {
+		return fmt.Sprintf(
+			"348 %s %s %s %s %d",
+			r.client, r.channel, r.mask, r.who, r.setTS,
+		)
+	}
+	return fmt.Sprintf(
+		"348 %s %s %s %s %d :expires in %s",
+		r.client, r.channel, r.mask, r.who, r.setTS, r.expires,
+	)
+}
+
+// 349 RPL_ENDOFEXCEPTLIST
+//
+// https://modern.ircdocs.horse/#rplendofexceptlist-349
+type rplEndOfExceptList struct {
+	client  string
+	channel string
+}
+
+func (r rplEndOfExceptList) rpl() string {
+	return fmt.Sprintf(
+		"349 %s %s :End of Channel Exception List",
+		r.client, r.channel,
+	)
+}
+
 // 351 RPL_VERSION
 //
 // https://modern.ircdocs.horse/#rplversion-351
@@ -441,6 +555,47 @@ func (r rplEndOfNames) rpl() string {
 	)
 }
 
+// 367 RPL_BANLIST
+//
+// https://modern.ircdocs.horse/#rplbanlist-367
+type rplBanList struct {
+	client  string
+	channel string
+	mask    string
+	who     string
+	setTS   int64
+	// Time left until the entry expires, empty if it does not expire.
+	expires string
+}
+
+func (r rplBanList) rpl() string {
+	if r.expires == "" {
+		return fmt.Sprintf(
+			"367 %s %s %s %s %d",
+			r.client, r.channel, r.mask, r.who, r.setTS,
+		)
+	}
+	return fmt.Sprintf(
+		"367 %s %s %s %s %d :expires in %s",
+		r.client, r.channel, r.mask, r.who, r.setTS, r.expires,
+	)
+}
+
+// 368 RPL_ENDOFBANLIST
+//
+// https://modern.ircdocs.horse/#rplendofbanlist-368
+type rplEndOfBanList struct {
+	client  string
+	channel string
+}
+
+func (r rplEndOfBanList) rpl() string {
+	return fmt.Sprintf(
+		"368 %s %s :End of channel ban list",
+		r.client, r.channel,
+	)
+}
+
 // 372 RPL_MOTD
 //
 // https://modern.ircdocs.horse/#rplmotd-372
@@ -486,6 +641,23 @@ func (r rplEndOfMotd) rpl() string {
 	)
 }
 
+// 378 RPL_WHOISHOST
+//
+// https://modern.ircdocs.horse/#rplwhoishost-378
+type rplWhoisHost struct {
+	client   string
+	nick     string
+	hostname string
+	ip       string
+}
+
+func (r rplWhoisHost) rpl() string {
+	return fmt.Sprintf(
+		"378 %s %s :is connecting from *@%s %s",
+		r.client, r.nick, r.hostname, r.ip,
+	)
+}
+
 // 381 RPL_YOUREOPER
 //
 // https://modern.ircdocs.horse/#rplyoureoper-381
@@ -500,6 +672,21 @@ func (r rplYoureOper) rpl() string {
 	)
 }
 
+// 396 RPL_HOSTHIDDEN
+//
+// https://defs.ircdocs.horse/defs/numerics#rpl-hosthidden-396
+type rplHostHidden struct {
+	client   string
+	hostname string
+}
+
+func (r rplHostHidden) rpl() string {
+	return fmt.Sprintf(
+		"396 %s %s :is now your displayed host",
+		r.client, r.hostname,
+	)
+}
+
 // 401 ERR_NOSUCHNICK
 //
 // https://modern.ircdocs.horse/#errnosuchnick-401
@@ -561,6 +748,21 @@ func (r errCannotSendToChan) rpl() string {
 	)
 }
 
+// 410 ERR_INVALIDCAPCMD
+//
+// https://ircv3.net/specs/extensions/capability-negotiation#the-cap-command
+type errInvalidCapCmd struct {
+	client  string
+	command string
+}
+
+func (r errInvalidCapCmd) rpl() string {
+	return fmt.Sprintf(
+		"410 %s %s :Invalid CAP command",
+		r.client, r.command,
+	)
+}
+
 // 431 ERR_NONICKNAMEGIVEN
 //
 // https://modern.ircdocs.horse/#errnonicknamegiven-431
@@ -709,6 +911,67 @@ func (r errPasswdMismatch) rpl() string {
 	)
 }
 
+// 465 ERR_YOUREBANNEDCREEP
+//
+// https://modern.ircdocs.horse/#erryourebannedcreep-465
+type errYoureBannedCreep struct {
+	client string
+	reason string
+}
+
+func (r errYoureBannedCreep) rpl() string {
+	return fmt.Sprintf(
+		"465 %s :You are banned from this server: %s",
+		r.client, r.reason,
+	)
+}
+
+// 470 ERR_LINKCHANNEL
+//
+// https://defs.ircdocs.horse/defs/numerics#err-linkchannel-470
+type errLinkChannel struct {
+	client  string
+	channel string
+	target  string
+}
+
+func (r errLinkChannel) rpl() string {
+	return fmt.Sprintf(
+		"470 %s %s %s :Forwarding to another channel",
+		r.client, r.channel, r.target,
+	)
+}
+
+// 471 ERR_CHANNELISFULL
+//
+// https://modern.ircdocs.horse/#errchannelisfull-471
+type errChannelIsFull struct {
+	client  string
+	channel string
+}
+
+func (r errChannelIsFull) rpl() string {
+	return fmt.Sprintf(
+		"471 %s %s :Cannot join channel (+l)",
+		r.client, r.channel,
+	)
+}
+
+// 472 ERR_UNKNOWNMODE
+//
+// https://modern.ircdocs.horse/#errunknownmode-472
+type errUnknownMode struct {
+	client   string
+	modechar rune
+}
+
+func (r errUnknownMode) rpl() string {
+	return fmt.Sprintf(
+		"472 %s %c :is unknown mode char to me",
+		r.client, r.modechar,
+	)
+}
+
 // 473 ERR_INVITEONLYCHAN
 //
 // https://modern.ircdocs.horse/#errinviteonlychan-473
@@ -734,7 +997,7 @@ type errBannedFromChan struct {
 
 func (r errBannedFromChan) rpl() string {
 	return fmt.Sprintf(
-		"474 %s %s :Cannot join channel (+z)",
+		"474 %s %s :Cannot join channel (+b)",
 		r.client, r.channel,
 	)
 }
@@ -754,6 +1017,22 @@ func (r errBadChannelKey) rpl() string {
 	)
 }
 
+// 478 ERR_BANLISTFULL
+//
+// https://modern.ircdocs.horse/#errbanlistfull-478
+type errBanListFull struct {
+	client  string
+	channel string
+	mode    rune
+}
+
+func (r errBanListFull) rpl() string {
+	return fmt.Sprintf(
+		"478 %s %s %c :Channel list is full",
+		r.client, r.channel, r.mode,
+	)
+}
+
 // 481 ERR_NOPRIVILEGES
 //
 // https://modern.ircdocs.horse/#errnoprivileges-481
@@ -783,6 +1062,20 @@ func (r errChanoPrivsNeeded) rpl() string {
 	)
 }
 
+// 491 ERR_NOOPERHOST
+//
+// https://modern.ircdocs.horse/#errnooperhost-491
+type errNoOperHost struct {
+	client string
+}
+
+func (r errNoOperHost) rpl() string {
+	return fmt.Sprintf(
+		"491 %s :No O-lines for your host.",
+		r.client,
+	)
+}
+
 // 502 ERR_USERSDONTMATCH
 //
 // https://modern.ircdocs.horse/#errusersdontmatch-502
@@ -797,6 +1090,55 @@ func (r errUsersDontMatch) rpl() string {
 	)
 }
 
+// 696 ERR_INVALIDMODEPARAM
+//
+// https://modern.ircdocs.horse/#errinvalidmodeparam-696
+type errInvalidModeParam struct {
+	client      string
+	target      string
+	modechar    rune
+	parameter   string
+	description string
+}
+
+func (r errInvalidModeParam) rpl() string {
+	return fmt.Sprintf(
+		"696 %s %s %c %s :%s",
+		r.client, r.target, r.modechar, r.parameter, r.description,
+	)
+}
+
+// 900 RPL_LOGGEDIN
+//
+// https://modern.ircdocs.horse/#rplloggedin-900
+type rplLoggedIn struct {
+	client  string
+	prefix  string
+	account string
+}
+
+func (r rplLoggedIn) rpl() string {
+	return fmt.Sprintf(
+		"900 %s %s %s :You are now logged in as %s",
+		r.client, r.prefix, r.account, r.account,
+	)
+}
+
+// 901 RPL_LOGGEDOUT
+//
+// https://modern.ircdocs.horse/#rplloggedout-901
+type rplLoggedOut struct {
+	client string
+	prefix string
+}
+
+func (r rplLoggedOut) rpl() string {
+	return fmt.Sprintf(
+		"901 %s %s :You are now logged out",
+		r.client, r.prefix,
+	)
+}
+
 // 723 ERR_NOPRIVS
 //
 // https://modern.ircdocs.horse/#errnoprivs-723
@@ -48,6 +48,13 @@ func TestRPL(t *testing.T) {
 				ops:    4,
 			},
 		},
+		{
+			want: "253 client 2 :unknown connection(s)",
+			input: rplLuserUnknown{
+				client:      "client",
+				connections: 2,
+			},
+		},
 		{
 			want: "254 client 5 :channels formed.",
 			input: rplLuserChannels{
@@ -267,12 +274,111 @@ func TestRPL(t *testing.T) {
 			},
 		},
 		{
-			want: "474 client #channel :Cannot join channel (+z)",
+			want: "465 client :You are banned from this server: spam",
+			input: errYoureBannedCreep{
+				client: "client",
+				reason: "spam",
+			},
+		},
+		{
+			want: "470 client #channel #overflow :Forwarding to another channel",
+			input: errLinkChannel{
+				client:  "client",
+				channel: "#channel",
+				target:  "#overflow",
+			},
+		},
+		{
+			want: "471 client #channel :Cannot join channel (+l)",
+			input: errChannelIsFull{
+				client:  "client",
+				channel: "#channel",
+			},
+		},
+		{
+			want: "472 client X :is unknown mode char to me",
+			input: errUnknownMode{
+				client:   "client",
+				modechar: 'X',
+			},
+		},
+		{
+			want: "474 client #channel :Cannot join channel (+b)",
 			input: errBannedFromChan{
 				client:  "client",
 				channel: "#channel",
 			},
 		},
+		{
+			want: "478 client #channel b :Channel list is full",
+			input: errBanListFull{
+				client:  "client",
+				channel: "#channel",
+				mode:    'b',
+			},
+		},
+		{
+			want: "346 client #channel *!*@host nick!user@host 1700000000",
+			input: rplInviteList{
+				client:  "client",
+				channel: "#channel",
+				mask:    "*!*@host",
+				who:     "nick!user@host",
+				setTS:   1700000000,
+			},
+		},
+		{
+			want: "347 client #channel :End of Channel Invite Exception List",
+			input: rplEndOfInviteList{
+				client:  "client",
+				channel: "#channel",
+			},
+		},
+		{
+			want: "348 client #channel *!*@host nick!user@host 1700000000",
+			input: rplExceptList{
+				client:  "client",
+				channel: "#channel",
+				mask:    "*!*@host",
+				who:     "nick!user@host",
+				setTS:   1700000000,
+			},
+		},
+		{
+			want: "349 client #channel :End of Channel Exception List",
+			input: rplEndOfExceptList{
+				client:  "client",
+				channel: "#channel",
+			},
+		},
+		{
+			want: "367 client #channel *!*@host nick!user@host 1700000000",
+			input: rplBanList{
+				client:  "client",
+				channel: "#channel",
+				mask:    "*!*@host",
+				who:     "nick!user@host",
+				setTS:   1700000000,
+			},
+		},
+		{
+			want: "367 client #channel *!*@host nick!user@host 1700000000 :expires in 29m30s",
+			input: rplBanList{
+				client:  "client",
+				channel: "#channel",
+				mask:    "*!*@host",
+				who:     "nick!user@host",
+				setTS:   1700000000,
+				expires: "29m30s",
+			},
+		},
+		{
+			want: "368 client #channel :End of channel ban list",
+			input: rplEndOfBanList{
+				client:  "client",
+				channel: "#channel",
+			},
+		},
 		{
 			want: "475 client #channel :Bad channel key (+k).",
 			input: errBadChannelKey{
@@ -280,12 +386,74 @@ func TestRPL(t *testing.T) {
 				channel: "#channel",
 			},
 		},
+		{
+			want: "330 client nick account :is logged in as",
+			input: rplWhoisAccount{
+				client:  "client",
+				nick:    "nick",
+				account: "account",
+			},
+		},
+		{
+			want: "900 client nick!user@host account :You are now logged in as account",
+			input: rplLoggedIn{
+				client:  "client",
+				prefix:  "nick!user@host",
+				account: "account",
+			},
+		},
+		{
+			want: "901 client nick!user@host :You are now logged out",
+			input: rplLoggedOut{
+				client: "client",
+				prefix: "nick!user@host",
+			},
+		},
+		{
+			want: "378 client nick :is connecting from *@real.host 127.0.0.1",
+			input: rplWhoisHost{
+				client:   "client",
+				nick:     "nick",
+				hostname: "real.host",
+				ip:       "127.0.0.1",
+			},
+		},
+		{
+			want: "396 client new.host :is now your displayed host",
+			input: rplHostHidden{
+				client:   "client",
+				hostname: "new.host",
+			},
+		},
+		{
+			want: "410 client FOO :Invalid CAP command",
+			input: errInvalidCapCmd{
+				client:  "client",
+				command: "FOO",
+			},
+		},
+		{
+			want: "491 client :No O-lines for your host.",
+			input: errNoOperHost{
+				client: "client",
+			},
+		},
 		{
 			want: "502 client :Can't change mode for other users.",
 			input: errUsersDontMatch{
 				client: "client",
 			},
 		},
+		{
+			want: "696 client #channel b $q:x :Invalid mask",
+			input: errInvalidModeParam{
+				client:      "client",
+				target:      "#channel",
+				modechar:    'b',
+				parameter:   "$q:x",
+				description: "Invalid mask",
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -0,0 +1,124 @@
+package ircd
+
+import (
+	"sync"
+
+	"github.com/salimnassim/ircd/metrics"
+)
+
+const defaultSendQ = 128 * 1024
+
+// Outgoing message queue with a byte limit.
+//
+// Pushing never blocks, so a slow client can not stall whoever is sending to
+// it. Instead the queue grows until the limit is reached.
+type sendQueue struct {
+	mu *sync.Mutex
+
+	lines []string
+	// Number of queued bytes.
+	bytes int
+	// Maximum number of queued bytes.
+	limit int
+	// Signaled when lines are pushed to an empty queue.
+	notify chan struct{}
+}
+
+func newSendQueue(limit int) *sendQueue {
+	if limit <= 0 {
+		limit = defaultSendQ
+	}
+	return &sendQueue{
+		mu:     &sync.Mutex{},
+		lines:  []string{},
+		bytes:  0,
+		limit:  limit,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Appends line to the queue.
+//
+// Returns false if the line does not fit, in which case it is not queued.
+func (q *sendQueue) push(line string) bool {
+	q.mu.Lock()
+	// +2 for \r\n
+	size := len(line) + 2
+	if q.bytes+size > q.limit {
+		q.mu.Unlock()
+		return false
+	}
+	q.lines = append(q.lines, line)
+	q.bytes += size
+	q.mu.Unlock()
+
+	metrics.SendQueue.Add(float64(size))
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Appends line to the queue ignoring the limit.
+//
+// Used for the last line sent before the connection is closed.
+func (q *sendQueue) pushFinal(line string) {
+	q.mu.Lock()
+	size := len(line) + 2
+	q.lines = append(q.lines, line)
+	q.bytes += size
+	q.mu.Unlock()
+
+	metrics.SendQueue.Add(float64(size))
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Removes and returns all queued lines.
+func (q *sendQueue) drain() []string {
+	q.mu.Lock()
+	lines := q.lines
+	size := q.bytes
+	q.lines = []string{}
+	q.bytes = 0
+	q.mu.Unlock()
+
+	metrics.SendQueue.Sub(float64(size))
+	return lines
+}
+
+// Returns a copy of queued lines without removing them.
+func (q *sendQueue) pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lines := make([]string, len(q.lines))
+	copy(lines, q.lines)
+	return lines
+}
+
+// Receives a value when there are lines to drain.
+func (q *sendQueue) ready() <-chan struct{} {
+	return q.notify
+}
+
+// Set maximum number of queued bytes.
+func (q *sendQueue) setLimit(limit int) {
+	if limit <= 0 {
+		limit = defaultSendQ
+	}
+	q.mu.Lock()
+	q.limit = limit
+	q.mu.Unlock()
+}
+
+// Number of queued bytes.
+func (q *sendQueue) size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bytes
+}
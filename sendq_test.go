@@ -0,0 +1,101 @@
+package ircd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendQueue(t *testing.T) {
+	q := newSendQueue(16)
+
+	t.Run("push", func(t *testing.T) {
+		if !q.push("hello") || !q.push("world") {
+			t.Fatalf("push failed below limit")
+		}
+		if q.size() != 14 {
+			t.Errorf("got %d, want %d", q.size(), 14)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		select {
+		case <-q.ready():
+		default:
+			t.Errorf("queue not ready after push")
+		}
+	})
+
+	t.Run("over limit", func(t *testing.T) {
+		if q.push("overflow") {
+			t.Errorf("push succeeded over limit")
+		}
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		want := []string{"hello", "world"}
+		got := q.drain()
+		if slices.Compare(got, want) != 0 {
+			t.Errorf("got %v, want %v", got, want)
+		}
+		if q.size() != 0 {
+			t.Errorf("got %d, want %d", q.size(), 0)
+		}
+	})
+}
+
+func TestClientSendQExceeded(t *testing.T) {
+	c, err := newClient(&connMock{}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendq = newSendQueue(8)
+
+	// send must not block even though nothing is reading
+	c.send("1234")
+	c.send("12345678")
+
+	if c.quitReason() != "Max SendQ exceeded" {
+		t.Errorf("got %s, want %s", c.quitReason(), "Max SendQ exceeded")
+	}
+}
+
+func TestClientSendQExceededPeerNotReading(t *testing.T) {
+	conn, peer := newPipeConnMock()
+	defer peer.Close()
+
+	c, err := newClient(conn, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendq = newSendQueue(1024)
+
+	done := make(chan struct{})
+	go func() {
+		handleConnectionOut(c)
+		close(done)
+	}()
+
+	// the first line blocks the writer because the peer never reads
+	c.send("hello")
+	time.Sleep(50 * time.Millisecond)
+	for range 100 {
+		c.send(strings.Repeat("x", 64))
+	}
+
+	if c.quitReason() != "Max SendQ exceeded" {
+		t.Fatalf("got %s, want %s", c.quitReason(), "Max SendQ exceeded")
+	}
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("writer still blocked after kill")
+	}
+
+	// the connection is closed
+	_, err = peer.Read(make([]byte, 1))
+	if err == nil {
+		t.Error("connection was not closed")
+	}
+}
@@ -1,24 +1,58 @@
 package ircd
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"os/exec"
 	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/salimnassim/ircd/metrics"
 )
 
 type Serverer interface {
-	Run(listener net.Listener, isTLS bool)
+	// Accepts connections from listener until ctx is done or Shutdown is
+	// called.
+	Run(ctx context.Context, listener net.Listener, config ListenerConfig) error
+	// Runs every listener added with WithListener.
+	Serve(ctx context.Context) error
+	// Stops accepting connections, disconnects all clients and waits for
+	// their goroutines to exit or ctx to be done.
+	Shutdown(ctx context.Context) error
+	// Hands listeners and connections over to the process started by cmd.
+	Upgrade(ctx context.Context, cmd *exec.Cmd) error
+	// Restores state passed over by Upgrade in the new process.
+	Resume(state *os.File) ([]InheritedListener, error)
+}
+
+type ListenerConfig struct {
+	// Is listener using TLS?
+	TLS bool
+	// If set, the server wraps the listener with TLS. Listeners that are
+	// wrapped by the server can be handed over on upgrade.
+	TLSConfig *tls.Config
+	// Look up usernames from the ident port of connecting clients.
+	Ident bool
 }
 
 type regexKey int
 
 const (
-	regexNick    = regexKey(0)
-	regexChannel = regexKey(1)
+	regexNick     = regexKey(0)
+	regexChannel  = regexKey(1)
+	regexHostname = regexKey(2)
+	regexUsername = regexKey(3)
 )
 
 type ServerConfig struct {
@@ -35,6 +69,48 @@ type ServerConfig struct {
 	PingFrequency  int
 	PongMaxLatency int
 
+	// Secret keys used to derive hostname cloaks. Changing the keys changes
+	// every cloak. If no keys are set, a random key is generated on startup.
+	CloakKeys []string
+	// Suffix appended to cloaked hostnames, defaults to "ip".
+	CloakSuffix string
+
+	// Resolver used for hostname lookups, defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+	// Hostname lookup timeout in seconds.
+	LookupTimeout int
+	// How long hostname lookup results are cached in seconds.
+	LookupCacheTTL int
+	// Ident lookup timeout in seconds.
+	IdentTimeout int
+
+	// Connections allowed per IP during ThrottleWindow, 0 is unlimited.
+	ThrottleConnections int
+	// Throttle window in seconds.
+	ThrottleWindow int
+	// Simultaneous connections allowed per IP, 0 is unlimited.
+	MaxClones int
+	// Simultaneous connections allowed per IPv6 /64, 0 is unlimited.
+	MaxClonesIPv6 int
+	// IP addresses and CIDR ranges exempt from throttling and clone limits.
+	LimitExempt []string
+
+	// Flood control for client commands, unset values use defaults.
+	Flood FloodConfig
+	// Maximum number of bytes queued for a client before it is disconnected.
+	SendQ int
+	// Seconds a connection has to complete registration.
+	RegistrationTimeout int
+	// Reason sent to clients when the server shuts down.
+	ShutdownReason string
+
+	// Connection classes, tried in order. Clients that do not match any
+	// class use the limits above.
+	Classes []ConnectionClass
+
+	// Account registration and nickname ownership.
+	Accounts AccountConfig
+
 	Parameters ServerConfigParameters
 }
 
@@ -54,6 +130,9 @@ type ServerConfigParameters struct {
 	// https://modern.ircdocs.horse/#elist-parameter
 	EList string
 	// https://modern.ircdocs.horse/#excepts-parameter
+	//
+	// Not used, EXCEPTS and INVEX are advertised when ChannelModes has the
+	// e and I list modes.
 	Excepts string
 	// https://modern.ircdocs.horse/#hostlen-parameter
 	MaxHostnameLength int
@@ -85,87 +164,488 @@ type ServerConfigParameters struct {
 //
 // Returns a ELIST compatible string
 func (s ServerConfigParameters) build() string {
+	if s.CaseMapping == "" {
+		s.CaseMapping = "ascii"
+	}
+	if s.ChannelModes == "" {
+		s.ChannelModes = defaultChannelModes
+	}
+	if s.ChannelPrefixes == "" {
+		s.ChannelPrefixes = defaultChannelPrefixes
+	}
+	if s.MaxList == "" {
+		lists, _, _ := strings.Cut(s.ChannelModes, ",")
+		s.MaxList = fmt.Sprintf("%s:%d", lists, defaultMaxList)
+	}
+
+	// only advertise list modes the server implements
+	excepts, invex, extban := "", "", ""
+	types := parseChannelModeTypes(s.ChannelModes, s.ChannelPrefixes)
+	supported := func(mode rune) bool {
+		kind, ok := types[mode]
+		return ok && kind == channelModeTypeList && channelModeHandlers[mode] != nil
+	}
+	if supported('e') {
+		excepts = " EXCEPTS=e"
+	}
+	if supported('I') {
+		invex = " INVEX=I"
+	}
+	if supported('b') {
+		types := []rune{}
+		for kind := range extbanTypes {
+			types = append(types, kind)
+		}
+		slices.Sort(types)
+		extban = fmt.Sprintf(" EXTBAN=%c,%s", extbanPrefix, string(types))
+	}
+
 	return fmt.Sprintf(
-		`AWAYLEN=%d CASEMAPPING=%s CHANLIMIT=%s CHANMODES=%s CHANTYPES=%s ELIST=%s HOSTLEN=%d KICKLEN=%d MAXLIST=%s MODES=%d NETWORK=%s NICKLEN=%d PREFIX=%s TARGMAX=%s TOPICLEN=%d USERLEN=%d`,
+		`AWAYLEN=%d CASEMAPPING=%s CHANLIMIT=%s CHANMODES=%s CHANTYPES=%s ELIST=%s%s%s HOSTLEN=%d%s KICKLEN=%d MAXLIST=%s MODES=%d NETWORK=%s NICKLEN=%d PREFIX=%s TARGMAX=%s TOPICLEN=%d USERLEN=%d`,
 		s.MaxAwayLength, s.CaseMapping, s.ChannelLimit,
-		s.ChannelModes, s.ChannelTypes, s.EList,
-		s.MaxHostnameLength, s.MaxKickLength, s.MaxList,
+		s.ChannelModes, s.ChannelTypes, s.EList, excepts, extban,
+		s.MaxHostnameLength, invex, s.MaxKickLength, s.MaxList,
 		s.MaxModes, s.Network, s.MaxNickLength,
 		s.ChannelPrefixes, s.MaxTargets, s.MaxTopicLength,
 		s.MaxUserLength,
 	)
 }
 
-type server struct {
+// IRC server.
+//
+// Create with NewServer, serve listeners with Run or Serve and stop with
+// Shutdown.
+type Server struct {
 	mu        *sync.RWMutex
 	router    router
 	name      string
 	password  string
 	network   string
 	version   string
-	Clients   ClientStorer
-	Channels  ChannelStorer
-	Operators OperatorStorer
-	motd      *[]string
+	clients   ClientStorer
+	channels  ChannelStorer
+	operators OperatorStorer
+	vhosts    VhostStorer
+	accounts  AccountStorer
+	// Registered channels.
+	registrations ChannelRegistrationStorer
+	// Server bans (K-lines).
+	bans ServerBanStorer
+	// Channel message history.
+	history HistoryStorer
+	// Database the stores are saved to, nil if they are not saved.
+	db   *Database
+	motd *[]string
 	// List of active ports. TLS is prefixed with a +
 	p []string
 
-	pingFrequency  int
-	pongMaxLatency int
+	params     string
+	parameters ServerConfigParameters
+	// Channel mode types from CHANMODES and PREFIX.
+	channelModes map[rune]channelModeType
+	// List mode limits from MAXLIST.
+	listLimits []listLimit
+	// Casemapping from CASEMAPPING, used to compare masks.
+	casemapping casemapping
+
+	cloak        cloak
+	resolver     *hostnameResolver
+	identTimeout time.Duration
+	// Time a connection has to complete registration.
+	registrationTimeout time.Duration
+	limiter             *connectionLimiter
+
+	classes      []*connectionClass
+	defaultClass *connectionClass
+
+	// Account service, nil if accounts are disabled.
+	nickserv *nickServ
+	// Channel registration service, nil if accounts are disabled.
+	chanserv *chanServ
+
+	// Clients that have started or completed the handshake.
+	handshakes *sync.Map
+
+	// Listeners passed to Run.
+	listeners map[net.Listener]ListenerConfig
+	// Closed when Shutdown is called.
+	closing        chan struct{}
+	closeOnce      *sync.Once
+	shutdownReason string
+	// Running handleConnection calls.
+	connections *sync.WaitGroup
+
+	// Held during an upgrade.
+	upgradeMu *sync.Mutex
+	// Closed when an upgrade finishes, nil if no upgrade is in progress.
+	upgrading chan struct{}
+	// Did the new process take over?
+	upgraded bool
+
+	// Listeners added with WithListener, served by Serve.
+	serve []InheritedListener
+
+	log      zerolog.Logger
+	registry prometheus.Registerer
+	// Current time, used for timestamps and expiry.
+	now func() time.Time
 
-	params string
+	// Event subscribers added with Subscribe.
+	hooks *hooks
 
 	// regex cache
 	regex map[regexKey]*regexp.Regexp
 }
 
-func NewServer(config ServerConfig) *server {
-	server := &server{
-		mu:             &sync.RWMutex{},
-		name:           config.Name,
-		password:       config.Password,
-		network:        config.Network,
-		version:        config.Version,
-		Clients:        NewClientStore("clients"),
-		Channels:       NewChannelStore("channels"),
-		Operators:      NewOperatorStore(),
-		motd:           &config.MOTD,
-		p:              []string{},
-		pingFrequency:  config.PingFrequency,
-		pongMaxLatency: config.PongMaxLatency,
-		params:         config.Parameters.build(),
-		regex:          make(map[regexKey]*regexp.Regexp),
+// Creates a server from config, options override the defaults.
+func NewServer(config ServerConfig, opts ...Option) *Server {
+	resolver := config.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	lookupTimeout := config.LookupTimeout
+	if lookupTimeout <= 0 {
+		lookupTimeout = defaultLookupTimeout
+	}
+	lookupCacheTTL := config.LookupCacheTTL
+	if lookupCacheTTL <= 0 {
+		lookupCacheTTL = defaultLookupCacheTTL
+	}
+	identTimeout := config.IdentTimeout
+	if identTimeout <= 0 {
+		identTimeout = defaultIdentTimeout
+	}
+	registrationTimeout := config.RegistrationTimeout
+	if registrationTimeout <= 0 {
+		registrationTimeout = defaultRegistrationTimeout
+	}
+	shutdownReason := config.ShutdownReason
+	if shutdownReason == "" {
+		shutdownReason = "Server shutting down"
+	}
+
+	server := &Server{
+		mu:                  &sync.RWMutex{},
+		name:                config.Name,
+		password:            config.Password,
+		network:             config.Network,
+		version:             config.Version,
+		clients:             NewClientStore("clients"),
+		channels:            NewChannelStore("channels"),
+		operators:           NewOperatorStore(),
+		vhosts:              NewVhostStore(),
+		accounts:            NewAccountStore(),
+		registrations:       NewChannelRegistrationStore(),
+		bans:                NewServerBanStore(),
+		history:             NewHistoryStore(defaultHistoryLimit),
+		motd:                &config.MOTD,
+		p:                   []string{},
+		params:              config.Parameters.build(),
+		parameters:          config.Parameters,
+		channelModes:        parseChannelModeTypes(config.Parameters.ChannelModes, config.Parameters.ChannelPrefixes),
+		listLimits:          parseMaxList(config.Parameters.MaxList),
+		casemapping:         parseCasemapping(config.Parameters.CaseMapping),
+		identTimeout:        time.Duration(identTimeout) * time.Second,
+		registrationTimeout: time.Duration(registrationTimeout) * time.Second,
+		handshakes:          &sync.Map{},
+		listeners:           make(map[net.Listener]ListenerConfig),
+		closing:             make(chan struct{}),
+		closeOnce:           &sync.Once{},
+		shutdownReason:      shutdownReason,
+		connections:         &sync.WaitGroup{},
+		upgradeMu:           &sync.Mutex{},
+		classes:             []*connectionClass{},
+		serve:               []InheritedListener{},
+		log:                 log.Logger,
+		registry:            prometheus.DefaultRegisterer,
+		now:                 time.Now,
+		hooks:               newHooks(),
+		regex:               make(map[regexKey]*regexp.Regexp),
+	}
+
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	server.cloak = newCloak(config.CloakKeys, config.CloakSuffix, server.log)
+	server.resolver = newHostnameResolver(
+		resolver,
+		time.Duration(lookupTimeout)*time.Second,
+		time.Duration(lookupCacheTTL)*time.Second,
+	)
+	server.resolver.now = server.now
+	server.limiter = newConnectionLimiter(
+		config.ThrottleConnections,
+		time.Duration(config.ThrottleWindow)*time.Second,
+		config.MaxClones,
+		config.MaxClonesIPv6,
+		config.LimitExempt,
+		server.log,
+	)
+	server.limiter.now = server.now
+
+	server.defaultClass = newConnectionClass(ConnectionClass{
+		Name:           "default",
+		PingFrequency:  config.PingFrequency,
+		PongMaxLatency: config.PongMaxLatency,
+		SendQ:          config.SendQ,
+		Flood:          config.Flood,
+		Password:       config.Password,
+	}, server.log)
+	for _, class := range config.Classes {
+		server.classes = append(server.classes, newConnectionClass(class, server.log))
+	}
+
+	if server.registry != nil {
+		err := metrics.Register(server.registry)
+		if err != nil {
+			server.log.Error().Err(err).Msg("cant register metrics")
+		}
 	}
 
 	compileRegexp(server)
 	registerHandlers(server)
+
+	if config.Accounts.Enabled {
+		nickserv, err := newNickServ(server, config.Accounts)
+		if err != nil {
+			server.log.Error().Err(err).Msg("cant start account service")
+		}
+		server.nickserv = nickserv
+		chanserv, err := newChanServ(server, config.Accounts)
+		if err != nil {
+			server.log.Error().Err(err).Msg("cant start channel service")
+		}
+		server.chanserv = chanserv
+		server.router.registerHandler("REGISTER", handleRegister, middlewareNeedParams(3))
+	}
 	return server
 }
 
-func (s *server) Run(listener net.Listener, isTLS bool) {
+// Accepts connections from listener until ctx is done or Shutdown is called.
+//
+// The listener is closed when Run returns. Returns ErrServerClosed after
+// Shutdown, ErrServerUpgraded after a successful Upgrade, ctx.Err() if ctx is
+// done and net.ErrClosed if the listener was closed elsewhere. Other accept
+// errors, such as running out of file descriptors, are retried with backoff.
+func (s *Server) Run(ctx context.Context, listener net.Listener, config ListenerConfig) error {
+	if config.TLSConfig != nil {
+		config.TLS = true
+	}
+	if !s.trackListener(listener, config) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(listener)
+
+	accept := listener
+	if config.TLSConfig != nil {
+		accept = tls.NewListener(listener, config.TLSConfig)
+	}
+
 	_, port, err := net.SplitHostPort(listener.Addr().String())
 	if err != nil {
-		log.Error().Err(err).Msgf("cant split net host port")
+		s.log.Error().Err(err).Msgf("cant split net host port")
 	}
 
-	if isTLS {
+	if config.TLS {
 		s.addPort(fmt.Sprintf("+%s", port))
 	} else {
 		s.addPort(port)
 	}
 
+	// unblock Accept when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			listener.Close()
+		case <-done:
+		}
+	}()
+
+	var delay time.Duration
 	for {
-		connection, err := listener.Accept()
+		connection, err := accept.Accept()
 		if err != nil {
-			log.Error().Err(err).Msg("unable to accept connection")
+			select {
+			case <-s.closing:
+				return ErrServerClosed
+			default:
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// accepting is paused while an upgrade is in progress
+			if paused, upgraded := s.awaitUpgrade(); upgraded {
+				return ErrServerUpgraded
+			} else if paused {
+				continue
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				s.log.Error().Err(err).Msg("unable to accept connection")
+				return err
+			}
+
+			// retry everything else, such as running out of file descriptors
+			delay = min(max(delay*2, 5*time.Millisecond), time.Second)
+			s.log.Error().Err(err).Msgf("unable to accept connection, retrying in %s", delay)
+			select {
+			case <-time.After(delay):
+			case <-s.closing:
+			case <-ctx.Done():
+			}
+			continue
+		}
+		delay = 0
+
+		if !s.admit(connection) {
+			continue
+		}
+
+		s.connections.Add(1)
+		go func() {
+			defer s.connections.Done()
+			handleConnection(connection, s, config)
+		}()
+	}
+}
+
+// Runs every listener added with WithListener until ctx is done or Shutdown
+// is called.
+//
+// Returns the first error from Run that is not ErrServerClosed,
+// ErrServerUpgraded or ctx.Err().
+func (s *Server) Serve(ctx context.Context) error {
+	s.mu.RLock()
+	listeners := s.serve
+	s.mu.RUnlock()
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			errs <- s.Run(ctx, l.Listener, l.Config)
+		}()
+	}
+
+	var first error
+	for range listeners {
+		err := <-errs
+		if err == nil || first != nil ||
+			errors.Is(err, ErrServerClosed) ||
+			errors.Is(err, ErrServerUpgraded) ||
+			errors.Is(err, ctx.Err()) {
 			continue
 		}
-		go handleConnection(connection, s)
+		first = err
+	}
+	return first
+}
+
+// Adds operator credentials. If hostmasks are given, only clients matching
+// one of the user@host masks on their real hostname or IP address can use
+// them. Hosts may be CIDR ranges.
+func (s *Server) AddOperator(username string, password string, hostmasks ...string) {
+	s.operators.add(username, password, hostmasks...)
+}
+
+// Stops accepting connections and disconnects all clients.
+//
+// Clients are sent ERROR with the shutdown reason, their send queues are
+// flushed and Shutdown waits until every connection has been cleaned up.
+// Returns ctx.Err() if ctx is done first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+
+	s.mu.Lock()
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	s.mu.Unlock()
+
+	for _, c := range s.clients.all() {
+		c.kill(s.shutdownReason)
+	}
+	s.stopListTimers()
+
+	done := make(chan struct{})
+	go func() {
+		s.connections.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Adds listener to the set closed by Shutdown, returns false if the server is
+// already shutting down.
+func (s *Server) trackListener(listener net.Listener, config ListenerConfig) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.closing:
+		return false
+	default:
+	}
+	s.listeners[listener] = config
+	return true
+}
+
+func (s *Server) untrackListener(listener net.Listener) {
+	s.mu.Lock()
+	delete(s.listeners, listener)
+	s.mu.Unlock()
+	listener.Close()
+}
+
+// Returns the remote IP address of connection, empty if it is not known.
+func remoteIP(connection net.Conn) string {
+	if connection.RemoteAddr() == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(connection.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// Checks connection limits, rejected connections are sent an ERROR and closed.
+func (s *Server) admit(connection net.Conn) bool {
+	ip := remoteIP(connection)
+	err := s.limiter.accept(ip)
+	if err == nil {
+		return true
+	}
+
+	reason, text := "clones", "Too many connections from your host"
+	if err == errorThrottled {
+		reason, text = "throttle", "Throttled: reconnecting too fast"
+	}
+	metrics.Rejected.WithLabelValues(reason).Inc()
+
+	// client is not reading yet, do not wait for it
+	if connection.SetWriteDeadline(time.Now().Add(time.Second)) == nil {
+		io.WriteString(connection, errorCommand{
+			text: fmt.Sprintf("Closing Link: %s (%s)", ip, text),
+		}.command()+"\r\n")
 	}
+	connection.Close()
+	return false
 }
 
 // Compiles expressions and caches them to a map.
-func compileRegexp(s *server) {
+func compileRegexp(s *Server) {
 	rgxNick, err := regexp.Compile(`([a-zA-Z0-9\[\]\{\}\\\|]{2,31})`)
 	if err != nil {
 		log.Panic().Err(err).Msg("unable to compile nickname validation regex")
@@ -177,15 +657,28 @@ func compileRegexp(s *server) {
 		log.Panic().Err(err).Msg("unable to compile channel validation regex")
 	}
 	s.regex[regexChannel] = rgxChannel
+
+	rgxHostname, err := regexp.Compile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]*[a-zA-Z0-9])?)*$`)
+	if err != nil {
+		log.Panic().Err(err).Msg("unable to compile hostname validation regex")
+	}
+	s.regex[regexHostname] = rgxHostname
+
+	rgxUsername, err := regexp.Compile(`^[a-zA-Z0-9_\-\.\[\]\{\}\\|^~]{1,}$`)
+	if err != nil {
+		log.Panic().Err(err).Msg("unable to compile username validation regex")
+	}
+	s.regex[regexUsername] = rgxUsername
 }
 
-func registerHandlers(s *server) {
+func registerHandlers(s *Server) {
 	router := NewCommandRouter(s)
-	router.registerGlobalMiddleware(func(s *server, c clienter, m message, next handlerFunc) handlerFunc {
+	router.registerGlobalMiddleware(func(s *Server, c clienter, m message, next handlerFunc) handlerFunc {
 		metrics.Command.WithLabelValues(m.command).Inc()
 		return next
 	})
 
+	router.registerHandler("CAP", handleCap, middlewareNeedParams(1))
 	router.registerHandler("PASS", handlePass, middlewareNeedParams(1))
 	router.registerHandler("PING", handlePing)
 	router.registerHandler("PONG", handlePong)
@@ -197,6 +690,7 @@ func registerHandlers(s *server) {
 	router.registerHandler("KICK", handleKick, middlewareNeedHandshake, middlewareNeedParams(2))
 	router.registerHandler("TOPIC", handleTopic, middlewareNeedHandshake, middlewareNeedParams(1))
 	router.registerHandler("PRIVMSG", handlePrivmsg, middlewareNeedHandshake, middlewareNeedParams(1))
+	router.registerHandler("NOTICE", handleNotice, middlewareNeedHandshake, middlewareNeedParams(2))
 	router.registerHandler("WHOIS", handleWhois, middlewareNeedHandshake, middlewareNeedParams(1))
 	router.registerHandler("WHO", handleWho, middlewareNeedHandshake)
 	router.registerHandler("MODE", handleMode, middlewareNeedHandshake, middlewareNeedParams(1))
@@ -206,46 +700,179 @@ func registerHandlers(s *server) {
 	router.registerHandler("VERSION", handleVersion, middlewareNeedHandshake)
 	router.registerHandler("LIST", handleList, middlewareNeedHandshake)
 	router.registerHandler("INVITE", handleInvite, middlewareNeedHandshake, middlewareNeedParams(2))
-	router.registerHandler("DEBUG", func(s *server, c clienter, m message) {
+	router.registerHandler("CHGHOST", handleChghost, middlewareNeedHandshake, middlewareNeedOper, middlewareNeedParams(2))
+	router.registerHandler("CHGIDENT", handleChgident, middlewareNeedHandshake, middlewareNeedOper, middlewareNeedParams(2))
+	router.registerHandler("CHGNAME", handleChgname, middlewareNeedHandshake, middlewareNeedOper, middlewareNeedParams(2))
+	router.registerHandler("SETHOST", handleSethost, middlewareNeedHandshake, middlewareNeedOper, middlewareNeedParams(1))
+	router.registerHandler("KLINE", handleKline, middlewareNeedHandshake, middlewareNeedOper, middlewareNeedParams(1))
+	router.registerHandler("UNKLINE", handleUnkline, middlewareNeedHandshake, middlewareNeedOper, middlewareNeedParams(1))
+	router.registerHandler("VHOST", handleVhost, middlewareNeedHandshake, middlewareNeedParams(1))
+	router.registerHandler("DEBUG", func(s *Server, c clienter, m message) {
 		func() {}() // breakpoint here
 	}, middlewareNeedHandshake)
 
 	s.router = router
 }
 
-func (s *server) addPort(port string) {
+func (s *Server) addPort(port string) {
 	s.mu.Lock()
 	s.p = append(s.p, port)
 	s.mu.Unlock()
 }
 
-func (s *server) ports() []string {
+func (s *Server) ports() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.p
 }
 
 // Returns the number of connected clients and open channels.
-func (s *server) Stats() (visible int, invisible, channels int) {
-	visible, invisible = s.Clients.count()
-	return visible, invisible, s.Channels.count()
+func (s *Server) Stats() (visible int, invisible int, unknown int, channels int) {
+	visible, invisible, unknown = s.clients.count()
+	return visible, invisible, unknown, s.channels.count()
 }
 
 // Removes client from channels and client map.
-func (s *server) cleanup(c clienter) {
+func (s *Server) cleanup(c clienter) {
+	event := &QuitEvent{
+		Client: &Client{s: s, c: c},
+		Reason: c.quitReason(),
+	}
+	visible := emit(s, event)
+
 	// Send QUIT to all channels that the client is a member of.
-	for _, ch := range s.Channels.memberOf(c) {
-		ch.broadcastCommand(quitCommand{
-			prefix: c.prefix(),
-			text:   fmt.Sprintf("Quit: %s", c.quitReason()),
-		}, c.id(), true)
+	for _, ch := range s.channels.memberOf(c) {
+		if visible {
+			ch.broadcastCommand(quitCommand{
+				prefix: c.prefix(),
+				text:   fmt.Sprintf("Quit: %s", event.Reason),
+			}, c.id(), true)
+		}
 		ch.clients().remove(c)
 	}
-	s.Clients.delete(c.id())
+	s.clients.delete(c.id())
+	s.vhosts.delete(c.id())
+	// virtual clients do not take a slot in their class
+	if _, virtual := c.(*virtualClient); !virtual && c.handshake() {
+		c.class().leave()
+	}
+	s.handshakes.Delete(c.id())
 	metrics.Clients.Dec()
 }
 
-func (s *server) MOTD() []string {
+// Changes the nickname of a registered client and lets the client and
+// everyone sharing a channel with it know.
+func (s *Server) changeNick(c clienter, nickname string) {
+	nick := nickCommand{
+		prefix: c.prefix(),
+		nick:   nickname,
+	}
+	c.setNickname(nickname)
+
+	c.sendCommand(nick)
+	notified := map[clientID]bool{c.id(): true}
+	for _, ch := range s.channels.memberOf(c) {
+		for _, member := range ch.clients().all() {
+			if notified[member.id()] {
+				continue
+			}
+			member.sendCommand(nick)
+			notified[member.id()] = true
+		}
+	}
+}
+
+// Changes the username and hostname of a client.
+//
+// Clients sharing a channel with c that have negotiated chghost receive a
+// CHGHOST message, others see c quit and rejoin with the new prefix.
+func (s *Server) changeHost(c clienter, username string, hostname string) {
+	// not visible to anyone yet
+	if !c.handshake() {
+		c.setUser(username, c.realname())
+		c.setHostname(hostname)
+		return
+	}
+
+	old := c.prefix()
+	c.setUser(username, c.realname())
+	c.setHostname(hostname)
+	if old == c.prefix() {
+		return
+	}
+
+	c.sendRPL(s.name, rplHostHidden{
+		client:   c.nickname(),
+		hostname: hostname,
+	})
+
+	chghost := chghostCommand{
+		prefix:   old,
+		username: username,
+		hostname: hostname,
+	}
+	if c.hasCapability(capChghost) {
+		c.sendCommand(chghost)
+	}
+
+	notified := map[clientID]bool{c.id(): true}
+	for _, ch := range s.channels.memberOf(c) {
+		modes := strings.TrimPrefix(ch.clients().modestring(c), "+")
+		for _, member := range ch.clients().all() {
+			if member.id() == c.id() || member.quitReason() != "" {
+				continue
+			}
+
+			if member.hasCapability(capChghost) {
+				if !notified[member.id()] {
+					member.sendCommand(chghost)
+					notified[member.id()] = true
+				}
+				continue
+			}
+
+			// fallback for clients without chghost, quit once and
+			// rejoin every shared channel
+			if !notified[member.id()] {
+				member.sendCommand(quitCommand{
+					prefix: old,
+					text:   "Changing host",
+				})
+				notified[member.id()] = true
+			}
+			member.sendCommand(joinCommand{
+				prefix:  c.prefix(),
+				channel: ch.name(),
+			})
+			if modes != "" {
+				member.sendCommand(modeCommand{
+					source:     s.name,
+					target:     ch.name(),
+					modestring: "+" + modes,
+					args:       strings.TrimSpace(strings.Repeat(c.nickname()+" ", len(modes))),
+				})
+			}
+		}
+	}
+}
+
+// Is hostname valid and within the HOSTLEN limit?
+func (s *Server) validHostname(hostname string) bool {
+	if s.parameters.MaxHostnameLength > 0 && len(hostname) > s.parameters.MaxHostnameLength {
+		return false
+	}
+	return s.regex[regexHostname].MatchString(hostname)
+}
+
+// Is username valid and within the USERLEN limit?
+func (s *Server) validUsername(username string) bool {
+	if s.parameters.MaxUserLength > 0 && len(username) > s.parameters.MaxUserLength {
+		return false
+	}
+	return s.regex[regexUsername].MatchString(username)
+}
+
+func (s *Server) MOTD() []string {
 	var motd []string
 	s.mu.RLock()
 	motd = *s.motd
@@ -0,0 +1,165 @@
+package ircd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ServerBanStorer interface {
+	// Adds a ban, replacing an existing ban with the same mask.
+	add(ban serverBan) error
+	// Removes the ban with mask.
+	remove(mask string) error
+	// Returns the first ban matching c under cm that has not expired at now.
+	match(c clienter, cm casemapping, now time.Time) (serverBan, bool)
+	// Returns bans that have not expired at now, ordered by mask.
+	all(now time.Time) []serverBan
+}
+
+// Server ban (K-line) on user@host, the host may be a CIDR range.
+type serverBan struct {
+	// Lowercase user@host mask.
+	Mask   string
+	Reason string
+	// Nickname of the operator who set the ban.
+	Setter string
+	Set    time.Time
+	// Zero if the ban does not expire.
+	Expires time.Time
+}
+
+func (b serverBan) expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+// Does the ban match username on the real hostname or IP address of c?
+// Virtual clients such as services are never matched.
+func (b serverBan) matches(cm casemapping, c clienter) bool {
+	if _, virtual := c.(*virtualClient); virtual {
+		return false
+	}
+	return matchUserHostMask(cm, b.Mask, c)
+}
+
+// Server bans kept in memory and optionally saved to a database.
+type ServerBanStore struct {
+	mu *sync.RWMutex
+
+	// Nil if bans are not saved.
+	db *Database
+	// Keyed by mask.
+	bans map[string]serverBan
+}
+
+// Creates a server ban store that is not saved.
+func NewServerBanStore() *ServerBanStore {
+	return &ServerBanStore{
+		mu:   &sync.RWMutex{},
+		bans: make(map[string]serverBan),
+	}
+}
+
+// Creates a server ban store saved to db, existing bans are loaded and
+// bans that have expired are deleted.
+func OpenServerBanStore(db *Database) (*ServerBanStore, error) {
+	bs := NewServerBanStore()
+	bs.db = db
+
+	for _, raw := range db.scan("kline/") {
+		ban := serverBan{}
+		err := json.Unmarshal(raw, &ban)
+		if err != nil {
+			return nil, fmt.Errorf("cant read server ban: %w", err)
+		}
+		bs.bans[ban.Mask] = ban
+	}
+
+	ops := bs.purge(time.Now())
+	if len(ops) == 0 {
+		return bs, nil
+	}
+	err := db.write(ops...)
+	if err != nil {
+		return nil, fmt.Errorf("cant delete expired server bans: %w", err)
+	}
+	return bs, nil
+}
+
+func (bs *ServerBanStore) add(ban serverBan) error {
+	ban.Mask = strings.ToLower(ban.Mask)
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	ops := bs.purge(ban.Set)
+	bs.bans[ban.Mask] = ban
+	if bs.db == nil {
+		return nil
+	}
+	op, err := databasePut("kline/"+ban.Mask, ban)
+	if err != nil {
+		return err
+	}
+	return bs.db.write(append(ops, op)...)
+}
+
+// Removes bans that have expired at now and returns the database
+// operations deleting them. Caller must hold the write lock.
+func (bs *ServerBanStore) purge(now time.Time) []databaseOp {
+	ops := []databaseOp{}
+	if now.IsZero() {
+		return ops
+	}
+	for mask, ban := range bs.bans {
+		if ban.expired(now) {
+			delete(bs.bans, mask)
+			ops = append(ops, databaseOp{Key: "kline/" + mask, Delete: true})
+		}
+	}
+	return ops
+}
+
+func (bs *ServerBanStore) remove(mask string) error {
+	mask = strings.ToLower(mask)
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if _, ok := bs.bans[mask]; !ok {
+		return errorServerBanDoesNotExist
+	}
+	delete(bs.bans, mask)
+	if bs.db == nil {
+		return nil
+	}
+	return bs.db.delete("kline/" + mask)
+}
+
+func (bs *ServerBanStore) match(c clienter, cm casemapping, now time.Time) (serverBan, bool) {
+	for _, ban := range bs.all(now) {
+		if ban.matches(cm, c) {
+			return ban, true
+		}
+	}
+	return serverBan{}, false
+}
+
+func (bs *ServerBanStore) all(now time.Time) []serverBan {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	bans := []serverBan{}
+	for _, ban := range bs.bans {
+		if !ban.expired(now) {
+			bans = append(bans, ban)
+		}
+	}
+	slices.SortFunc(bans, func(a, b serverBan) int {
+		return strings.Compare(a.Mask, b.Mask)
+	})
+	return bans
+}
@@ -0,0 +1,317 @@
+package ircd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name:           "server",
+		LookupTimeout:  1,
+		ShutdownReason: "Going down",
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run(context.Background(), listener, ListenerConfig{})
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// wait for the client to be added to the store
+	deadline := time.Now().Add(time.Second)
+	for len(s.clients.all()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client was not added")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	err = <-errs
+	if !errors.Is(err, ErrServerClosed) {
+		t.Errorf("got: %v, want: %v", err, ErrServerClosed)
+	}
+
+	if len(s.clients.all()) != 0 {
+		t.Errorf("clients left after shutdown")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("did not receive ERROR: %v", err)
+		}
+		if strings.HasPrefix(line, "ERROR") {
+			if !strings.Contains(line, "Going down") {
+				t.Errorf("got: %s, want shutdown reason", line)
+			}
+			break
+		}
+	}
+}
+
+func TestServerRunContext(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run(ctx, listener, ListenerConfig{})
+	}()
+	cancel()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got: %v, want: %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return")
+	}
+}
+
+// Listener that fails with EMFILE a number of times, then blocks until it is
+// closed.
+type failingListener struct {
+	net.Listener
+	mu       *sync.Mutex
+	failures int
+	accepts  int
+	closed   chan struct{}
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	l.accepts++
+	fail := l.accepts <= l.failures
+	l.mu.Unlock()
+	if fail {
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *failingListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+	}
+	return nil
+}
+
+func TestServerRunRetriesAcceptErrors(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name: "server",
+	})
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	listener := &failingListener{
+		Listener: tcp,
+		mu:       &sync.Mutex{},
+		failures: 3,
+		closed:   make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Run(ctx, listener, ListenerConfig{})
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		listener.mu.Lock()
+		accepts := listener.accepts
+		listener.mu.Unlock()
+		if accepts > listener.failures {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d accepts, want %d", accepts, listener.failures+1)
+		}
+		select {
+		case err := <-errs:
+			t.Fatalf("run returned: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got: %v, want: %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return")
+	}
+}
+
+func TestServerRegistrationTimeout(t *testing.T) {
+	s := NewServer(ServerConfig{
+		Name:                "server",
+		LookupTimeout:       1,
+		RegistrationTimeout: 2,
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run(context.Background(), listener, ListenerConfig{})
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	registered, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registered.Close()
+	registered.Write([]byte("NICK nick\r\nUSER user 0 * :real\r\n"))
+
+	readers := map[net.Conn]*bufio.Reader{
+		idle:       bufio.NewReader(idle),
+		registered: bufio.NewReader(registered),
+	}
+	// reads lines from conn until one starts with prefix
+	readUntil := func(conn net.Conn, prefix string) (string, error) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reader := readers[conn]
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return "", err
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line, nil
+			}
+		}
+	}
+
+	if _, err := readUntil(registered, ":server 001"); err != nil {
+		t.Fatalf("registration did not complete: %v", err)
+	}
+
+	line, err := readUntil(idle, "ERROR")
+	if err != nil {
+		t.Fatalf("did not receive ERROR: %v", err)
+	}
+	if !strings.Contains(line, "Registration timed out") {
+		t.Errorf("got: %s, want registration timeout", line)
+	}
+
+	// the registered client is still connected after the timeout
+	registered.Write([]byte("PING :still-here\r\n"))
+	line, err = readUntil(registered, "PONG")
+	if err != nil {
+		t.Fatalf("registered client was disconnected: %v", err)
+	}
+	if !strings.Contains(line, "still-here") {
+		t.Errorf("got: %s, want PONG", line)
+	}
+}
+
+func TestParametersExceptionTokens(t *testing.T) {
+	tcs := []struct {
+		chanmodes string
+		excepts   bool
+		invex     bool
+	}{
+		{chanmodes: "beI,k,,imnt", excepts: true, invex: true},
+		{chanmodes: "b,k,,imnt", excepts: false, invex: false},
+		{chanmodes: "be,k,,imnt", excepts: true, invex: false},
+		// e is not a list mode
+		{chanmodes: "b,k,,eimnt", excepts: false, invex: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.chanmodes, func(t *testing.T) {
+			tokens := strings.Fields(ServerConfigParameters{ChannelModes: tc.chanmodes}.build())
+			if got := slices.Contains(tokens, "EXCEPTS=e"); got != tc.excepts {
+				t.Errorf("EXCEPTS got: %t, want: %t", got, tc.excepts)
+			}
+			if got := slices.Contains(tokens, "INVEX=I"); got != tc.invex {
+				t.Errorf("INVEX got: %t, want: %t", got, tc.invex)
+			}
+		})
+	}
+}
+
+func TestParametersExtban(t *testing.T) {
+	tokens := strings.Fields(ServerConfigParameters{ChannelModes: "beI,k,,imnt"}.build())
+	if !slices.Contains(tokens, "EXTBAN=$,ajmrxz") {
+		t.Errorf("EXTBAN missing from %v", tokens)
+	}
+}
+
+// Connection without a local address, newClient rejects it.
+type localAddrlessConnMock struct {
+	connMock
+}
+
+func (c *localAddrlessConnMock) LocalAddr() net.Addr { return nil }
+
+func TestHandleConnectionReleasesLimiter(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+	conn := &localAddrlessConnMock{}
+
+	if !s.admit(conn) {
+		t.Fatal("connection was not admitted")
+	}
+	handleConnection(conn, s, ListenerConfig{})
+
+	if len(s.limiter.active) != 0 {
+		t.Errorf("got active connections %v, want none", s.limiter.active)
+	}
+}
@@ -113,7 +113,7 @@ func (s *channelClientStore) removeMode(c clienter, mode channelMembershipMode)
 	}
 
 	s.mu.Lock()
-	current |= mode
+	current &^= mode
 	s.clients[c] = current
 	s.mu.Unlock()
 }
@@ -5,14 +5,17 @@ import "sync"
 type clientID string
 
 type ClientStorer interface {
-	// Number of clients in store.
-	count() (visible int, invisible int)
+	// Number of registered clients in store and number of clients that have
+	// not completed registration.
+	count() (visible int, invisible int, unknown int)
 	// add client to store.
 	add(c clienter)
 	// Remove client from store.
 	delete(id clientID)
 	// Get client from store by nickname.
 	get(nickname string) (c clienter, exists bool)
+	// Get all clients.
+	all() []clienter
 }
 
 type clientStore struct {
@@ -30,10 +33,12 @@ func NewClientStore(id string) *clientStore {
 }
 
 // Get number of clients in store.
-func (s *clientStore) count() (visible int, invisible int) {
+func (s *clientStore) count() (visible int, invisible int, unknown int) {
 	s.mu.RLock()
 	for _, c := range s.clients {
-		if c.hasMode(modeClientInvisible) {
+		if !c.handshake() {
+			unknown++
+		} else if c.hasMode(modeClientInvisible) {
 			invisible++
 		} else {
 			visible++
@@ -41,7 +46,7 @@ func (s *clientStore) count() (visible int, invisible int) {
 	}
 	s.mu.RUnlock()
 
-	return visible, invisible
+	return visible, invisible, unknown
 }
 
 // get client from store by nickname.
@@ -77,3 +82,16 @@ func (s *clientStore) delete(id clientID) {
 	delete(s.clients, id)
 	s.mu.Unlock()
 }
+
+// get all clients in store.
+func (s *clientStore) all() []clienter {
+	clients := []clienter{}
+
+	s.mu.RLock()
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.RUnlock()
+
+	return clients
+}
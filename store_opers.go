@@ -1,40 +1,61 @@
 package ircd
 
-import "sync"
+import (
+	"slices"
+	"sync"
+)
 
 type OperatorStorer interface {
-	add(user string, password string)
+	// Adds credentials, limited to clients matching any of the user@host
+	// masks if there are any.
+	add(user string, password string, hostmasks ...string)
 	auth(user string, password string) bool
+	// Returns the host masks of user, empty if any host can use it.
+	hostmasks(user string) []string
+}
+
+type operator struct {
+	password  string
+	hostmasks []string
 }
 
 type OperatorStore struct {
 	mu *sync.RWMutex
 
-	ops map[string]string
+	ops map[string]operator
 }
 
 func NewOperatorStore() *OperatorStore {
 	return &OperatorStore{
 		mu:  &sync.RWMutex{},
-		ops: make(map[string]string),
+		ops: make(map[string]operator),
 	}
 }
 
-func (os *OperatorStore) add(user string, password string) {
+func (os *OperatorStore) add(user string, password string, hostmasks ...string) {
 	os.mu.Lock()
-	os.ops[user] = password
+	os.ops[user] = operator{
+		password:  password,
+		hostmasks: slices.Clone(hostmasks),
+	}
 	os.mu.Unlock()
 }
 
 func (os *OperatorStore) auth(user string, password string) bool {
 	os.mu.RLock()
 	defer os.mu.RUnlock()
-	p, ok := os.ops[user]
+	op, ok := os.ops[user]
 	if !ok {
 		return false
 	}
-	if p == password {
+	if op.password == password {
 		return true
 	}
 	return false
 }
+
+func (os *OperatorStore) hostmasks(user string) []string {
+	os.mu.RLock()
+	defer os.mu.RUnlock()
+	return slices.Clone(os.ops[user].hostmasks)
+}
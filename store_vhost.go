@@ -0,0 +1,56 @@
+package ircd
+
+import "sync"
+
+type VhostStorer interface {
+	// Add vhost request for client.
+	add(id clientID, hostname string)
+	// Get requested vhost for client.
+	get(id clientID) (hostname string, exists bool)
+	// Delete vhost request.
+	delete(id clientID)
+	// Get all pending requests.
+	all() map[clientID]string
+}
+
+type vhostStore struct {
+	mu       *sync.RWMutex
+	requests map[clientID]string
+}
+
+func NewVhostStore() *vhostStore {
+	return &vhostStore{
+		mu:       &sync.RWMutex{},
+		requests: make(map[clientID]string),
+	}
+}
+
+func (s *vhostStore) add(id clientID, hostname string) {
+	s.mu.Lock()
+	s.requests[id] = hostname
+	s.mu.Unlock()
+}
+
+func (s *vhostStore) get(id clientID) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hostname, ok := s.requests[id]
+	return hostname, ok
+}
+
+func (s *vhostStore) delete(id clientID) {
+	s.mu.Lock()
+	delete(s.requests, id)
+	s.mu.Unlock()
+}
+
+func (s *vhostStore) all() map[clientID]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	requests := make(map[clientID]string, len(s.requests))
+	for id, hostname := range s.requests {
+		requests[id] = hostname
+	}
+	return requests
+}
@@ -0,0 +1,182 @@
+package ircd
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Limits how often and how many times a single address can connect.
+type connectionLimiter struct {
+	mu  *sync.Mutex
+	now func() time.Time
+
+	// Connections allowed per window per IP, 0 is unlimited.
+	connections int
+	window      time.Duration
+	// Simultaneous connections per IP, 0 is unlimited.
+	clones int
+	// Simultaneous connections per IPv6 /64, 0 is unlimited.
+	clones6 int
+	// Addresses that are not limited.
+	exempt []*net.IPNet
+
+	attempts map[string][]time.Time
+	active   map[string]int
+}
+
+func newConnectionLimiter(connections int, window time.Duration, clones int, clones6 int, exempt []string, logger zerolog.Logger) *connectionLimiter {
+	l := &connectionLimiter{
+		mu:          &sync.Mutex{},
+		now:         time.Now,
+		connections: connections,
+		window:      window,
+		clones:      clones,
+		clones6:     clones6,
+		exempt:      []*net.IPNet{},
+		attempts:    make(map[string][]time.Time),
+		active:      make(map[string]int),
+	}
+
+	for _, e := range exempt {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		// single addresses are treated as /32 or /128
+		if !strings.Contains(e, "/") {
+			if strings.Contains(e, ":") {
+				e = e + "/128"
+			} else {
+				e = e + "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(e)
+		if err != nil {
+			logger.Error().Err(err).Msgf("invalid connection limit exemption %s", e)
+			continue
+		}
+		l.exempt = append(l.exempt, network)
+	}
+
+	return l
+}
+
+// Registers a connection from ip.
+//
+// Returns an error if ip is over a limit, in which case the connection is not
+// counted and release must not be called.
+func (l *connectionLimiter) accept(ip string) error {
+	addr := net.ParseIP(ip)
+	if addr == nil || l.exempted(addr) {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	if l.connections > 0 {
+		// forget attempts outside of the window
+		recent := []time.Time{}
+		for _, t := range l.attempts[ip] {
+			if now.Sub(t) < l.window {
+				recent = append(recent, t)
+			}
+		}
+		recent = append(recent, now)
+		l.attempts[ip] = recent
+
+		if len(recent) > l.connections {
+			return errorThrottled
+		}
+	}
+
+	if l.clones > 0 && l.active[ip] >= l.clones {
+		return errorTooManyClones
+	}
+
+	subnet := subnet64(addr)
+	if subnet != "" && l.clones6 > 0 && l.active[subnet] >= l.clones6 {
+		return errorTooManyClones
+	}
+
+	l.active[ip]++
+	if subnet != "" {
+		l.active[subnet]++
+	}
+
+	// keep attempts map from growing forever
+	for k, attempts := range l.attempts {
+		if len(attempts) > 0 && now.Sub(attempts[len(attempts)-1]) >= l.window {
+			delete(l.attempts, k)
+		}
+	}
+
+	return nil
+}
+
+// Registers a connection from ip without checking the limits, used for
+// connections that were already accepted by a previous process.
+func (l *connectionLimiter) add(ip string) {
+	addr := net.ParseIP(ip)
+	if addr == nil || l.exempted(addr) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active[ip]++
+	if subnet := subnet64(addr); subnet != "" {
+		l.active[subnet]++
+	}
+}
+
+// Releases a connection accepted from ip.
+func (l *connectionLimiter) release(ip string) {
+	addr := net.ParseIP(ip)
+	if addr == nil || l.exempted(addr) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys := []string{ip}
+	if subnet := subnet64(addr); subnet != "" {
+		keys = append(keys, subnet)
+	}
+
+	for _, k := range keys {
+		l.active[k]--
+		if l.active[k] <= 0 {
+			delete(l.active, k)
+		}
+	}
+}
+
+func (l *connectionLimiter) exempted(addr net.IP) bool {
+	for _, network := range l.exempt {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the /64 network of an IPv6 address, empty for IPv4.
+func subnet64(addr net.IP) string {
+	if addr.To4() != nil {
+		return ""
+	}
+	network := &net.IPNet{
+		IP:   addr.Mask(net.CIDRMask(64, 128)),
+		Mask: net.CIDRMask(64, 128),
+	}
+	return network.String()
+}
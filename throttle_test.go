@@ -0,0 +1,75 @@
+package ircd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestConnectionLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	t.Run("throttle", func(t *testing.T) {
+		l := newConnectionLimiter(2, 10*time.Second, 0, 0, nil, zerolog.Nop())
+		l.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			if err := l.accept("192.0.2.1"); err != nil {
+				t.Fatalf("connection %d rejected: %s", i, err)
+			}
+		}
+		if err := l.accept("192.0.2.1"); err != errorThrottled {
+			t.Errorf("got %v, want %v", err, errorThrottled)
+		}
+		if err := l.accept("192.0.2.2"); err != nil {
+			t.Errorf("other address was throttled: %s", err)
+		}
+
+		now = now.Add(11 * time.Second)
+		if err := l.accept("192.0.2.1"); err != nil {
+			t.Errorf("connection after window rejected: %s", err)
+		}
+	})
+
+	t.Run("clones", func(t *testing.T) {
+		l := newConnectionLimiter(0, 0, 2, 0, nil, zerolog.Nop())
+
+		l.accept("192.0.2.1")
+		l.accept("192.0.2.1")
+		if err := l.accept("192.0.2.1"); err != errorTooManyClones {
+			t.Errorf("got %v, want %v", err, errorTooManyClones)
+		}
+
+		l.release("192.0.2.1")
+		if err := l.accept("192.0.2.1"); err != nil {
+			t.Errorf("connection after release rejected: %s", err)
+		}
+	})
+
+	t.Run("ipv6 clones", func(t *testing.T) {
+		l := newConnectionLimiter(0, 0, 0, 2, nil, zerolog.Nop())
+
+		l.accept("2001:db8::1")
+		l.accept("2001:db8::2")
+		if err := l.accept("2001:db8::3"); err != errorTooManyClones {
+			t.Errorf("got %v, want %v", err, errorTooManyClones)
+		}
+		if err := l.accept("2001:db8:0:1::1"); err != nil {
+			t.Errorf("other /64 was limited: %s", err)
+		}
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		l := newConnectionLimiter(1, 10*time.Second, 1, 0, []string{"192.0.2.0/24", "198.51.100.1"}, zerolog.Nop())
+
+		for i := 0; i < 3; i++ {
+			if err := l.accept("192.0.2.1"); err != nil {
+				t.Errorf("exempt address rejected: %s", err)
+			}
+			if err := l.accept("198.51.100.1"); err != nil {
+				t.Errorf("exempt address rejected: %s", err)
+			}
+		}
+	})
+}
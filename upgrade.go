@@ -0,0 +1,654 @@
+package ircd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/salimnassim/ircd/metrics"
+)
+
+// Version of the state format passed between processes on upgrade.
+const upgradeStateVersion = 1
+
+// Listener passed over from the previous process.
+type InheritedListener struct {
+	Listener net.Listener
+	Config   ListenerConfig
+}
+
+// Server state handed over to the new process.
+//
+// File descriptors are numbered as seen by the new process.
+type upgradeState struct {
+	Version int
+	// Written to when the new process is serving clients.
+	Ready     int
+	Listeners []upgradeListener
+	Clients   []upgradeClient
+	Channels  []upgradeChannel
+}
+
+type upgradeListener struct {
+	FD    int
+	TLS   bool
+	Ident bool
+}
+
+type upgradeClient struct {
+	FD           int
+	ID           string
+	IP           string
+	Nickname     string
+	Username     string
+	Realname     string
+	Hostname     string
+	Realhost     string
+	Ident        string
+	Away         string
+	Password     string
+	Account      string
+	Class        string
+	Modes        string
+	Handshake    bool
+	Negotiating  bool
+	Capabilities []string
+	// Bytes read from the connection that have not been parsed.
+	Input []byte
+	// Lines waiting to be processed.
+	Queued []string
+	// Lines waiting to be sent.
+	Output []string
+}
+
+type upgradeChannel struct {
+	Name        string
+	Owner       string
+	Key         string
+	Limit       int
+	Forward     string
+	Modes       string
+	Topic       string
+	TopicAuthor string
+	TopicTime   int
+	// List mode entries by mode letter.
+	Lists   map[string][]listEntry
+	Members []upgradeMember
+}
+
+type upgradeMember struct {
+	ID    string
+	Modes string
+}
+
+// Client detached for an upgrade.
+type detachedClient struct {
+	c      *client
+	file   *os.File
+	queued []queuedMessage
+}
+
+// Hands listeners and connections over to the process started by cmd.
+//
+// Server state is passed as the first of cmd.ExtraFiles (file descriptor 3)
+// and the new process calls Resume with it. TLS sessions can not be handed
+// over, those clients are asked to reconnect. The database set with
+// WithDatabase is closed before cmd is started, so the new process can open
+// it. If the new process does not report that it is ready before ctx is
+// done, it is killed and this server reopens the database and continues
+// serving its clients.
+//
+// After a successful upgrade Run returns ErrServerUpgraded and the process
+// should exit without calling Shutdown.
+func (s *Server) Upgrade(ctx context.Context, cmd *exec.Cmd) error {
+	if !s.upgradeMu.TryLock() {
+		return errorUpgradeInProgress
+	}
+	defer s.upgradeMu.Unlock()
+
+	done := make(chan struct{})
+	upgraded := false
+
+	s.mu.Lock()
+	s.upgrading = done
+	s.upgraded = false
+	listeners := make(map[net.Listener]ListenerConfig, len(s.listeners))
+	for l, config := range s.listeners {
+		listeners[l] = config
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.upgrading = nil
+		s.upgraded = upgraded
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	type fileListener interface {
+		File() (*os.File, error)
+		SetDeadline(t time.Time) error
+	}
+
+	// duplicate listener descriptors before pausing them
+	files := []*os.File{}
+	state := upgradeState{
+		Version:   upgradeStateVersion,
+		Listeners: []upgradeListener{},
+		Clients:   []upgradeClient{},
+		Channels:  []upgradeChannel{},
+	}
+	paused := []fileListener{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+		if !upgraded {
+			for _, l := range paused {
+				l.SetDeadline(time.Time{})
+			}
+		}
+	}()
+
+	for l, config := range listeners {
+		fl, ok := l.(fileListener)
+		if !ok {
+			return errorUpgradeListener
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		state.Listeners = append(state.Listeners, upgradeListener{
+			TLS:   config.TLS,
+			Ident: config.Ident,
+		})
+	}
+	for l := range listeners {
+		fl := l.(fileListener)
+		fl.SetDeadline(time.Now())
+		paused = append(paused, fl)
+	}
+
+	// stop the connection goroutines
+	detached := []*client{}
+	for _, c := range s.clients.all() {
+		cl, ok := c.(*client)
+		if !ok {
+			continue
+		}
+		if _, ok := cl.conn.(*net.TCPConn); !ok {
+			cl.kill("Server is restarting, please reconnect")
+			continue
+		}
+		cl.detach()
+		detached = append(detached, cl)
+	}
+
+	for _, c := range detached {
+		select {
+		case <-c.stopped:
+		case <-ctx.Done():
+			s.reattach(detached, nil)
+			return ctx.Err()
+		}
+	}
+
+	clients := []detachedClient{}
+	for _, c := range detached {
+		dc := detachedClient{c: c, queued: []queuedMessage{}}
+		for len(c.in) > 0 {
+			dc.queued = append(dc.queued, <-c.in)
+		}
+		f, err := c.conn.(*net.TCPConn).File()
+		if err != nil {
+			s.reattach(detached, clients)
+			return err
+		}
+		dc.file = f
+		files = append(files, f)
+		clients = append(clients, dc)
+	}
+
+	// 0 is the state file, 1 the ready pipe
+	fd := 3 + 2
+	for i := range state.Listeners {
+		state.Listeners[i].FD = fd
+		fd++
+	}
+	for _, dc := range clients {
+		state.Clients = append(state.Clients, exportClient(dc, fd))
+		fd++
+	}
+	for _, ch := range s.channels.all() {
+		state.Channels = append(state.Channels, exportChannel(ch))
+	}
+	state.Ready = 4
+
+	stateFile, err := os.CreateTemp("", "ircd-upgrade-")
+	if err != nil {
+		s.reattach(detached, clients)
+		return err
+	}
+	os.Remove(stateFile.Name())
+	defer stateFile.Close()
+
+	err = json.NewEncoder(stateFile).Encode(state)
+	if err == nil {
+		_, err = stateFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		s.reattach(detached, clients)
+		return err
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		s.reattach(detached, clients)
+		return err
+	}
+	defer ready.Close()
+
+	// the new process opens the database when it starts
+	err = s.releaseDatabase()
+	if err != nil {
+		readyWriter.Close()
+		s.reattach(detached, clients)
+		return err
+	}
+
+	cmd.ExtraFiles = append([]*os.File{stateFile, readyWriter}, files...)
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		s.reclaimDatabase(nil)
+		s.reattach(detached, clients)
+		return err
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		// EOF if the new process exits before it is ready
+		line, err := bufio.NewReader(ready).ReadString('\n')
+		if err != nil || strings.TrimSpace(line) != "ready" {
+			err = errorUpgradeNotReady
+		}
+		result <- err
+	}()
+
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		exited := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(exited)
+		}()
+		s.reclaimDatabase(exited)
+		s.reattach(detached, clients)
+		return err
+	}
+
+	// the new process has its own descriptors, closing ours does not
+	// affect the connections
+	for _, c := range detached {
+		c.conn.Close()
+	}
+	// the new process expires list entries
+	s.stopListTimers()
+	upgraded = true
+	s.log.Info().Msgf("upgraded to process %d with %d clients", cmd.Process.Pid, len(clients))
+	return nil
+}
+
+// Writes pending history and closes the database so the new process can
+// open it. Does nothing if the stores are not saved.
+func (s *Server) releaseDatabase() error {
+	if s.db == nil {
+		return nil
+	}
+	err := s.history.flush()
+	if err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+// Opens the database again after a failed upgrade, once the new process has
+// exited. A nil exited means the process was never started.
+func (s *Server) reclaimDatabase(exited <-chan struct{}) {
+	if s.db == nil {
+		return
+	}
+	if exited != nil {
+		<-exited
+	}
+	err := s.db.reopen()
+	if err != nil {
+		s.log.Error().Err(err).Msg("cant reopen database after failed upgrade")
+	}
+}
+
+// Serves detached clients again after a failed upgrade.
+func (s *Server) reattach(detached []*client, clients []detachedClient) {
+	for _, dc := range clients {
+		for _, qm := range dc.queued {
+			dc.c.in <- qm
+		}
+	}
+	for _, c := range detached {
+		s.connections.Add(1)
+		go func() {
+			defer s.connections.Done()
+			// goroutines may still be stopping if the upgrade timed out
+			<-c.stopped
+			c.reattach()
+			serveClient(c, s, ListenerConfig{})
+		}()
+	}
+}
+
+// Is an upgrade in progress?
+func (s *Server) upgradeInProgress() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.upgrading != nil
+}
+
+// Blocks while an upgrade is in progress.
+//
+// Paused is true if there was an upgrade in progress, upgraded is true if
+// the new process took over.
+func (s *Server) awaitUpgrade() (paused bool, upgraded bool) {
+	s.mu.RLock()
+	done := s.upgrading
+	s.mu.RUnlock()
+	if done == nil {
+		return false, false
+	}
+
+	<-done
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return true, s.upgraded
+}
+
+// Restores server state passed over by Upgrade.
+//
+// Returns the inherited listeners, which have to be passed to Run. TLS
+// listeners need their ListenerConfig.TLSConfig set before that.
+func (s *Server) Resume(state *os.File) ([]InheritedListener, error) {
+	defer state.Close()
+
+	var us upgradeState
+	err := json.NewDecoder(state).Decode(&us)
+	if err != nil {
+		return nil, err
+	}
+	if us.Version != upgradeStateVersion {
+		return nil, errorUpgradeVersion
+	}
+
+	listeners := []InheritedListener{}
+	for _, ul := range us.Listeners {
+		f := os.NewFile(uintptr(ul.FD), "listener")
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, InheritedListener{
+			Listener: l,
+			Config: ListenerConfig{
+				TLS:   ul.TLS,
+				Ident: ul.Ident,
+			},
+		})
+	}
+
+	clients := make(map[string]*client)
+	for _, uc := range us.Clients {
+		c, err := importClient(s, uc)
+		if err != nil {
+			s.log.Error().Err(err).Msgf("cant resume client %s", uc.ID)
+			continue
+		}
+		clients[uc.ID] = c
+	}
+
+	for _, uc := range us.Channels {
+		ch := newChannel(uc.Name, clientID(uc.Owner))
+		ch.k = uc.Key
+		ch.l = uc.Limit
+		ch.f = uc.Forward
+		ch.t = &topic{
+			text:      uc.Topic,
+			timestamp: uc.TopicTime,
+			author:    uc.TopicAuthor,
+		}
+		for _, r := range uc.Modes {
+			ch.addMode(channelModeMap[r])
+		}
+		for mode, entries := range uc.Lists {
+			r, _ := utf8.DecodeRuneInString(mode)
+			for _, entry := range entries {
+				if entry.expired(s.now()) {
+					continue
+				}
+				ch.addListEntry(r, entry)
+				s.scheduleListExpiry(ch, r, entry)
+			}
+		}
+		for _, um := range uc.Members {
+			c, ok := clients[um.ID]
+			if !ok {
+				continue
+			}
+			ch.clients().add(c)
+			for _, r := range um.Modes {
+				ch.clients().addMode(c, channelMembershipModeMap[r])
+			}
+		}
+		// only virtual clients were left on the channel
+		if ch.clients().count() == 0 {
+			continue
+		}
+		s.channels.add(uc.Name, ch)
+		metrics.Channels.Inc()
+	}
+
+	for _, c := range clients {
+		s.connections.Add(1)
+		go func() {
+			defer s.connections.Done()
+			serveClient(c, s, ListenerConfig{})
+		}()
+	}
+
+	ready := os.NewFile(uintptr(us.Ready), "ready")
+	_, err = io.WriteString(ready, "ready\n")
+	ready.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info().Msgf("resumed %d clients and %d channels", len(clients), len(us.Channels))
+	return listeners, nil
+}
+
+func exportClient(dc detachedClient, fd int) upgradeClient {
+	c := dc.c
+
+	modes := ""
+	for r, m := range clientModeMap {
+		if c.hasMode(m) {
+			modes += string(r)
+		}
+	}
+
+	input := append([]byte{}, c.partial...)
+	if n := c.reader.Buffered(); n > 0 {
+		buffered, _ := c.reader.Peek(n)
+		input = append(input, buffered...)
+	}
+
+	queued := []string{}
+	for _, qm := range dc.queued {
+		queued = append(queued, qm.message.raw)
+	}
+
+	return upgradeClient{
+		FD:           fd,
+		ID:           string(c.id()),
+		IP:           c.ip(),
+		Nickname:     c.nickname(),
+		Username:     c.username(),
+		Realname:     c.realname(),
+		Hostname:     c.hostname(),
+		Realhost:     c.realhost(),
+		Ident:        c.ident(),
+		Away:         c.away(),
+		Password:     c.password(),
+		Account:      c.account(),
+		Class:        c.class().name,
+		Modes:        modes,
+		Handshake:    c.handshake(),
+		Negotiating:  c.negotiating(),
+		Capabilities: c.capabilities(),
+		Input:        input,
+		Queued:       queued,
+		Output:       c.sendq.pending(),
+	}
+}
+
+func importClient(s *Server, uc upgradeClient) (*client, error) {
+	f := os.NewFile(uintptr(uc.FD), "client")
+	conn, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(conn, uc.ID)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// bytes read by the previous process come first
+	c.reader = bufio.NewReaderSize(
+		io.MultiReader(bytes.NewReader(uc.Input), conn),
+		inputBufferSize,
+	)
+
+	c.address = uc.IP
+	c.setNickname(uc.Nickname)
+	c.setUser(uc.Username, uc.Realname)
+	c.setHostname(uc.Hostname)
+	c.setRealhost(uc.Realhost)
+	c.setIdent(uc.Ident)
+	c.setAway(uc.Away)
+	c.setPassword(uc.Password)
+	c.setAccount(uc.Account)
+	c.setNegotiating(uc.Negotiating)
+	for _, capability := range uc.Capabilities {
+		c.setCapability(capability, true)
+	}
+	for _, r := range uc.Modes {
+		c.addMode(clientModeMap[r])
+	}
+	close(c.lookupDone)
+
+	class := s.defaultClass
+	for _, cl := range s.classes {
+		if cl.name == uc.Class {
+			class = cl
+			break
+		}
+	}
+	c.cls = class
+	c.flood = newFloodControl(class.flood)
+	c.sendq = newSendQueue(class.sendq)
+
+	if uc.Handshake {
+		class.add()
+		s.handshakes.Store(c.id(), true)
+		c.setHandshake(true)
+	}
+
+	for _, line := range uc.Output {
+		c.sendq.push(line)
+	}
+	for _, line := range uc.Queued {
+		m, err := parseMessage(line)
+		if err != nil {
+			continue
+		}
+		c.in <- queuedMessage{message: m, at: time.Now()}
+	}
+
+	s.limiter.add(c.ip())
+	s.clients.add(c)
+	metrics.Clients.Inc()
+	return c, nil
+}
+
+func exportChannel(ch channeler) upgradeChannel {
+	modes := ""
+	for r, m := range channelModeMap {
+		if ch.hasMode(m) {
+			modes += string(r)
+		}
+	}
+
+	lists := make(map[string][]listEntry)
+	for mode := range channelModeListers {
+		if entries := ch.listEntries(mode); len(entries) > 0 {
+			lists[string(mode)] = entries
+		}
+	}
+
+	members := []upgradeMember{}
+	for _, c := range ch.clients().all() {
+		memberModes := ""
+		for r, m := range channelMembershipModeMap {
+			if ch.clients().hasMode(c, m) {
+				memberModes += string(r)
+			}
+		}
+		members = append(members, upgradeMember{
+			ID:    string(c.id()),
+			Modes: memberModes,
+		})
+	}
+
+	t := ch.topic()
+	return upgradeChannel{
+		Name:        ch.name(),
+		Owner:       string(ch.owner()),
+		Key:         ch.key(),
+		Limit:       ch.limit(),
+		Forward:     ch.forward(),
+		Modes:       modes,
+		Topic:       t.text,
+		TopicAuthor: t.author,
+		TopicTime:   t.timestamp,
+		Lists:       lists,
+		Members:     members,
+	}
+}
@@ -0,0 +1,220 @@
+package ircd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Set when the test binary runs as the new process of an upgrade.
+const upgradeTestEnv = "IRCD_TEST_UPGRADE"
+
+// Database path the new process opens, if set.
+const upgradeTestDatabaseEnv = "IRCD_TEST_UPGRADE_DATABASE"
+
+func TestMain(m *testing.M) {
+	if path, ok := os.LookupEnv(upgradeTestDatabaseEnv); ok {
+		// fails if the previous process still has it open
+		_, err := OpenDatabase(path)
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+	if _, ok := os.LookupEnv(upgradeTestEnv); ok {
+		s := NewServer(ServerConfig{Name: "upgraded"})
+		listeners, err := s.Resume(os.NewFile(3, "upgrade"))
+		if err != nil {
+			os.Exit(1)
+		}
+		for _, l := range listeners {
+			go s.Run(context.Background(), l.Listener, l.Config)
+		}
+		// killed by the test
+		select {}
+	}
+	os.Exit(m.Run())
+}
+
+// Starts a server with one connected client.
+func startUpgradeServer(t *testing.T, opts ...Option) (*Server, net.Conn, *bufio.Reader) {
+	s := NewServer(ServerConfig{
+		Name:          "server",
+		LookupTimeout: 1,
+	}, opts...)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Run(context.Background(), listener, ListenerConfig{})
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	reader := bufio.NewReader(conn)
+	expectLine(t, conn, reader, "PING :one", "PONG :one")
+	return s, conn, reader
+}
+
+// Sends line and waits for want.
+func expectLine(t *testing.T, conn net.Conn, reader *bufio.Reader, line string, want string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write([]byte(line + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		got, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", want, err)
+		}
+		if strings.TrimRight(got, "\r\n") == want {
+			return
+		}
+	}
+}
+
+func TestUpgradeRollback(t *testing.T) {
+	s, conn, reader := startUpgradeServer(t)
+
+	// exits without reporting that it is ready
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.Upgrade(ctx, cmd)
+	if !errors.Is(err, errorUpgradeNotReady) {
+		t.Fatalf("got: %v, want: %v", err, errorUpgradeNotReady)
+	}
+
+	// client is still served by the old process
+	expectLine(t, conn, reader, "PING :two", "PONG :two")
+}
+
+func TestUpgrade(t *testing.T) {
+	s, conn, reader := startUpgradeServer(t)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), upgradeTestEnv+"=1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.Upgrade(ctx, cmd)
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	// answered by the new process over the same connection
+	expectLine(t, conn, reader, "PING :three", "PONG :three")
+}
+
+func TestUpgradeDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, conn, reader := startUpgradeServer(t, WithDatabase(db))
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), upgradeTestEnv+"=1", upgradeTestDatabaseEnv+"="+path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Upgrade(ctx, cmd)
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	defer cmd.Process.Kill()
+	expectLine(t, conn, reader, "PING :four", "PONG :four")
+
+	// the old process no longer writes to the database
+	if err := db.put("test/a", "one"); err == nil {
+		t.Error("old process wrote to the database after the upgrade")
+	}
+}
+
+func TestUpgradeRollbackDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s, conn, reader := startUpgradeServer(t, WithDatabase(db))
+
+	// opens the database, then exits without reporting that it is ready
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), upgradeTestDatabaseEnv+"="+path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Upgrade(ctx, cmd)
+	if !errors.Is(err, errorUpgradeNotReady) {
+		t.Fatalf("got: %v, want: %v", err, errorUpgradeNotReady)
+	}
+	expectLine(t, conn, reader, "PING :five", "PONG :five")
+
+	// the database was handed back
+	if err := db.put("test/a", "one"); err != nil {
+		t.Errorf("cant write after rollback: %v", err)
+	}
+}
+
+func TestImportClientLimits(t *testing.T) {
+	s := NewServer(ServerConfig{Name: "server"})
+	s.defaultClass.maxClients = 1
+	s.limiter.clones = 1
+	// the slots are already taken by a client resumed before
+	s.defaultClass.join()
+	s.limiter.accept("127.0.0.1")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	f, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := importClient(s, upgradeClient{
+		FD:        int(f.Fd()),
+		ID:        "resumed",
+		IP:        "127.0.0.1",
+		Nickname:  "resumed",
+		Handshake: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.conn.Close()
+
+	// counted even though the limits are reached, so releasing both
+	// clients does not go below zero
+	if s.defaultClass.clients != 2 {
+		t.Errorf("got %d clients in class, want 2", s.defaultClass.clients)
+	}
+	if s.limiter.active["127.0.0.1"] != 2 {
+		t.Errorf("got %d connections from ip, want 2", s.limiter.active["127.0.0.1"])
+	}
+}
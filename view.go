@@ -0,0 +1,139 @@
+package ircd
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Read-only snapshot of a client.
+type ClientView struct {
+	ID       string
+	Nickname string
+	Username string
+	Realname string
+	// Visible (possibly cloaked) hostname.
+	Hostname string
+	IP       string
+	Away     string
+	// Client modestring, e.g. +iz.
+	Modes string
+	TLS   bool
+	// Has the client completed registration?
+	Registered bool
+	// Account the client is logged in to, empty if none.
+	Account string
+	// Names of channels the client is a member of.
+	Channels []string
+}
+
+// Read-only snapshot of a channel.
+type ChannelView struct {
+	Name        string
+	Topic       string
+	TopicAuthor string
+	TopicTime   time.Time
+	// Channel modestring, e.g. +nt.
+	Modes   string
+	Members []MemberView
+}
+
+// Channel member as seen in a ChannelView.
+type MemberView struct {
+	Nickname string
+	// Membership modestring, e.g. +o.
+	Modes string
+}
+
+// Returns snapshots of all connected clients.
+func (s *Server) Clients() []ClientView {
+	views := []ClientView{}
+	for _, c := range s.clients.all() {
+		views = append(views, s.clientView(c))
+	}
+	slices.SortFunc(views, func(a ClientView, b ClientView) int {
+		return strings.Compare(a.Nickname, b.Nickname)
+	})
+	return views
+}
+
+// Returns a snapshot of the client using nickname.
+func (s *Server) Client(nickname string) (ClientView, bool) {
+	c, ok := s.clients.get(nickname)
+	if !ok {
+		return ClientView{}, false
+	}
+	return s.clientView(c), true
+}
+
+// Returns snapshots of all channels.
+func (s *Server) Channels() []ChannelView {
+	views := []ChannelView{}
+	for _, ch := range s.channels.all() {
+		views = append(views, channelView(ch))
+	}
+	slices.SortFunc(views, func(a ChannelView, b ChannelView) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return views
+}
+
+// Returns a snapshot of the channel called name.
+func (s *Server) Channel(name string) (ChannelView, bool) {
+	ch, ok := s.channels.get(name)
+	if !ok {
+		return ChannelView{}, false
+	}
+	return channelView(ch), true
+}
+
+func (s *Server) clientView(c clienter) ClientView {
+	channels := []string{}
+	for _, ch := range s.channels.memberOf(c) {
+		channels = append(channels, ch.name())
+	}
+	slices.Sort(channels)
+
+	return ClientView{
+		ID:         string(c.id()),
+		Nickname:   c.nickname(),
+		Username:   c.username(),
+		Realname:   c.realname(),
+		Hostname:   c.hostname(),
+		IP:         c.ip(),
+		Away:       c.away(),
+		Modes:      c.modestring(),
+		TLS:        c.tls(),
+		Registered: c.handshake(),
+		Account:    c.account(),
+		Channels:   channels,
+	}
+}
+
+func channelView(ch channeler) ChannelView {
+	members := []MemberView{}
+	for _, c := range ch.clients().all() {
+		members = append(members, MemberView{
+			Nickname: c.nickname(),
+			Modes:    ch.clients().modestring(c),
+		})
+	}
+	slices.SortFunc(members, func(a MemberView, b MemberView) int {
+		return strings.Compare(a.Nickname, b.Nickname)
+	})
+
+	t := ch.topic()
+	topicTime := time.Time{}
+	if t.timestamp > 0 {
+		topicTime = time.Unix(int64(t.timestamp), 0)
+	}
+
+	return ChannelView{
+		Name:        ch.name(),
+		Topic:       t.text,
+		TopicAuthor: t.author,
+		TopicTime:   topicTime,
+		Modes:       ch.modestring(),
+		Members:     members,
+	}
+}
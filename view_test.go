@@ -0,0 +1,58 @@
+package ircd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestServerViews(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewServer(
+		ServerConfig{Name: "server"},
+		WithLogger(zerolog.Nop()),
+		WithMetricsRegistry(prometheus.NewRegistry()),
+		WithClock(func() time.Time { return now }),
+	)
+
+	c := newMockClient(true)
+	s.clients.add(c)
+
+	ch := newChannel("#test", c.id())
+	ch.clients().add(c)
+	ch.clients().addMode(c, modeMemberOperator)
+	s.channels.add(ch.name(), ch)
+
+	handleTopic(s, c, message{command: "TOPIC", params: []string{"#test", "hello"}})
+
+	clients := s.Clients()
+	if len(clients) != 1 {
+		t.Fatalf("got %d clients, want 1", len(clients))
+	}
+	if clients[0].Nickname != "mocknick" || !clients[0].Registered {
+		t.Errorf("unexpected client view: %+v", clients[0])
+	}
+	if len(clients[0].Channels) != 1 || clients[0].Channels[0] != "#test" {
+		t.Errorf("got channels %v, want [#test]", clients[0].Channels)
+	}
+
+	view, ok := s.Channel("#test")
+	if !ok {
+		t.Fatal("channel not found")
+	}
+	if view.Topic != "hello" || view.TopicAuthor != "mocknick" {
+		t.Errorf("unexpected topic: %+v", view)
+	}
+	if !view.TopicTime.Equal(now) {
+		t.Errorf("got topic time %s, want %s", view.TopicTime, now)
+	}
+	if len(view.Members) != 1 || view.Members[0].Modes != "+o" {
+		t.Errorf("unexpected members: %+v", view.Members)
+	}
+
+	if _, ok := s.Client("nobody"); ok {
+		t.Errorf("found client that does not exist")
+	}
+}
@@ -0,0 +1,434 @@
+package ircd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/salimnassim/ircd/metrics"
+)
+
+// Virtual client settings.
+type VirtualClientConfig struct {
+	Nickname string
+	// Defaults to the nickname.
+	Username string
+	// Defaults to the nickname.
+	Realname string
+	// Defaults to the server name.
+	Hostname string
+	// Called with every line sent to the client, in order. Lines are
+	// delivered from a goroutine owned by the client, so Deliver can call
+	// back into the server. Lines sent while more than the send queue of
+	// the default class is waiting for Deliver are dropped.
+	Deliver func(line string)
+}
+
+// Pseudo-user that lives inside the server process.
+//
+// Virtual clients are registered as soon as they are created and are not
+// subject to flood control or connection limits. Create with
+// NewVirtualClient.
+type VirtualClient struct {
+	s *Server
+	c *virtualClient
+}
+
+// Creates a registered virtual client.
+func (s *Server) NewVirtualClient(config VirtualClientConfig) (*VirtualClient, error) {
+	if !s.regex[regexNick].MatchString(config.Nickname) {
+		return nil, ErrErroneousNickname
+	}
+	if config.Username == "" {
+		config.Username = config.Nickname
+	}
+	if config.Realname == "" {
+		config.Realname = config.Nickname
+	}
+	if config.Hostname == "" {
+		config.Hostname = s.name
+	}
+
+	c := &virtualClient{
+		mu:       &sync.RWMutex{},
+		clientID: clientID(uuid.Must(uuid.NewRandom()).String()),
+		nick:     config.Nickname,
+		user:     config.Username,
+		real:     config.Realname,
+		host:     config.Hostname,
+		cls:      s.defaultClass,
+		caps:     make(map[string]bool),
+		deliver:  config.Deliver,
+		sendq:    newSendQueue(s.defaultClass.sendq),
+		killed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	// checked under the server lock so two virtual clients can not take
+	// the same nickname
+	s.mu.Lock()
+	if _, exists := s.clients.get(config.Nickname); exists {
+		s.mu.Unlock()
+		return nil, ErrNicknameInUse
+	}
+	s.clients.add(c)
+	s.mu.Unlock()
+	metrics.Clients.Inc()
+
+	s.connections.Add(1)
+	go func() {
+		defer s.connections.Done()
+		c.run()
+		s.cleanup(c)
+		close(c.done)
+	}()
+
+	return &VirtualClient{s: s, c: c}, nil
+}
+
+// Returns a handle that can be passed to commands and events.
+func (vc *VirtualClient) Client() *Client {
+	return &Client{s: vc.s, c: vc.c}
+}
+
+// Processes line as if the client had sent it to the server.
+func (vc *VirtualClient) Handle(line string) error {
+	select {
+	case <-vc.c.killed:
+		return ErrClientQuit
+	default:
+	}
+	m, err := parseMessage(line)
+	if err != nil {
+		return err
+	}
+	return vc.s.router.handle(vc.s, vc.c, m)
+}
+
+func (vc *VirtualClient) Join(channel string) error {
+	return vc.Handle(fmt.Sprintf("JOIN %s", channel))
+}
+
+func (vc *VirtualClient) Part(channel string, reason string) error {
+	return vc.Handle(fmt.Sprintf("PART %s :%s", channel, reason))
+}
+
+func (vc *VirtualClient) Privmsg(target string, text string) error {
+	return vc.Handle(fmt.Sprintf("PRIVMSG %s :%s", target, text))
+}
+
+func (vc *VirtualClient) Notice(target string, text string) error {
+	return vc.Handle(fmt.Sprintf("NOTICE %s :%s", target, text))
+}
+
+// Changes nickname, rejections are delivered as numerics.
+func (vc *VirtualClient) Nick(nickname string) error {
+	return vc.Handle(fmt.Sprintf("NICK %s", nickname))
+}
+
+// Removes the client from the server.
+func (vc *VirtualClient) Quit(reason string) {
+	vc.c.kill(reason)
+}
+
+// Closed after the client has quit and left every channel.
+func (vc *VirtualClient) Done() <-chan struct{} {
+	return vc.c.done
+}
+
+type virtualClient struct {
+	mu *sync.RWMutex
+
+	clientID clientID
+	nick     string
+	user     string
+	real     string
+	host     string
+	modes    clientMode
+	afk      string
+	acct     string
+	cls      *connectionClass
+	q        string
+	caps     map[string]bool
+
+	deliver func(line string)
+	sendq   *sendQueue
+	// Closed when the client is killed.
+	killed chan struct{}
+	// Closed when the client has been cleaned up.
+	done chan struct{}
+}
+
+// Passes queued lines to deliver until the client is killed.
+func (c *virtualClient) run() {
+	for {
+		select {
+		case <-c.sendq.ready():
+			for _, line := range c.sendq.drain() {
+				if c.deliver != nil {
+					c.deliver(line)
+				}
+			}
+		case <-c.killed:
+			c.sendq.drain()
+			return
+		}
+	}
+}
+
+func (c *virtualClient) String() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return fmt.Sprintf("id: %s, nickname: %s, username: %s, realname: %s, hostname: %s, virtual: true",
+		c.clientID, c.nick, c.user, c.real, c.host)
+}
+
+func (c *virtualClient) id() clientID {
+	return c.clientID
+}
+
+func (c *virtualClient) ip() string {
+	return "127.0.0.1"
+}
+
+func (c *virtualClient) nickname() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nick
+}
+
+func (c *virtualClient) setNickname(nickname string) {
+	c.mu.Lock()
+	c.nick = nickname
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) username() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.user
+}
+
+func (c *virtualClient) ident() string {
+	return ""
+}
+
+func (c *virtualClient) setIdent(ident string) {}
+
+func (c *virtualClient) realname() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.real
+}
+
+func (c *virtualClient) setUser(username string, realname string) {
+	c.mu.Lock()
+	c.user = username
+	c.real = realname
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) hostname() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.host
+}
+
+func (c *virtualClient) setHostname(hostname string) {
+	c.mu.Lock()
+	c.host = hostname
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) realhost() string {
+	return c.hostname()
+}
+
+func (c *virtualClient) setRealhost(hostname string) {}
+
+// Virtual clients never leave the process.
+func (c *virtualClient) tls() bool {
+	return true
+}
+
+func (c *virtualClient) setTLS(tls bool) {}
+
+func (c *virtualClient) away() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.afk
+}
+
+func (c *virtualClient) setAway(text string) {
+	c.mu.Lock()
+	c.afk = text
+	c.mu.Unlock()
+}
+
+var lookupsDone = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+func (c *virtualClient) lookups() <-chan struct{} {
+	return lookupsDone
+}
+
+func (c *virtualClient) handshake() bool {
+	return true
+}
+
+func (c *virtualClient) setHandshake(handshake bool) {}
+
+func (c *virtualClient) password() string {
+	return ""
+}
+
+func (c *virtualClient) setPassword(password string) {}
+
+func (c *virtualClient) certfp() string {
+	return ""
+}
+
+func (c *virtualClient) account() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.acct
+}
+
+func (c *virtualClient) setAccount(account string) {
+	c.mu.Lock()
+	c.acct = account
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) class() *connectionClass {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cls
+}
+
+func (c *virtualClient) setClass(class *connectionClass) {
+	c.mu.Lock()
+	c.cls = class
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) prefix() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return fmt.Sprintf("%s!%s@%s", c.nick, c.user, c.host)
+}
+
+func (c *virtualClient) modestring() string {
+	modes := []rune{}
+	for m, r := range clientModeMap {
+		if c.hasMode(r) {
+			modes = append(modes, m)
+		}
+	}
+	slices.SortFunc(modes, func(a rune, b rune) int {
+		return cmp.Compare(a, b)
+	})
+	return fmt.Sprintf("+%s", string(modes))
+}
+
+func (c *virtualClient) addMode(mode clientMode) {
+	c.mu.Lock()
+	c.modes |= mode
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) removeMode(mode clientMode) {
+	c.mu.Lock()
+	c.modes &^= mode
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) hasMode(mode clientMode) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modes&mode != 0
+}
+
+func (c *virtualClient) sendRPL(server string, rpl rpl) {
+	c.send(fmt.Sprintf(":%s %s", server, rpl.rpl()))
+}
+
+func (c *virtualClient) sendCommand(cmd command) {
+	c.send(cmd.command())
+}
+
+func (c *virtualClient) quitReason() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.q
+}
+
+func (c *virtualClient) setQuitreason(reason string) {
+	c.mu.Lock()
+	c.q = reason
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) hasCapability(capability string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.caps[capability]
+}
+
+func (c *virtualClient) setCapability(capability string, enabled bool) {
+	c.mu.Lock()
+	if enabled {
+		c.caps[capability] = true
+	} else {
+		delete(c.caps, capability)
+	}
+	c.mu.Unlock()
+}
+
+func (c *virtualClient) capabilities() []string {
+	c.mu.RLock()
+	caps := []string{}
+	for capability := range c.caps {
+		caps = append(caps, capability)
+	}
+	c.mu.RUnlock()
+	slices.Sort(caps)
+	return caps
+}
+
+func (c *virtualClient) negotiating() bool {
+	return false
+}
+
+func (c *virtualClient) setNegotiating(negotiating bool) {}
+
+// Lines that do not fit the send queue are dropped instead of killing the
+// client. Services run on virtual clients and nothing would restart them.
+func (c *virtualClient) send(text string) {
+	if !c.sendq.push(text) {
+		metrics.SendQueueExceeded.Inc()
+	}
+}
+
+func (c *virtualClient) pong(pong bool) {}
+
+func (c *virtualClient) kill(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.killed:
+		return
+	default:
+	}
+	c.q = strings.TrimSpace(reason)
+	if c.q == "" {
+		c.q = "Client quit"
+	}
+	close(c.killed)
+}
@@ -0,0 +1,169 @@
+package ircd
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Collects lines delivered to a virtual client.
+func collect(lines chan string, n int) []string {
+	got := []string{}
+	timeout := time.After(100 * time.Millisecond)
+	for len(got) < n {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-timeout:
+			return got
+		}
+	}
+	return got
+}
+
+func TestVirtualClient(t *testing.T) {
+	s := newHookServer()
+
+	lines := make(chan string, 16)
+	bot, err := s.NewVirtualClient(VirtualClientConfig{
+		Nickname: "bot",
+		Deliver: func(line string) {
+			lines <- line
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.NewVirtualClient(VirtualClientConfig{Nickname: "bot"}); err != ErrNicknameInUse {
+		t.Errorf("got %v, want %v", err, ErrNicknameInUse)
+	}
+	if _, err := s.NewVirtualClient(VirtualClientConfig{Nickname: "!"}); err != ErrErroneousNickname {
+		t.Errorf("got %v, want %v", err, ErrErroneousNickname)
+	}
+
+	if err := bot.Join("#test"); err != nil {
+		t.Fatal(err)
+	}
+	// skip join replies
+	for len(collect(lines, 1)) > 0 {
+	}
+
+	c := newMockClient(true)
+	s.clients.add(c)
+	ch, _ := s.channels.get("#test")
+	ch.clients().add(c)
+
+	handlePrivmsg(s, c, message{command: "PRIVMSG", params: []string{"#test", "hello bot"}})
+	want := []string{":mocknick!mockuser@mockhost PRIVMSG #test :hello bot"}
+	if got := collect(lines, 1); slices.Compare(got, want) != 0 {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if err := bot.Privmsg("#test", "hello human"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.Notice("mocknick", "psst"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		":bot!bot@server PRIVMSG #test :hello human",
+		":bot!bot@server NOTICE mocknick :psst",
+	}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", c.messagesOut, want)
+	}
+
+	c.reset()
+	bot.Quit("bye")
+	<-bot.Done()
+	want = []string{":bot!bot@server QUIT :Quit: bye"}
+	if slices.Compare(c.messagesOut, want) != 0 {
+		t.Errorf("got %v, want %v", c.messagesOut, want)
+	}
+	if _, ok := s.clients.get("bot"); ok {
+		t.Error("virtual client was not removed")
+	}
+	if err := bot.Privmsg("#test", "still here?"); err != ErrClientQuit {
+		t.Errorf("got %v, want %v", err, ErrClientQuit)
+	}
+}
+
+func TestVirtualClientClass(t *testing.T) {
+	s := newHookServer()
+	// a connected client holds a slot in the default class
+	s.defaultClass.join()
+
+	bot, err := s.NewVirtualClient(VirtualClientConfig{Nickname: "bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Quit("bye")
+	<-bot.Done()
+
+	if s.defaultClass.clients != 1 {
+		t.Errorf("got %d clients in class, want 1", s.defaultClass.clients)
+	}
+}
+
+func TestVirtualClientSendQExceeded(t *testing.T) {
+	s := newHookServer()
+
+	// deliver blocks until released, like a service busy hashing passwords
+	release := make(chan struct{})
+	lines := make(chan string, 16)
+	bot, err := s.NewVirtualClient(VirtualClientConfig{
+		Nickname: "bot",
+		Deliver: func(line string) {
+			<-release
+			lines <- line
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bot.c.sendq.setLimit(64)
+	for range 100 {
+		bot.c.send("NOTICE bot :flood")
+	}
+	close(release)
+
+	if bot.c.quitReason() != "" {
+		t.Fatalf("client quit: %s", bot.c.quitReason())
+	}
+	select {
+	case <-bot.Done():
+		t.Fatal("client was removed")
+	default:
+	}
+
+	// lines sent after the backlog is delivered still arrive
+	for len(collect(lines, 16)) > 0 {
+	}
+	bot.c.send("NOTICE bot :after")
+	want := []string{"NOTICE bot :after"}
+	if got := collect(lines, 1); slices.Compare(got, want) != 0 {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestVirtualClientShutdown(t *testing.T) {
+	s := newHookServer()
+	bot, err := s.NewVirtualClient(VirtualClientConfig{Nickname: "bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-bot.Done():
+	default:
+		t.Error("virtual client was not stopped")
+	}
+}